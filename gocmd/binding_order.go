@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// VS Code runs the last binding (in package.json order) whose when clause
+// matches, so the order of the bindings for a key determines which command
+// wins when their when clauses overlap. Bindings are ordered by their
+// priority (see withPriority) and then by their when clause, so bindings
+// with the same priority must never match at the same time (otherwise
+// rewording a when clause could silently change which command runs).
+
+// bindingPriority returns the priority of the binding.
+func bindingPriority(kb *KB) int {
+	if kb == nil {
+		return 0
+	}
+	return kb.Priority
+}
+
+// contextExclusions returns the pairs of keys that are never true at the
+// same time.
+func contextExclusions(contexts []*ContextKey) map[[2]string]bool {
+	excludes := map[[2]string]bool{}
+	for _, ck := range contexts {
+		for _, other := range ck.Excludes {
+			excludes[[2]string{ck.Key, other}] = true
+			excludes[[2]string{other, ck.Key}] = true
+		}
+	}
+	return excludes
+}
+
+// whensOverlap returns whether the when clauses can both be true (or if
+// that can't be determined).
+func whensOverlap(excludes map[[2]string]bool, a, b string) bool {
+	ea, err := parseWhen(a)
+	if err != nil {
+		return true
+	}
+	eb, err := parseWhen(b)
+	if err != nil {
+		return true
+	}
+
+	wv := &whenVariables{ids: map[string]int{}, excludes: excludes}
+	wv.collect(ea)
+	wv.collect(eb)
+	if len(wv.atoms) > maxWhenVariables {
+		return true
+	}
+	for row := uint(0); row < 1<<len(wv.atoms); row++ {
+		if wv.possible(row) && wv.eval(ea, row) && wv.eval(eb, row) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkBindingOrder verifies that bindings for the same key that can match
+// at the same time have different priorities.
+func checkBindingOrder(ds *Diagnostics, contexts []*ContextKey, kbDefs map[Key]map[string]*KB) {
+	excludes := contextExclusions(contexts)
+	keys := maps.Keys(kbDefs)
+	slices.Sort(keys)
+	for _, key := range keys {
+		m := kbDefs[key]
+		var whens []string
+		for _, when := range sortedKeys(m) {
+			// Removals don't run anything, so their order doesn't matter.
+			if m[when] != nil && !strings.HasPrefix(m[when].Command, "-") {
+				whens = append(whens, when)
+			}
+		}
+		for i, a := range whens {
+			for _, b := range whens[i+1:] {
+				if m[a].Priority == m[b].Priority && whensOverlap(excludes, a, b) {
+					ds.ErrorAt(m[b].Location, "bindings for %s (%s when %q and %s when %q) can both match, but have the same priority", key, m[a].Command, a, m[b].Command, b)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWhensOverlap(t *testing.T) {
+	contexts := []*ContextKey{
+		{Key: "editorTextFocus", Type: contextBool, Excludes: []string{"terminalFocus"}},
+		{Key: "terminalFocus", Type: contextBool},
+	}
+	for _, test := range []struct {
+		a    string
+		b    string
+		want bool
+	}{
+		{
+			a:    "",
+			b:    "a",
+			want: true,
+		},
+		{
+			a:    "a",
+			b:    "b",
+			want: true,
+		},
+		{
+			a: "a",
+			b: "!a",
+		},
+		{
+			a: "a && b",
+			b: "!b || !a",
+		},
+		{
+			a: "resourceLangId == go",
+			b: "resourceLangId == 'java'",
+		},
+		{
+			a:    "resourceLangId == go",
+			b:    "resourceLangId != 'java'",
+			want: true,
+		},
+		{
+			a: "editorTextFocus",
+			b: "terminalFocus && a",
+		},
+		{
+			a: "terminalFocus",
+			b: "editorTextFocus",
+		},
+		{
+			a:    "!editorTextFocus",
+			b:    "!terminalFocus",
+			want: true,
+		},
+		{
+			// Invalid clauses can't be proven to be disjoint.
+			a:    "a &&",
+			b:    "!a",
+			want: true,
+		},
+	} {
+		t.Run(test.a+" / "+test.b, func(t *testing.T) {
+			if got := whensOverlap(contextExclusions(contexts), test.a, test.b); got != test.want {
+				t.Errorf("whensOverlap(%q, %q) returned %v; want %v", test.a, test.b, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckBindingOrder(t *testing.T) {
+	contexts := []*ContextKey{
+		{Key: "editorTextFocus", Type: contextBool, Excludes: []string{"terminalFocus"}},
+		{Key: "terminalFocus", Type: contextBool},
+	}
+	for _, test := range []struct {
+		name   string
+		kbDefs map[Key]map[string]*KB
+		want   string
+	}{
+		{
+			name: "disjoint",
+			kbDefs: map[Key]map[string]*KB{
+				ctrl("a"): contextualKB(wc("a"), kb("groog.a"), kb("groog.b")),
+				ctrl("b"): {
+					"editorTextFocus": kb("groog.a"),
+					"terminalFocus":   kb("groog.b"),
+				},
+			},
+		},
+		{
+			name: "overlapping",
+			kbDefs: map[Key]map[string]*KB{
+				ctrl("a"): {
+					"a":  kb("groog.a"),
+					"b":  kb("groog.b"),
+					"":   kb("groog.c"),
+					"!a": nil,
+				},
+			},
+			want: `bindings for ctrl+a (groog.c when "" and groog.a when "a") can both match, but have the same priority
+bindings for ctrl+a (groog.c when "" and groog.b when "b") can both match, but have the same priority
+bindings for ctrl+a (groog.a when "a" and groog.b when "b") can both match, but have the same priority`,
+		},
+		{
+			name: "prioritized",
+			kbDefs: map[Key]map[string]*KB{
+				ctrl("a"): {
+					"a": withPriority(kb("groog.a"), 1),
+					"b": kb("groog.b"),
+					"":  withPriority(kb("groog.c"), -1),
+				},
+			},
+		},
+		{
+			name: "removals",
+			kbDefs: map[Key]map[string]*KB{
+				ctrl("a"): {
+					"a": kb("groog.a"),
+					"":  kb("-groog.b"),
+				},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ds := &Diagnostics{}
+			checkBindingOrder(ds, contexts, test.kbDefs)
+			if diff := cmp.Diff(test.want, diagnosticMessages(ds)); diff != "" {
+				t.Errorf("checkBindingOrder() recorded incorrect diagnostics (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGroogContextExclusions(t *testing.T) {
+	// Exclusions must be between registered bool keys.
+	keys := map[string]*ContextKey{}
+	for _, ck := range groogContextKeys() {
+		keys[ck.Key] = ck
+	}
+	for _, ck := range keys {
+		for _, other := range ck.Excludes {
+			if o, ok := keys[other]; !ok || o.Type != contextBool || ck.Type != contextBool {
+				t.Errorf("context key %q excludes %q, but they aren't both registered bool keys", ck.Key, other)
+			}
+		}
+	}
+}
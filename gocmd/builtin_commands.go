@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// Keybindings reference commands from VS Code (and other extensions) by ID, so
+// a typo only shows up as a key that does nothing. Every command that's run
+// (or removed) by a keybinding must be in the catalog below, provided by the
+// package itself, or provided by a registered extension (see extensions.go).
+
+// ArgType is the JSON type of a command argument.
+type ArgType string
+
+const (
+	argString  ArgType = "string"
+	argBoolean ArgType = "boolean"
+	argNumber  ArgType = "number"
+	argObject  ArgType = "object"
+	argArray   ArgType = "array"
+)
+
+// jsonArgType returns the JSON type of the value.
+func jsonArgType(v interface{}) ArgType {
+	switch v.(type) {
+	case string, Key:
+		return argString
+	case bool:
+		return argBoolean
+	case int, int64, float64:
+		return argNumber
+	case map[string]interface{}:
+		return argObject
+	case []interface{}, []string, []*KB, []map[string]interface{}:
+		return argArray
+	}
+	return ArgType(fmt.Sprintf("%T", v))
+}
+
+// KnownCommand is a command that isn't provided by the package itself.
+type KnownCommand struct {
+	// ID is the command ID. IDs that end in a period match every command
+	// that starts with them (for commands that are generated at runtime).
+	ID string
+	// Extension is the ID of the extension that provides the command (empty
+	// for VS Code commands).
+	Extension string
+	// Since is the first VS Code version that has the command (empty if it's
+	// been around longer than any supported engine).
+	Since string
+	// Args is the type of each argument that the command accepts.
+	Args map[string]ArgType
+}
+
+// lookupCommand returns the catalog entry for the command (the longest match
+// if multiple prefixes match), or nil if there isn't one.
+func lookupCommand(catalog []*KnownCommand, command string) *KnownCommand {
+	var best *KnownCommand
+	for _, kc := range catalog {
+		if matchesPrefix(kc.ID, command) && (best == nil || len(kc.ID) > len(best.ID)) {
+			best = kc
+		}
+	}
+	return best
+}
+
+// checkArgs verifies that the args match the command's schema. Problems are
+// reported at loc.
+func (kc *KnownCommand) checkArgs(ds *Diagnostics, loc Location, command string, args map[string]interface{}) {
+	for _, name := range sortedKeys(args) {
+		want, ok := kc.Args[name]
+		if !ok {
+			ds.ErrorAt(loc, "command %q does not accept arg %q", command, name)
+			continue
+		}
+		if got := jsonArgType(args[name]); got != want {
+			ds.ErrorAt(loc, "command %q arg %q must be a %s (got %s)", command, name, want, got)
+		}
+	}
+}
+
+// checkCommands verifies that every command run (or removed) by the
+// keybindings is known, is available in the minimum supported VS Code
+// version, and is given valid args (the package's own commands are checked
+// against their args structs). Problems are reported at the binding's
+// definition.
+func checkCommands(ds *Diagnostics, er *ExtensionRegistry, p *Package, kbs []*Keybinding) {
+	engine, err := minVersion(p.Engines["vscode"])
+	if err != nil {
+		// The version isn't checked, but the doctor reports the bad engine.
+		engine = nil
+	}
+
+	reported := map[string]bool{}
+	for _, kb := range kbs {
+		for _, c := range keybindingCommands(kb) {
+			// Removed bindings don't run anything, but the command should still exist.
+			command := strings.TrimPrefix(c.Command, "-")
+			if strings.HasPrefix(command, p.Name+".") {
+				// Undeclared commands (only registered by the extension) aren't checked.
+				if i := slices.IndexFunc(p.contributions().Commands, func(pc *Command) bool {
+					return pc.Command == command
+				}); i >= 0 && c.Command == command {
+					checkStructArgs(ds, kb.Location, command, p.Contributes.Commands[i].Args, c.Args)
+				}
+				continue
+			}
+
+			kc := lookupCommand(er.Commands, command)
+			if kc == nil {
+				if _, ok := er.provider(command); !ok && !reported[command] {
+					reported[command] = true
+					ds.WarnAt(kb.Location, "command %q (bound to %s) is not a known command or provided by a registered extension", command, kb.Key)
+				}
+				continue
+			}
+
+			if kc.Since != "" && engine != nil && !reported[command] {
+				if since, err := parseVersion(kc.Since); err != nil {
+					ds.ErrorAt(kb.Location, "command %q has an invalid version (%q): %v", command, kc.Since, err)
+				} else if since.Compare(engine) > 0 {
+					reported[command] = true
+					ds.WarnAt(kb.Location, "command %q (bound to %s) requires VS Code %s, but engines.vscode is %s", command, kb.Key, kc.Since, p.Engines["vscode"])
+				}
+			}
+			if c.Command == command {
+				kc.checkArgs(ds, kb.Location, command, c.Args)
+			}
+		}
+	}
+}
+
+const (
+	sendSequenceCommand = "workbench.action.terminal.sendSequence"
+)
+
+// sendSequence sends the text to the active terminal.
+func sendSequence(text string) *KB {
+	return kbArgs(sendSequenceCommand, map[string]interface{}{
+		"text": text,
+	})
+}
+
+// goTestPackage runs the tests in the current file's package. If background
+// is true, the test output isn't revealed.
+func goTestPackage(background bool) *KB {
+	return kbArgs("go.test.package", map[string]interface{}{
+		"background": background,
+	})
+}
+
+func groogCommandCatalog() []*KnownCommand {
+	var catalog []*KnownCommand
+	add := func(since string, ids ...string) {
+		for _, id := range ids {
+			catalog = append(catalog, &KnownCommand{ID: id, Since: since})
+		}
+	}
+
+	// Editor
+	add("",
+		"closeMarkersNavigation",
+		"editor.action.clipboardPasteAction",
+		"editor.action.commentLine",
+		"editor.action.indentLines",
+		"editor.action.insertCursorAtEndOfEachLineSelected",
+		"editor.action.marker.nextInFiles",
+		"editor.action.marker.prevInFiles",
+		"editor.action.nextMatchFindAction",
+		"editor.action.organizeImports",
+		"editor.action.outdentLines",
+		"editor.action.previousMatchFindAction",
+		"editor.action.selectAll",
+		"editor.action.selectHighlights",
+		"editor.action.toggleTabFocusMode",
+		"hideSuggestWidget",
+		"jumpToNextSnippetPlaceholder",
+		"selectNextSuggestion",
+		"selectPrevSuggestion",
+		"toggleFindCaseSensitive",
+		"toggleFindRegex",
+		"toggleFindWholeWord",
+		"togglePreserveCase",
+	)
+	add("1.33.0", "editor.action.revealDefinition")
+
+	// Search
+	add("",
+		"search.action.focusSearchList",
+		"search.action.remove",
+		"toggleSearchCaseSensitive",
+		"toggleSearchRegex",
+		"toggleSearchWholeWord",
+		"workbench.action.findInFiles",
+		"workbench.action.replaceInFiles",
+	)
+	add("1.43.0",
+		"toggleSearchEditorCaseSensitive",
+		"toggleSearchEditorRegex",
+		"toggleSearchEditorWholeWord",
+	)
+
+	// Workbench
+	add("",
+		"git.revertSelectedRanges",
+		"list.focusDown",
+		"list.focusUp",
+		"markdown.showPreviewToSide",
+		"revealFileInOS",
+		"workbench.action.acceptSelectedQuickOpenItem",
+		"workbench.action.closeEditorsAndGroup",
+		"workbench.action.closePanel",
+		"workbench.action.closeQuickOpen",
+		"workbench.action.closeWindow",
+		"workbench.action.editor.nextChange",
+		"workbench.action.editor.previousChange",
+		"workbench.action.files.newUntitledFile",
+		"workbench.action.files.save",
+		"workbench.action.focusActiveEditorGroup",
+		"workbench.action.gotoLine",
+		"workbench.action.nextPanelView",
+		"workbench.action.openGlobalKeybindings",
+		"workbench.action.openGlobalKeybindingsFile",
+		"workbench.action.openPreviousEditorFromHistory",
+		"workbench.action.openRecent",
+		"workbench.action.openSettings",
+		"workbench.action.previousPanelView",
+		"workbench.action.quickOpen",
+		"workbench.action.quickOpenNavigateNextInFilePicker",
+		"workbench.action.quickOpenNavigatePreviousInFilePicker",
+		"workbench.action.reloadWindow",
+		"workbench.action.showCommands",
+		"workbench.action.splitEditorDown",
+		"workbench.action.splitEditorRight",
+		"workbench.action.togglePanel",
+		"workbench.action.toggleSidebarVisibility",
+		"workbench.extensions.action.checkForUpdates",
+		"workbench.view.extensions",
+		// Each output channel has its own command
+		// (workbench.action.output.show.<channel ID>).
+		"workbench.action.output.show.",
+	)
+	add("1.27.0", "workbench.action.openSettingsJson")
+
+	// Terminal
+	add("",
+		"workbench.action.terminal.focus",
+		"workbench.action.terminal.focusFind",
+		"workbench.action.terminal.focusNext",
+		"workbench.action.terminal.focusPrevious",
+		"workbench.action.terminal.kill",
+		"workbench.action.terminal.newInActiveWorkspace",
+		"workbench.action.terminal.rename",
+	)
+	// The terminal's view (and so its focus command) was added when views
+	// could be moved between containers.
+	add("1.46.0", "terminal.focus")
+	add("1.57.0", "workbench.action.terminal.newWithProfile")
+	add("1.74.0", "workbench.action.terminal.copyLastCommandOutput")
+
+	// Not an actual command, but binding to it makes the key do nothing.
+	add("", "noop")
+
+	return append(catalog,
+		&KnownCommand{
+			ID:   sendSequenceCommand,
+			Args: map[string]ArgType{"text": argString},
+		},
+		&KnownCommand{
+			ID:        "go.test.package",
+			Extension: "golang.go",
+			Args:      map[string]ArgType{"background": argBoolean},
+		},
+	)
+}
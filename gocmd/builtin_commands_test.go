@@ -0,0 +1,190 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLookupCommand(t *testing.T) {
+	catalog := []*KnownCommand{
+		{ID: "workbench.action.output.show."},
+		{ID: "workbench.action.output.show.special"},
+		{ID: "noop"},
+	}
+	for _, test := range []struct {
+		command string
+		want    string
+	}{
+		{command: "noop", want: "noop"},
+		{command: "noop.other"},
+		{command: "workbench.action.output.show.extension-output-golang.go-#2-Go Tests", want: "workbench.action.output.show."},
+		{command: "workbench.action.output.show.special", want: "workbench.action.output.show.special"},
+		{command: "workbench.action.output.show"},
+	} {
+		t.Run(test.command, func(t *testing.T) {
+			var got string
+			if kc := lookupCommand(catalog, test.command); kc != nil {
+				got = kc.ID
+			}
+			if got != test.want {
+				t.Errorf("lookupCommand(%q) returned %q; want %q", test.command, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckCommands(t *testing.T) {
+	er := &ExtensionRegistry{
+		Extensions: map[string]string{"faves.": "groogle.faves"},
+		Commands: []*KnownCommand{
+			{ID: "editor.action.selectAll"},
+			{ID: "workbench.action.terminal.newWithProfile", Since: "1.57.0"},
+			{ID: "workbench.action.terminal.sendSequence", Args: map[string]ArgType{"text": argString}},
+			{ID: "go.test.package", Extension: "golang.go", Args: map[string]ArgType{"background": argBoolean}},
+		},
+	}
+	for _, test := range []struct {
+		name   string
+		engine string
+		kbs    []*Keybinding
+		want   []string
+	}{
+		{
+			name: "known commands",
+			kbs: []*Keybinding{
+				{Key: "ctrl+a", Command: "editor.action.selectAll"},
+				{Key: "ctrl+b", Command: "groog.cursorHome"},
+				{Key: "ctrl+c", Command: "faves.toggle"},
+				{Key: "ctrl+d", Command: "-editor.action.selectAll"},
+				mcKeybinding("ctrl+e", mcWithArgs(sendSequence("hello"), goTestPackage(true))),
+			},
+		},
+		{
+			name: "unknown commands",
+			kbs: []*Keybinding{
+				{Key: "ctrl+a", Command: "editor.action.selectAl"},
+				{Key: "ctrl+b", Command: "editor.action.selectAl"},
+				{Key: "ctrl+c", Command: "-editor.action.unselectAll"},
+				mcKeybinding("ctrl+d", mc("workbench.action.files.sav")),
+			},
+			want: []string{
+				`warning: command "editor.action.selectAl" (bound to ctrl+a) is not a known command or provided by a registered extension`,
+				`warning: command "editor.action.unselectAll" (bound to ctrl+c) is not a known command or provided by a registered extension`,
+				`warning: command "workbench.action.files.sav" (bound to ctrl+d) is not a known command or provided by a registered extension`,
+			},
+		},
+		{
+			name:   "newer than engine",
+			engine: "^1.50.0",
+			kbs: []*Keybinding{
+				{Key: "ctrl+a", Command: "workbench.action.terminal.newWithProfile"},
+				{Key: "ctrl+b", Command: "workbench.action.terminal.newWithProfile"},
+			},
+			want: []string{
+				`warning: command "workbench.action.terminal.newWithProfile" (bound to ctrl+a) requires VS Code 1.57.0, but engines.vscode is ^1.50.0`,
+			},
+		},
+		{
+			name: "invalid args",
+			kbs: []*Keybinding{
+				{Key: "ctrl+a", Command: "editor.action.selectAll", Args: map[string]interface{}{"all": true}},
+				{Key: "ctrl+b", Command: "workbench.action.terminal.sendSequence", Args: map[string]interface{}{"text": 1}},
+				mcKeybinding("ctrl+c", mcWithArgs(kbArgs("go.test.package", map[string]interface{}{"background": "yes", "verbose": true}))),
+			},
+			want: []string{
+				`command "editor.action.selectAll" does not accept arg "all"`,
+				`command "workbench.action.terminal.sendSequence" arg "text" must be a string (got number)`,
+				`command "go.test.package" arg "background" must be a boolean (got string)`,
+				`command "go.test.package" does not accept arg "verbose"`,
+			},
+		},
+		{
+			name: "own command args",
+			kbs: []*Keybinding{
+				{Key: "a", Command: "groog.type", Args: argsMap(TypeArgs{Text: "a"})},
+				{Key: "b", Command: "groog.type", Args: map[string]interface{}{"txt": "b"}},
+				{Key: "ctrl+a", Command: "groog.cursorHome", Args: map[string]interface{}{"select": true}},
+				{Key: "ctrl+b", Command: "groog.undeclared", Args: map[string]interface{}{"anything": true}},
+			},
+			want: []string{
+				`command "groog.type" requires arg "text"`,
+				`command "groog.type" does not accept arg "txt"`,
+				`command "groog.cursorHome" does not accept args (got select)`,
+			},
+		},
+		{
+			name: "removed bindings args aren't checked",
+			kbs: []*Keybinding{
+				{Key: "ctrl+a", Command: "-editor.action.selectAll", Args: map[string]interface{}{"all": true}},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			engine := test.engine
+			if engine == "" {
+				engine = "^1.81.0"
+			}
+			p := &Package{
+				Name:    "groog",
+				Engines: map[string]string{"vscode": engine},
+				Contributes: &Contribution{
+					Commands: []*Command{
+						cc("groog.cursorHome", "Home"),
+						ccArgs("groog.type", "Type", TypeArgs{}),
+					},
+				},
+			}
+			ds := &Diagnostics{}
+			checkCommands(ds, er, p, test.kbs)
+			var got []string
+			for _, d := range ds.All() {
+				msg := d.Message
+				if d.Severity == severityWarning {
+					msg = "warning: " + msg
+				}
+				got = append(got, msg)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("checkCommands() recorded incorrect diagnostics (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCheckCommandsReportsDefinition(t *testing.T) {
+	er := &ExtensionRegistry{
+		Commands: []*KnownCommand{
+			{ID: "editor.action.selectAll"},
+			{ID: "workbench.action.terminal.newWithProfile", Since: "1.57.0"},
+		},
+	}
+	p := &Package{
+		Name:    "groog",
+		Engines: map[string]string{"vscode": "^1.50.0"},
+		Contributes: &Contribution{
+			Commands: []*Command{cc("groog.cursorHome", "Home")},
+		},
+	}
+	kbs := []*Keybinding{
+		{Key: "ctrl+a", Command: "editor.action.selectAl", Location: Location{"keybindings.go", 10}},
+		{Key: "ctrl+b", Command: "editor.action.selectAll", Args: map[string]interface{}{"all": true}, Location: Location{"keybindings.go", 20}},
+		{Key: "ctrl+c", Command: "workbench.action.terminal.newWithProfile", Location: Location{"keybindings.go", 30}},
+		{Key: "ctrl+d", Command: "groog.cursorHome", Args: map[string]interface{}{"select": true}, Location: Location{"keybindings.go", 40}},
+	}
+	ds := &Diagnostics{}
+	checkCommands(ds, er, p, kbs)
+	want := []string{
+		`keybindings.go:10: warning: command "editor.action.selectAl" (bound to ctrl+a) is not a known command or provided by a registered extension`,
+		`keybindings.go:20: command "editor.action.selectAll" does not accept arg "all"`,
+		`keybindings.go:30: warning: command "workbench.action.terminal.newWithProfile" (bound to ctrl+c) requires VS Code 1.57.0, but engines.vscode is ^1.50.0`,
+		`keybindings.go:40: command "groog.cursorHome" does not accept args (got select)`,
+	}
+	var got []string
+	for _, d := range ds.All() {
+		got = append(got, d.String())
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("checkCommands() recorded incorrect diagnostics (-want, +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/leep-frog/command/command"
+)
+
+// The changelog section for a new version is generated from the commits since
+// the last version tag. Commits are grouped by their conventional commit
+// prefix (https://www.conventionalcommits.org). The section is added directly
+// below the `## [Unreleased]` section (whose entries are moved into it) and
+// links to the new version's tag, which must not exist yet.
+
+var (
+	conventionalCommitRegex = regexp.MustCompile(`^([a-zA-Z]+)(?:\(([^)]*)\))?(!)?:\s*(.+)$`)
+	versionHeadingRegex     = regexp.MustCompile(`(?m)^## \[v?[0-9]+\.[0-9]+\.[0-9]+[^\]]*\]`)
+	unreleasedHeadingRegex  = regexp.MustCompile(`(?m)^## \[Unreleased\].*$`)
+	sectionHeadingRegex     = regexp.MustCompile(`(?m)^## `)
+
+	// changelogGroups is the ordered list of changelog groups and the
+	// conventional commit types that belong in each one.
+	changelogGroups = []*changelogGroup{
+		{"Breaking Changes", nil},
+		{"Features", []string{"feat", "feature"}},
+		{"Bug Fixes", []string{"fix"}},
+		{"Performance", []string{"perf"}},
+		{"Refactoring", []string{"refactor"}},
+		{"Documentation", []string{"docs"}},
+		{"Tests", []string{"test", "tests"}},
+		{"Build", []string{"build", "ci"}},
+		{"Chores", []string{"chore", "style", "revert"}},
+		{"Other", nil},
+	}
+)
+
+type changelogGroup struct {
+	title string
+	types []string
+}
+
+type Commit struct {
+	Hash    string
+	Subject string
+}
+
+// gitRunner runs git with the provided arguments and returns its stdout.
+type gitRunner func(args ...string) (string, error)
+
+func localGit(dir string) gitRunner {
+	return func(args ...string) (string, error) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		b, err := cmd.Output()
+		if err != nil {
+			if ee, ok := err.(*exec.ExitError); ok {
+				return "", fmt.Errorf("git %s failed: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(ee.Stderr)))
+			}
+			return "", fmt.Errorf("git %s failed: %v", strings.Join(args, " "), err)
+		}
+		return string(b), nil
+	}
+}
+
+// lastVersionTag returns the most recent version tag reachable from HEAD (or
+// an empty string if there is no such tag).
+func lastVersionTag(git gitRunner) string {
+	for _, pattern := range []string{"v[0-9]*", "[0-9]*"} {
+		tag, err := git("describe", "--tags", "--abbrev=0", "--match", pattern)
+		if err == nil && strings.TrimSpace(tag) != "" {
+			return strings.TrimSpace(tag)
+		}
+	}
+	return ""
+}
+
+// versionTag returns the tag for the version. It has the same prefix as the
+// last version tag ("v" if there isn't one).
+func versionTag(lastTag, version string) string {
+	if lastTag != "" && !strings.HasPrefix(lastTag, "v") {
+		return version
+	}
+	return "v" + version
+}
+
+// tagExists returns whether the tag exists.
+func tagExists(git gitRunner, tag string) bool {
+	_, err := git("rev-parse", "--quiet", "--verify", "refs/tags/"+tag)
+	return err == nil
+}
+
+// untaggedVersion returns the last version tag and the tag for the new
+// version, which must not exist yet (otherwise the version was already
+// released).
+func untaggedVersion(git gitRunner, version string) (string, string, error) {
+	lastTag := lastVersionTag(git)
+	tag := versionTag(lastTag, version)
+	if tagExists(git, tag) {
+		return "", "", fmt.Errorf("tag %s already exists, so version %s has already been released", tag, version)
+	}
+	return lastTag, tag, nil
+}
+
+// changelogLink returns the link definition for a version's heading. It links
+// to the changes between the last tag and the version's tag (or just the
+// version's tag if there's no last tag).
+func changelogLink(repoURL, version, lastTag, tag string) string {
+	repoURL = strings.TrimSuffix(strings.TrimSuffix(repoURL, "/"), ".git")
+	if lastTag == "" {
+		return fmt.Sprintf("[%s]: %s/releases/tag/%s", version, repoURL, tag)
+	}
+	return fmt.Sprintf("[%s]: %s/compare/%s...%s", version, repoURL, lastTag, tag)
+}
+
+// commitsSince returns the commits since the provided ref (or all commits if
+// the ref is empty), newest first.
+func commitsSince(git gitRunner, ref string) ([]*Commit, error) {
+	args := []string{"log", "--no-merges", "--format=%h%x1f%s"}
+	if ref != "" {
+		args = append(args, fmt.Sprintf("%s..HEAD", ref))
+	}
+	out, err := git(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []*Commit
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "\x1f", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("unexpected git log output: %q", line)
+		}
+		commits = append(commits, &Commit{parts[0], parts[1]})
+	}
+	return commits, nil
+}
+
+// changelogSection returns the changelog section for the provided version.
+// The unreleased entries (moved from the Unreleased section) come before the
+// entries generated from the commits, and the link (if any) is the heading's
+// link definition (see changelogLink).
+func changelogSection(version, link string, date time.Time, unreleased string, commits []*Commit) string {
+	entries := map[string][]string{}
+	for _, c := range commits {
+		group, entry := changelogEntry(c)
+		entries[group] = append(entries[group], entry)
+	}
+
+	r := []string{fmt.Sprintf("## [%s] - %s", version, date.Format("2006-01-02"))}
+	if unreleased != "" {
+		r = append(r, "", unreleased)
+	} else if len(commits) == 0 {
+		r = append(r, "", "- No changes")
+	}
+	for _, g := range changelogGroups {
+		if len(entries[g.title]) == 0 {
+			continue
+		}
+		r = append(r, "", fmt.Sprintf("### %s", g.title), "")
+		r = append(r, entries[g.title]...)
+	}
+	if link != "" {
+		r = append(r, "", link)
+	}
+	return strings.Join(r, "\n") + "\n"
+}
+
+// changelogEntry returns the group and bullet point for the provided commit.
+func changelogEntry(c *Commit) (string, string) {
+	m := conventionalCommitRegex.FindStringSubmatch(c.Subject)
+	if len(m) == 0 {
+		return "Other", fmt.Sprintf("- %s (%s)", c.Subject, c.Hash)
+	}
+
+	commitType, scope, breaking, description := strings.ToLower(m[1]), m[2], m[3] != "", m[4]
+	entry := description
+	if scope != "" {
+		entry = fmt.Sprintf("**%s:** %s", scope, description)
+	}
+	entry = fmt.Sprintf("- %s (%s)", entry, c.Hash)
+
+	if breaking {
+		return "Breaking Changes", entry
+	}
+	for _, g := range changelogGroups {
+		for _, t := range g.types {
+			if t == commitType {
+				return g.title, entry
+			}
+		}
+	}
+	return "Other", entry
+}
+
+// unreleasedSection returns the start and end of the entries in the
+// changelog's Unreleased section (i.e. everything between its heading and the
+// next section).
+func unreleasedSection(changelog string) (int, int, bool) {
+	loc := unreleasedHeadingRegex.FindStringIndex(changelog)
+	if loc == nil {
+		return 0, 0, false
+	}
+	end := len(changelog)
+	if next := sectionHeadingRegex.FindStringIndex(changelog[loc[1]:]); next != nil {
+		end = loc[1] + next[0]
+	}
+	return loc[1], end, true
+}
+
+// unreleasedEntries returns the entries in the changelog's Unreleased section.
+func unreleasedEntries(changelog string) string {
+	start, end, ok := unreleasedSection(changelog)
+	if !ok {
+		return ""
+	}
+	return strings.Trim(changelog[start:end], "\n")
+}
+
+// prependChangelogSection adds the section directly below the Unreleased
+// section (replacing its entries, which changelogSection moves into the new
+// section). Without an Unreleased section, it's added above the most recent
+// version section (or at the end if there are no version sections).
+func prependChangelogSection(changelog, section string) string {
+	if start, end, ok := unreleasedSection(changelog); ok {
+		r := changelog[:start] + "\n\n" + section
+		if end < len(changelog) {
+			r += "\n" + changelog[end:]
+		}
+		return r
+	}
+
+	loc := versionHeadingRegex.FindStringIndex(changelog)
+	if loc == nil {
+		return strings.TrimRight(changelog, "\n") + "\n\n" + section
+	}
+	return changelog[:loc[0]] + section + "\n" + changelog[loc[0]:]
+}
+
+// updateChangelog generates the changelog section for the new version from
+// the git history and adds it to CHANGELOG.md. If dryRun is set, the section
+// is only printed.
+func (c *cli) updateChangelog(o command.Output, d *command.Data, version string, dryRun bool) error {
+	root := filepath.Dir(filepath.Dir(runtimeNode.Get(d)))
+	git := localGit(root)
+
+	lastTag, tag, err := untaggedVersion(git, version)
+	if err != nil {
+		return o.Err(err)
+	}
+	commits, err := commitsSince(git, lastTag)
+	if err != nil {
+		return o.Annotatef(err, "failed to get commits")
+	}
+
+	changelogFile := filepath.Join(root, "CHANGELOG.md")
+	b, err := os.ReadFile(changelogFile)
+	if err != nil {
+		return o.Annotatef(err, "failed to read CHANGELOG.md")
+	}
+	changelog := string(b)
+
+	var link string
+	if repo := groogBase().Repository; repo != nil && repo.URL != "" {
+		link = changelogLink(repo.URL, version, lastTag, tag)
+	}
+	section := changelogSection(version, link, time.Now(), unreleasedEntries(changelog), commits)
+
+	if dryRun {
+		o.Stdout(section)
+		return nil
+	}
+
+	if err := os.WriteFile(changelogFile, []byte(prependChangelogSection(changelog, section)), 0644); err != nil {
+		return o.Annotatef(err, "failed to write CHANGELOG.md")
+	}
+	o.Stdoutln("Successfully updated CHANGELOG.md")
+	o.Stdoutf("Tag the release commit with `git tag %s`\n", tag)
+	return nil
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeGit returns a gitRunner that returns the configured output for each
+// command (keyed by the space-separated arguments) and records all calls.
+func fakeGit(outputs map[string]string, calls *[]string) gitRunner {
+	return func(args ...string) (string, error) {
+		cmd := strings.Join(args, " ")
+		*calls = append(*calls, cmd)
+		out, ok := outputs[cmd]
+		if !ok {
+			return "", fmt.Errorf("unexpected git command: %s", cmd)
+		}
+		return out, nil
+	}
+}
+
+func TestLastVersionTag(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		outputs map[string]string
+		want    string
+	}{
+		{
+			name: "v-prefixed tag",
+			outputs: map[string]string{
+				"describe --tags --abbrev=0 --match v[0-9]*": "v2.6.3\n",
+			},
+			want: "v2.6.3",
+		},
+		{
+			name: "unprefixed tag",
+			outputs: map[string]string{
+				"describe --tags --abbrev=0 --match [0-9]*": "2.6.3\n",
+			},
+			want: "2.6.3",
+		},
+		{
+			name: "no tags",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var calls []string
+			if diff := cmp.Diff(test.want, lastVersionTag(fakeGit(test.outputs, &calls))); diff != "" {
+				t.Errorf("lastVersionTag() returned incorrect value (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCommitsSince(t *testing.T) {
+	var calls []string
+	git := fakeGit(map[string]string{
+		"log --no-merges --format=%h%x1f%s v2.6.3..HEAD": "abc123\x1ffeat: add thing\ndef456\x1ffix(find): a: b\n\n",
+	}, &calls)
+
+	got, err := commitsSince(git, "v2.6.3")
+	if err != nil {
+		t.Fatalf("commitsSince() returned error: %v", err)
+	}
+	want := []*Commit{
+		{"abc123", "feat: add thing"},
+		{"def456", "fix(find): a: b"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("commitsSince() returned incorrect value (-want, +got):\n%s", diff)
+	}
+
+	// No ref should get the entire history
+	calls = nil
+	git = fakeGit(map[string]string{
+		"log --no-merges --format=%h%x1f%s": "",
+	}, &calls)
+	got, err = commitsSince(git, "")
+	if err != nil {
+		t.Fatalf("commitsSince() returned error: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("commitsSince() returned %v; want no commits", got)
+	}
+}
+
+func TestChangelogSection(t *testing.T) {
+	date := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		name       string
+		link       string
+		unreleased string
+		commits    []*Commit
+		want       string
+	}{
+		{
+			name: "no commits",
+			want: "## [2.6.4] - 2026-10-18\n\n- No changes\n",
+		},
+		{
+			name:       "unreleased entries and link",
+			link:       "[2.6.4]: https://github.com/leep-frog/vs-extension/compare/v2.6.3...v2.6.4",
+			unreleased: "- Hand-written note\n- Another one",
+			commits: []*Commit{
+				{"a1", "feat: add release command"},
+			},
+			want: strings.Join([]string{
+				"## [2.6.4] - 2026-10-18",
+				"",
+				"- Hand-written note",
+				"- Another one",
+				"",
+				"### Features",
+				"",
+				"- add release command (a1)",
+				"",
+				"[2.6.4]: https://github.com/leep-frog/vs-extension/compare/v2.6.3...v2.6.4",
+				"",
+			}, "\n"),
+		},
+		{
+			name: "grouped commits",
+			commits: []*Commit{
+				{"a1", "feat: add release command"},
+				{"b2", "fix(find): handle empty input"},
+				{"c3", "Update README"},
+				{"d4", "feat(terminal)!: change shell profile format"},
+				{"e5", "chore: bump deps"},
+				{"f6", "feat: add diff command"},
+				{"g7", "docs: fix typo"},
+				{"h8", "wip: something"},
+			},
+			want: strings.Join([]string{
+				"## [2.6.4] - 2026-10-18",
+				"",
+				"### Breaking Changes",
+				"",
+				"- **terminal:** change shell profile format (d4)",
+				"",
+				"### Features",
+				"",
+				"- add release command (a1)",
+				"- add diff command (f6)",
+				"",
+				"### Bug Fixes",
+				"",
+				"- **find:** handle empty input (b2)",
+				"",
+				"### Documentation",
+				"",
+				"- fix typo (g7)",
+				"",
+				"### Chores",
+				"",
+				"- bump deps (e5)",
+				"",
+				"### Other",
+				"",
+				"- Update README (c3)",
+				"- something (h8)",
+				"",
+			}, "\n"),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := cmp.Diff(test.want, changelogSection("2.6.4", test.link, date, test.unreleased, test.commits)); diff != "" {
+				t.Errorf("changelogSection() returned incorrect value (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPrependChangelogSection(t *testing.T) {
+	section := "## [2.6.4] - 2026-10-18\n\n- No changes\n"
+	for _, test := range []struct {
+		name      string
+		changelog string
+		want      string
+	}{
+		{
+			name:      "unreleased entries are replaced",
+			changelog: "# Change Log\n\n## [Unreleased]\n\n- Initial release\n",
+			want:      "# Change Log\n\n## [Unreleased]\n\n## [2.6.4] - 2026-10-18\n\n- No changes\n",
+		},
+		{
+			name:      "below unreleased",
+			changelog: "# Change Log\n\n## [Unreleased]\n\n- New\n\n## [2.6.3] - 2026-10-01\n\n- Stuff\n",
+			want:      "# Change Log\n\n## [Unreleased]\n\n## [2.6.4] - 2026-10-18\n\n- No changes\n\n## [2.6.3] - 2026-10-01\n\n- Stuff\n",
+		},
+		{
+			name:      "no unreleased section",
+			changelog: "# Change Log\n\n## [2.6.3] - 2026-10-01\n\n- Stuff\n",
+			want:      "# Change Log\n\n## [2.6.4] - 2026-10-18\n\n- No changes\n\n## [2.6.3] - 2026-10-01\n\n- Stuff\n",
+		},
+		{
+			name:      "no sections",
+			changelog: "# Change Log\n",
+			want:      "# Change Log\n\n## [2.6.4] - 2026-10-18\n\n- No changes\n",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := cmp.Diff(test.want, prependChangelogSection(test.changelog, section)); diff != "" {
+				t.Errorf("prependChangelogSection() returned incorrect value (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUnreleasedEntries(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		changelog string
+		want      string
+	}{
+		{
+			name:      "entries",
+			changelog: "# Change Log\n\n## [Unreleased]\n\n- One\n- Two\n\n## [2.6.3] - 2026-10-01\n\n- Stuff\n",
+			want:      "- One\n- Two",
+		},
+		{
+			name:      "last section",
+			changelog: "# Change Log\n\n## [Unreleased]\n\n- Initial release\n",
+			want:      "- Initial release",
+		},
+		{
+			name:      "empty",
+			changelog: "# Change Log\n\n## [Unreleased]\n\n## [2.6.3] - 2026-10-01\n",
+		},
+		{
+			name:      "no unreleased section",
+			changelog: "# Change Log\n\n## [2.6.3] - 2026-10-01\n\n- Stuff\n",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := cmp.Diff(test.want, unreleasedEntries(test.changelog)); diff != "" {
+				t.Errorf("unreleasedEntries() returned incorrect value (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUntaggedVersion(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		outputs     map[string]string
+		wantLastTag string
+		wantTag     string
+		wantErr     string
+	}{
+		{
+			name:    "no tags",
+			wantTag: "v2.6.4",
+		},
+		{
+			name: "v-prefixed tags",
+			outputs: map[string]string{
+				"describe --tags --abbrev=0 --match v[0-9]*": "v2.6.3\n",
+			},
+			wantLastTag: "v2.6.3",
+			wantTag:     "v2.6.4",
+		},
+		{
+			name: "unprefixed tags",
+			outputs: map[string]string{
+				"describe --tags --abbrev=0 --match [0-9]*": "2.6.3\n",
+			},
+			wantLastTag: "2.6.3",
+			wantTag:     "2.6.4",
+		},
+		{
+			name: "already tagged",
+			outputs: map[string]string{
+				"describe --tags --abbrev=0 --match v[0-9]*":  "v2.6.4\n",
+				"rev-parse --quiet --verify refs/tags/v2.6.4": "0123abc\n",
+			},
+			wantErr: "tag v2.6.4 already exists, so version 2.6.4 has already been released",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var calls []string
+			lastTag, tag, err := untaggedVersion(fakeGit(test.outputs, &calls), "2.6.4")
+			var gotErr string
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr); diff != "" {
+				t.Errorf("untaggedVersion() returned incorrect error (-want, +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(test.wantLastTag, lastTag); diff != "" {
+				t.Errorf("untaggedVersion() returned incorrect last tag (-want, +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(test.wantTag, tag); diff != "" {
+				t.Errorf("untaggedVersion() returned incorrect tag (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestChangelogLink(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		repoURL string
+		lastTag string
+		want    string
+	}{
+		{
+			name:    "first release",
+			repoURL: "https://github.com/leep-frog/vs-extension",
+			want:    "[2.6.4]: https://github.com/leep-frog/vs-extension/releases/tag/v2.6.4",
+		},
+		{
+			name:    "compare to last tag",
+			repoURL: "https://github.com/leep-frog/vs-extension.git",
+			lastTag: "v2.6.3",
+			want:    "[2.6.4]: https://github.com/leep-frog/vs-extension/compare/v2.6.3...v2.6.4",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := cmp.Diff(test.want, changelogLink(test.repoURL, "2.6.4", test.lastTag, "v2.6.4")); diff != "" {
+				t.Errorf("changelogLink() returned incorrect value (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Commands that take args declare a struct for them (see Command.Args). The
+// keybindings build their args from those structs, the generator validates
+// every binding's args against them, and the same structs are emitted as
+// TypeScript interfaces for the command handlers (see commandArgsTSFile).
+
+const (
+	commandArgsTSFile = "src/command-args.ts"
+)
+
+// TypeArgs are the args for groog.type.
+type TypeArgs struct {
+	Text string `json:"text"`
+}
+
+// MessageArgs are the args for groog.message.info.
+type MessageArgs struct {
+	Message string `json:"message"`
+	Error   bool   `json:"error,omitempty"`
+}
+
+// TestFileArgs are the args for groog.testFile.
+type TestFileArgs struct {
+	// Part is the part of the test sequence to run (0 clears the terminal
+	// input and 1 runs the test command).
+	Part int `json:"part"`
+}
+
+// MultiCommandArgs are the args for groog.multiCommand.execute.
+type MultiCommandArgs struct {
+	Sequence []*KB `json:"sequence"`
+}
+
+// tsTypeNames are the TypeScript interface names for structs whose Go names
+// don't read well in the handlers.
+var tsTypeNames = map[reflect.Type]string{
+	reflect.TypeOf(KB{}): "SingleCommand",
+}
+
+// argField is a json field of an args struct.
+type argField struct {
+	Name     string
+	Type     reflect.Type
+	Optional bool
+	index    int
+}
+
+// argFields returns the json fields of the args struct type.
+func argFields(t reflect.Type) []*argField {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var fields []*argField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, &argField{
+			Name:     name,
+			Type:     f.Type,
+			Optional: opts == "omitempty" || f.Type.Kind() == reflect.Pointer,
+			index:    i,
+		})
+	}
+	return fields
+}
+
+// argsMap returns the args (as set in KB.Args) for the args struct. The
+// field values are kept as is (rather than round-tripped through json) so
+// nested keybindings keep their field order in package.json.
+func argsMap(args interface{}) map[string]interface{} {
+	v := reflect.ValueOf(args)
+	for v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	m := map[string]interface{}{}
+	for _, f := range argFields(v.Type()) {
+		fv := v.Field(f.index)
+		if f.Optional && fv.IsZero() {
+			continue
+		}
+		m[f.Name] = fv.Interface()
+	}
+	return m
+}
+
+// reflectArgType returns the JSON type of values of the Go type.
+func reflectArgType(t reflect.Type) ArgType {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return argString
+	case reflect.Bool:
+		return argBoolean
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return argNumber
+	case reflect.Struct, reflect.Map:
+		return argObject
+	case reflect.Slice, reflect.Array:
+		return argArray
+	}
+	return ArgType(t.String())
+}
+
+// checkStructArgs verifies that the args match the command's args struct (or
+// that there are no args if the command doesn't declare a struct). Problems
+// are reported at loc.
+func checkStructArgs(ds *Diagnostics, loc Location, command string, argsType interface{}, args map[string]interface{}) {
+	if argsType == nil {
+		if len(args) > 0 {
+			ds.ErrorAt(loc, "command %q does not accept args (got %s)", command, strings.Join(sortedKeys(args), ", "))
+		}
+		return
+	}
+
+	fields := map[string]*argField{}
+	for _, f := range argFields(reflect.TypeOf(argsType)) {
+		fields[f.Name] = f
+		if _, ok := args[f.Name]; !ok && !f.Optional {
+			ds.ErrorAt(loc, "command %q requires arg %q", command, f.Name)
+		}
+	}
+	for _, name := range sortedKeys(args) {
+		f, ok := fields[name]
+		if !ok {
+			ds.ErrorAt(loc, "command %q does not accept arg %q", command, name)
+			continue
+		}
+		if want, got := reflectArgType(f.Type), jsonArgType(args[name]); got != want {
+			ds.ErrorAt(loc, "command %q arg %q must be a %s (got %s)", command, name, want, got)
+		}
+	}
+}
+
+// tsType returns the TypeScript type for the Go type, and adds any structs
+// it references to structs.
+func tsType(t reflect.Type, structs *[]reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		return tsType(t.Elem(), structs) + "[]"
+	case reflect.Map:
+		return fmt.Sprintf("{ [key: string]: %s }", tsType(t.Elem(), structs))
+	case reflect.Interface:
+		return "any"
+	case reflect.Struct:
+		found := false
+		for _, s := range *structs {
+			found = found || s == t
+		}
+		if !found {
+			*structs = append(*structs, t)
+		}
+		return tsTypeName(t)
+	}
+	return string(reflectArgType(t))
+}
+
+func tsTypeName(t reflect.Type) string {
+	if name, ok := tsTypeNames[t]; ok {
+		return name
+	}
+	return t.Name()
+}
+
+// tsInterfaces returns the TypeScript interfaces for the args structs of the
+// commands (and any structs they reference).
+func tsInterfaces(commands []*Command) string {
+	var structs []reflect.Type
+	for _, c := range commands {
+		if c.Args != nil {
+			tsType(reflect.TypeOf(c.Args), &structs)
+		}
+	}
+
+	r := []string{
+		"// Code generated by vs-package. DO NOT EDIT.",
+	}
+	// structs grows as nested structs are found.
+	for i := 0; i < len(structs); i++ {
+		t := structs[i]
+		r = append(r, "", fmt.Sprintf("export interface %s {", tsTypeName(t)))
+		for _, f := range argFields(t) {
+			optional := ""
+			if f.Optional {
+				optional = "?"
+			}
+			r = append(r, fmt.Sprintf("  %s%s: %s;", f.Name, optional, tsType(f.Type, &structs)))
+		}
+		r = append(r, "}")
+	}
+	return strings.Join(r, "\n") + "\n"
+}
+
+// groogType types the text (so it's recorded).
+func groogType(text string) *KB {
+	return kbArgs("groog.type", argsMap(TypeArgs{Text: text}))
+}
+
+// testFile runs the part of the test sequence for the previously visited file.
+func testFile(part int) *KB {
+	return kbArgs("groog.testFile", argsMap(TestFileArgs{Part: part}))
+}
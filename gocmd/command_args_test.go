@@ -0,0 +1,160 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestArgsMap(t *testing.T) {
+	seq := []*KB{kb("groog.a")}
+	for _, test := range []struct {
+		name string
+		args interface{}
+		want map[string]interface{}
+	}{
+		{
+			name: "required fields",
+			args: TestFileArgs{},
+			want: map[string]interface{}{"part": 0},
+		},
+		{
+			name: "omitted fields",
+			args: MessageArgs{Message: "hello"},
+			want: map[string]interface{}{"message": "hello"},
+		},
+		{
+			name: "set optional fields",
+			args: &MessageArgs{Message: "uh oh", Error: true},
+			want: map[string]interface{}{"message": "uh oh", "error": true},
+		},
+		{
+			name: "nested keybindings",
+			args: MultiCommandArgs{Sequence: seq},
+			want: map[string]interface{}{"sequence": seq},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := cmp.Diff(test.want, argsMap(test.args)); diff != "" {
+				t.Errorf("argsMap(%v) returned incorrect value (-want, +got):\n%s", test.args, diff)
+			}
+		})
+	}
+}
+
+func TestCheckStructArgs(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		argsType interface{}
+		args     map[string]interface{}
+		want     []string
+	}{
+		{
+			name: "no args",
+		},
+		{
+			name: "unexpected args",
+			args: map[string]interface{}{"text": "a", "b": 1},
+			want: []string{`command "groog.cmd" does not accept args (got b, text)`},
+		},
+		{
+			name:     "valid args",
+			argsType: MessageArgs{},
+			args:     argsMap(MessageArgs{Message: "hi", Error: true}),
+		},
+		{
+			name:     "valid nested args",
+			argsType: MultiCommandArgs{},
+			args:     argsMap(MultiCommandArgs{Sequence: []*KB{kb("groog.a")}}),
+		},
+		{
+			name:     "typo in arg name",
+			argsType: TypeArgs{},
+			args:     map[string]interface{}{"txt": "a"},
+			want: []string{
+				`command "groog.cmd" requires arg "text"`,
+				`command "groog.cmd" does not accept arg "txt"`,
+			},
+		},
+		{
+			name:     "wrong arg types",
+			argsType: MessageArgs{},
+			args:     map[string]interface{}{"message": Key("a"), "error": "true"},
+			want: []string{
+				`command "groog.cmd" arg "error" must be a boolean (got string)`,
+			},
+		},
+		{
+			name:     "number args",
+			argsType: TestFileArgs{},
+			args:     map[string]interface{}{"part": "1"},
+			want: []string{
+				`command "groog.cmd" arg "part" must be a number (got string)`,
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ds := &Diagnostics{}
+			checkStructArgs(ds, Location{}, "groog.cmd", test.argsType, test.args)
+			var got []string
+			for _, d := range ds.All() {
+				got = append(got, d.Message)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("checkStructArgs() recorded incorrect diagnostics (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+type testNestedArgs struct {
+	Name  string            `json:"name"`
+	Tags  []string          `json:"tags,omitempty"`
+	Extra map[string]string `json:"extra"`
+	Count *int              `json:"count"`
+	Inner *testInnerArgs    `json:"inner"`
+	More  []*testInnerArgs  `json:"more"`
+	skip  bool
+	Also  bool `json:"-"`
+}
+
+type testInnerArgs struct {
+	Value float64
+}
+
+func TestTSInterfaces(t *testing.T) {
+	commands := []*Command{
+		cc("groog.none", "None"),
+		ccArgs("groog.nested", "Nested", testNestedArgs{}),
+		ccArgs("groog.inner", "Inner", testInnerArgs{}),
+	}
+	want := `// Code generated by vs-package. DO NOT EDIT.
+
+export interface testNestedArgs {
+  name: string;
+  tags?: string[];
+  extra: { [key: string]: string };
+  count?: number;
+  inner?: testInnerArgs;
+  more: testInnerArgs[];
+}
+
+export interface testInnerArgs {
+  Value: number;
+}
+`
+	if diff := cmp.Diff(want, tsInterfaces(commands)); diff != "" {
+		t.Errorf("tsInterfaces() returned incorrect value (-want, +got):\n%s", diff)
+	}
+}
+
+func TestCommandArgsTSFile(t *testing.T) {
+	b, err := os.ReadFile("../" + commandArgsTSFile)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", commandArgsTSFile, err)
+	}
+	if diff := cmp.Diff(tsInterfaces(groogCommands()), string(b)); diff != "" {
+		t.Errorf("%s is out of date (run `vs-package`) (-want, +got):\n%s", commandArgsTSFile, diff)
+	}
+}
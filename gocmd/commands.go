@@ -7,6 +7,16 @@ import (
 type Command struct {
 	Command string `json:"command"`
 	Title   string `json:"title"`
+	// Args is the zero value of the command's args struct (see
+	// command_args.go), or nil if the command doesn't take args.
+	Args interface{} `json:"-"`
+	// Enters, Exits, and Toggles are the groog modes (see modes.go) that the
+	// command sets, clears, and toggles.
+	Enters  []string `json:"-"`
+	Exits   []string `json:"-"`
+	Toggles []string `json:"-"`
+	// Location is where the command is defined.
+	Location Location `json:"-"`
 }
 
 func (cc *Command) activationEvent() string {
@@ -14,11 +24,33 @@ func (cc *Command) activationEvent() string {
 }
 
 func cc(command string, title string) *Command {
-	return &Command{command, title}
+	return ccArgs(command, title, nil)
 }
 
-var (
-	CustomCommands = []*Command{
+func ccArgs(command string, title string, args interface{}) *Command {
+	return &Command{Command: command, Title: title, Args: args, Location: dslLocation()}
+}
+
+// enters declares that the command sets the modes.
+func enters(c *Command, modes ...string) *Command {
+	c.Enters = append(c.Enters, modes...)
+	return c
+}
+
+// exits declares that the command clears the modes.
+func exits(c *Command, modes ...string) *Command {
+	c.Exits = append(c.Exits, modes...)
+	return c
+}
+
+// toggles declares that the command toggles the modes.
+func toggles(c *Command, modes ...string) *Command {
+	c.Toggles = append(c.Toggles, modes...)
+	return c
+}
+
+func groogCommands() []*Command {
+	return []*Command{
 		cc("groog.cursorBottom", "Emacs Cursor Bottom"),
 		cc("groog.cursorDown", "Emacs Cursor Down"),
 		cc("groog.cursorEnd", "Emacs Cursor End"),
@@ -29,7 +61,8 @@ var (
 		cc("groog.cursorUp", "Emacs Cursor Up"),
 		cc("groog.cursorWordRight", "Emacs Cursor Word Right"),
 		cc("groog.cursorWordLeft", "Emacs Cursor Word Left"),
-		cc("groog.ctrlG", "Emacs Ctrl-G"),
+		// Each active handler decides whether ctrl+g deactivates it (see src/handler.ts).
+		exits(cc("groog.ctrlG", "Emacs Ctrl-G"), "find", "mark", "terminal.find"),
 		cc("groog.deleteLeft", "Groog delete left"),
 		// TODO double check this doesn't work (same for deleteRight and other delete commands)
 		/*{
@@ -49,8 +82,9 @@ var (
 		cc("groog.focusNextEditor", "Focus next editor"),
 		cc("groog.focusPreviousEditor", "Focus next editor"),
 		cc("groog.fall", "Emacs Fall"),
-		cc("groog.find", "Groog find"),
+		enters(cc("groog.find", "Groog find"), "find"),
 		cc("groog.find.toggleReplaceMode", "Groog toggle between find and replace input boxes"),
+		toggles(cc("groog.find.toggleSimpleMode", "Groog toggle simple find mode"), "find.simple"),
 		cc("groog.find.toggleRegex", "Groog toggle regex"),
 		cc("groog.find.toggleCase", "Groog toggle case"),
 		cc("groog.find.toggleWholeWord", "Groog toggle whole word"),
@@ -64,25 +98,26 @@ var (
 		cc("groog.jump", "Emacs Jump"),
 		cc("groog.kill", "Emacs Kill Line"),
 		cc("groog.maim", "Emacs Kill Line (copy only)"),
-		cc("groog.message.info", "Groog Info Message"),
-		cc("groog.multiCommand.execute", "Groog MultiCommand"),
+		ccArgs("groog.message.info", "Groog Info Message", MessageArgs{}),
+		ccArgs("groog.multiCommand.execute", "Groog MultiCommand", MultiCommandArgs{}),
 		cc("groog.emacsPaste", "Emacs Paste"),
 		cc("groog.paste", "Groog Paste"),
-		cc("groog.record.endRecording", "Groog End Recording"),
+		exits(cc("groog.record.endRecording", "Groog End Recording"), "record"),
 		cc("groog.record.playNamedRecording", "Groog Play Named Recording..."),
 		cc("groog.record.playRecording", "Groog Play Recording"),
 		cc("groog.record.playRecordingRepeatedly", "Groog Play Recording Repeatedly"),
 		cc("groog.record.deleteRecording", "Groog Delete Recording"),
 		cc("groog.record.saveRecordingAs", "Groog Save Recording As..."),
-		cc("groog.record.startRecording", "Groog Start Recording"),
+		enters(cc("groog.record.startRecording", "Groog Start Recording"), "record"),
 		cc("groog.renameFile", "Groog Rename File"),
 		cc("groog.copyFilename", "Groog Copy Filename"),
-		cc("groog.reverseFind", "Groog reverse find"),
-		cc("groog.terminal.find", "Groog find in terminal"),
-		cc("groog.terminal.reverseFind", "Groog find in terminal"),
-		cc("groog.toggleMarkMode", "Emacs Toggle Mark Mode"),
-		cc("groog.toggleQMK", "Emacs Toggle QMK"),
-		cc("groog.type", "Groog Type"),
+		enters(cc("groog.reverseFind", "Groog reverse find"), "find"),
+		enters(cc("groog.terminal.find", "Groog find in terminal"), "terminal.find"),
+		enters(cc("groog.terminal.reverseFind", "Groog find in terminal"), "terminal.find"),
+		toggles(cc("groog.toggleMarkMode", "Emacs Toggle Mark Mode"), "mark"),
+		toggles(cc("groog.toggleQMK", "Emacs Toggle QMK"), "qmk"),
+		ccArgs("groog.testFile", "Groog Test File", TestFileArgs{}),
+		ccArgs("groog.type", "Groog Type", TypeArgs{}),
 		cc("groog.undo", "Groog Undo"),
 		cc("groog.redo", "Groog Redo"),
 		cc("groog.updateSettings", "Groog update settings"),
@@ -93,4 +128,4 @@ var (
 		cc("groog.script.replaceNewlineStringsWithQuotes", "Groog Script: Replace Newline Strings with Quotes"),
 		cc("groog.script.replaceNewlineStringsWithTicks", "Groog Script: Replace Newline Strings with Ticks"),
 	}
-)
+}
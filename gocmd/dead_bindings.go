@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// VS Code resolves a key by running the last binding (in package.json order)
+// whose when clause is true, so a binding can be dead even though it's
+// generated: its when clause may never be true, every context in which it's
+// true may also match a later binding for the same key, or it may be removed
+// by a later removal. Definitions with a nil KB aren't generated at all.
+
+// deadBinding is a keybinding definition that can never run.
+type deadBinding struct {
+	Key     string
+	Command string
+	When    string
+	Reason  string
+}
+
+func (db *deadBinding) String() string {
+	command := db.Command
+	if command == "" {
+		command = "<nil>"
+	}
+	when := db.When
+	if when == "" {
+		when = "always"
+	}
+	return fmt.Sprintf("%s: %s (%s) %s", db.Key, command, when, db.Reason)
+}
+
+// deadBindings returns the definitions that bind no command and the
+// generated keybindings that can never win VS Code's resolution (given the
+// context keys that are never true at the same time).
+func deadBindings(ds *Diagnostics, excludes map[[2]string]bool, kbDefs map[Key]map[string]*KB, kbs []*Keybinding) []*deadBinding {
+	var dead []*deadBinding
+	keys := maps.Keys(kbDefs)
+	slices.Sort(keys)
+	for _, key := range keys {
+		for _, when := range sortedKeys(kbDefs[key]) {
+			if kbDefs[key][when] == nil {
+				dead = append(dead, &deadBinding{string(key), "", when, "binds no command"})
+			}
+		}
+	}
+
+	var order []string
+	byKey := map[string][]*Keybinding{}
+	for _, kb := range kbs {
+		if _, ok := byKey[kb.Key]; !ok {
+			order = append(order, kb.Key)
+		}
+		byKey[kb.Key] = append(byKey[kb.Key], kb)
+	}
+	for _, key := range order {
+		dead = append(dead, deadKeyBindings(ds, excludes, byKey[key])...)
+	}
+	return dead
+}
+
+// removes returns whether the removal removes the (earlier) keybinding. Like
+// VS Code, only the command and when clause are compared (never the args).
+func removes(removal, kb *Keybinding) bool {
+	return removal.Command == "-"+kb.Command &&
+		(removal.When == "" || removal.When == kb.When)
+}
+
+// deadKeyBindings returns the dead keybindings among the keybindings (in
+// package.json order) for a single key.
+func deadKeyBindings(ds *Diagnostics, excludes map[[2]string]bool, kbs []*Keybinding) []*deadBinding {
+	var dead []*deadBinding
+	exprs := make([]whenExpr, len(kbs))
+	removedBy := make([]*Keybinding, len(kbs))
+	for i, kb := range kbs {
+		if strings.HasPrefix(kb.Command, "-") {
+			continue
+		}
+		for _, r := range kbs[i+1:] {
+			if removes(r, kb) {
+				removedBy[i] = r
+				break
+			}
+		}
+		// Invalid clauses are reported by checkWhen.
+		exprs[i], _ = parseWhen(kb.When)
+	}
+
+	for i, kb := range kbs {
+		if exprs[i] == nil {
+			continue
+		}
+		if r := removedBy[i]; r != nil {
+			dead = append(dead, &deadBinding{kb.Key, kb.Command, kb.When, fmt.Sprintf("is removed by %s", r.Command)})
+			continue
+		}
+
+		wv := &whenVariables{ids: map[string]int{}, excludes: excludes}
+		wv.collect(exprs[i])
+		var later []int
+		for j := i + 1; j < len(kbs); j++ {
+			if exprs[j] != nil && removedBy[j] == nil {
+				later = append(later, j)
+				wv.collect(exprs[j])
+			}
+		}
+		if len(wv.atoms) > maxWhenVariables {
+			ds.WarnAt(kb.Location, "keybinding for %s (%s) depends on too many context keys to check whether it's dead", kb.Key, kb.Command)
+			continue
+		}
+
+		satisfiable, wins := false, false
+		shadowing := map[int]bool{}
+		for row := uint(0); row < 1<<len(wv.atoms) && !wins; row++ {
+			if !wv.possible(row) || !wv.eval(exprs[i], row) {
+				continue
+			}
+			satisfiable = true
+			wins = true
+			for _, j := range later {
+				if wv.eval(exprs[j], row) {
+					shadowing[j] = true
+					wins = false
+				}
+			}
+		}
+
+		switch {
+		case !satisfiable:
+			dead = append(dead, &deadBinding{kb.Key, kb.Command, kb.When, "can never be true"})
+		case !wins:
+			var by []string
+			for _, j := range later {
+				if shadowing[j] {
+					by = append(by, fmt.Sprintf("%s (%s)", kbs[j].Command, kbs[j].When))
+				}
+			}
+			dead = append(dead, &deadBinding{kb.Key, kb.Command, kb.When, fmt.Sprintf("is shadowed by %s", strings.Join(by, ", "))})
+		}
+	}
+	return dead
+}
+
+func (c *cli) deadBindings(o command.Output, d *command.Data) error {
+	p, ds := generateGroogPackage("")
+	defs := groogDefinitions()
+	dead := deadBindings(ds, contextExclusions(defs.Contexts), defs.Keybindings, p.Contributes.Keybindings)
+	// Unsatisfiable clauses are package errors, but they're also dead
+	// bindings, so the report is printed before failing.
+	err := printDiagnostics(o, ds)
+
+	if len(dead) == 0 {
+		o.Stdoutln("No dead bindings found")
+		return err
+	}
+	for _, db := range dead {
+		o.Stdoutln(db.String())
+	}
+	return err
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDeadBindings(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		contexts []*ContextKey
+		kbDefs   map[Key]map[string]*KB
+		kbs      []*Keybinding
+		want     []*deadBinding
+	}{
+		{
+			name: "no bindings",
+		},
+		{
+			name: "live bindings",
+			kbs: []*Keybinding{
+				{Key: "ctrl+a", Command: "groog.a", When: "a"},
+				{Key: "ctrl+a", Command: "groog.b", When: "b"},
+				{Key: "ctrl+a", Command: "groog.c", When: "!a && !b"},
+				{Key: "ctrl+b", Command: "groog.a"},
+				{Key: "ctrl+c", Command: "groog.c", When: "resourceLangId == 'go'"},
+				{Key: "ctrl+c", Command: "groog.d", When: "resourceLangId == 'java'"},
+			},
+		},
+		{
+			name: "nil KB",
+			kbDefs: map[Key]map[string]*KB{
+				"ctrl+a": {
+					"a":  kb("groog.a"),
+					"!a": nil,
+				},
+			},
+			want: []*deadBinding{
+				{"ctrl+a", "", "!a", "binds no command"},
+			},
+		},
+		{
+			name: "unsatisfiable",
+			kbs: []*Keybinding{
+				{Key: "ctrl+a", Command: "groog.a", When: "a && !a"},
+				{Key: "ctrl+a", Command: "groog.b", When: "resourceLangId == 'go' && resourceLangId == java"},
+			},
+			want: []*deadBinding{
+				{"ctrl+a", "groog.a", "a && !a", "can never be true"},
+				{"ctrl+a", "groog.b", "resourceLangId == 'go' && resourceLangId == java", "can never be true"},
+			},
+		},
+		{
+			name: "shadowed",
+			kbs: []*Keybinding{
+				{Key: "ctrl+a", Command: "groog.a", When: "a && b"},
+				{Key: "ctrl+a", Command: "groog.b", When: "b && c"},
+				{Key: "ctrl+a", Command: "groog.c", When: "a && !c"},
+				{Key: "ctrl+b", Command: "groog.a", When: "a"},
+				{Key: "ctrl+b", Command: "groog.b"},
+			},
+			want: []*deadBinding{
+				{"ctrl+a", "groog.a", "a && b", "is shadowed by groog.b (b && c), groog.c (a && !c)"},
+				{"ctrl+b", "groog.a", "a", "is shadowed by groog.b ()"},
+			},
+		},
+		{
+			name: "only shadowed by the same key",
+			kbs: []*Keybinding{
+				{Key: "ctrl+a", Command: "groog.a", When: "a"},
+				{Key: "ctrl+b", Command: "groog.b"},
+			},
+		},
+		{
+			name: "removed",
+			kbs: []*Keybinding{
+				{Key: "ctrl+a", Command: "groog.a", When: "a"},
+				{Key: "ctrl+a", Command: "groog.b", When: "b"},
+				{Key: "ctrl+a", Command: "groog.c", When: "c", Args: map[string]interface{}{"c": 1}},
+				{Key: "ctrl+a", Command: "groog.d", When: "b"},
+				{Key: "ctrl+a", Command: "-groog.a"},
+				{Key: "ctrl+a", Command: "-groog.b", When: "a"},
+				{Key: "ctrl+a", Command: "-groog.c", Args: map[string]interface{}{"c": 2}},
+				{Key: "ctrl+a", Command: "-groog.d", When: "b"},
+			},
+			want: []*deadBinding{
+				{"ctrl+a", "groog.a", "a", "is removed by -groog.a"},
+				// Args never limit a removal.
+				{"ctrl+a", "groog.c", "c", "is removed by -groog.c"},
+				{"ctrl+a", "groog.d", "b", "is removed by -groog.d"},
+			},
+		},
+		{
+			name: "exclusive context keys",
+			contexts: []*ContextKey{
+				{Key: "editorTextFocus", Type: contextBool, Excludes: []string{"terminalFocus"}},
+				{Key: "terminalFocus", Type: contextBool, Excludes: []string{"editorTextFocus"}},
+			},
+			kbs: []*Keybinding{
+				// Only wins when both keys are true, which never happens.
+				{Key: "ctrl+a", Command: "groog.a", When: "editorTextFocus"},
+				{Key: "ctrl+a", Command: "groog.b", When: "!terminalFocus"},
+			},
+			want: []*deadBinding{
+				{"ctrl+a", "groog.a", "editorTextFocus", "is shadowed by groog.b (!terminalFocus)"},
+			},
+		},
+		{
+			name: "removed bindings don't shadow",
+			kbs: []*Keybinding{
+				{Key: "ctrl+a", Command: "groog.a", When: "a"},
+				{Key: "ctrl+a", Command: "groog.b"},
+				{Key: "ctrl+a", Command: "-groog.b"},
+			},
+			want: []*deadBinding{
+				{"ctrl+a", "groog.b", "", "is removed by -groog.b"},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ds := &Diagnostics{}
+			got := deadBindings(ds, contextExclusions(test.contexts), test.kbDefs, test.kbs)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("deadBindings() returned incorrect value (-want, +got):\n%s", diff)
+			}
+			if diff := cmp.Diff("", diagnosticMessages(ds)); diff != "" {
+				t.Errorf("deadBindings() recorded incorrect diagnostics (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDeadBindingsTooManyKeys(t *testing.T) {
+	var keys []string
+	for i := 0; i <= maxWhenVariables; i++ {
+		keys = append(keys, string(rune('a'+i)))
+	}
+	kbs := []*Keybinding{
+		{Key: "ctrl+a", Command: "groog.a", When: strings.Join(keys, " && ")},
+	}
+	ds := &Diagnostics{}
+	got := deadBindings(ds, nil, nil, kbs)
+	if len(got) != 0 {
+		t.Errorf("deadBindings() returned %v; want none", got)
+	}
+	want := "keybinding for ctrl+a (groog.a) depends on too many context keys to check whether it's dead"
+	if diff := cmp.Diff(want, diagnosticMessages(ds)); diff != "" {
+		t.Errorf("deadBindings() recorded incorrect diagnostics (-want, +got):\n%s", diff)
+	}
+}
+
+func TestGroogDeadBindings(t *testing.T) {
+	// Only the intentionally unbound (nil) definitions are dead.
+	defs := groogDefinitions()
+	for _, db := range deadBindings(&Diagnostics{}, contextExclusions(defs.Contexts), defs.Keybindings, groogPackage("").Contributes.Keybindings) {
+		if db.Command != "" {
+			t.Errorf("binding is dead: %v", db)
+		}
+	}
+}
+
+func TestDeadBindingString(t *testing.T) {
+	for _, test := range []struct {
+		db   *deadBinding
+		want string
+	}{
+		{
+			db:   &deadBinding{"ctrl+a", "", "a", "binds no command"},
+			want: "ctrl+a: <nil> (a) binds no command",
+		},
+		{
+			db:   &deadBinding{"ctrl+a", "groog.a", "", "is removed by -groog.a"},
+			want: "ctrl+a: groog.a (always) is removed by -groog.a",
+		},
+	} {
+		if diff := cmp.Diff(test.want, test.db.String()); diff != "" {
+			t.Errorf("deadBinding.String() returned incorrect value (-want, +got):\n%s", diff)
+		}
+	}
+}
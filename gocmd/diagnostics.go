@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Problems found while building the keybinding definitions are recorded as
+// diagnostics (rather than panicking) so that generation can continue and
+// every problem can be reported at once, along with the location of the
+// definition that caused it.
+
+type Severity string
+
+const (
+	severityError   Severity = "error"
+	severityWarning Severity = "warning"
+)
+
+// Location is a position in the Go source (or a whole file if Line is zero).
+type Location struct {
+	File string
+	Line int
+}
+
+func (l Location) String() string {
+	if l.Line == 0 {
+		return l.File
+	}
+	return fmt.Sprintf("%s:%d", l.File, l.Line)
+}
+
+type Diagnostic struct {
+	Severity Severity
+	Location
+	Message string
+}
+
+func (d *Diagnostic) String() string {
+	if d.Severity == severityWarning {
+		return fmt.Sprintf("%s: warning: %s", d.Location, d.Message)
+	}
+	return fmt.Sprintf("%s: %s", d.Location, d.Message)
+}
+
+// Diagnostics is a collection of diagnostics. It's passed explicitly to
+// everything that can record one (there is no default collector).
+type Diagnostics struct {
+	mu          sync.Mutex
+	diagnostics []*Diagnostic
+}
+
+func (ds *Diagnostics) add(severity Severity, loc Location, message string) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.diagnostics = append(ds.diagnostics, &Diagnostic{severity, loc, message})
+}
+
+// Errorf records an error at the location of the caller.
+func (ds *Diagnostics) Errorf(format string, a ...interface{}) {
+	ds.add(severityError, callerLocation(), fmt.Sprintf(format, a...))
+}
+
+// Warnf records a warning at the location of the caller.
+func (ds *Diagnostics) Warnf(format string, a ...interface{}) {
+	ds.add(severityWarning, callerLocation(), fmt.Sprintf(format, a...))
+}
+
+// ErrorAt records an error at the provided location (e.g. the definition that
+// caused it).
+func (ds *Diagnostics) ErrorAt(loc Location, format string, a ...interface{}) {
+	ds.add(severityError, loc, fmt.Sprintf(format, a...))
+}
+
+// WarnAt records a warning at the provided location.
+func (ds *Diagnostics) WarnAt(loc Location, format string, a ...interface{}) {
+	ds.add(severityWarning, loc, fmt.Sprintf(format, a...))
+}
+
+// All returns all of the recorded diagnostics in the order they were recorded.
+func (ds *Diagnostics) All() []*Diagnostic {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	return append([]*Diagnostic{}, ds.diagnostics...)
+}
+
+// HasErrors returns whether any error diagnostics were recorded.
+func (ds *Diagnostics) HasErrors() bool {
+	for _, d := range ds.All() {
+		if d.Severity == severityError {
+			return true
+		}
+	}
+	return false
+}
+
+func (ds *Diagnostics) String() string {
+	var r []string
+	for _, d := range ds.All() {
+		r = append(r, d.String())
+	}
+	return strings.Join(r, "\n")
+}
+
+// callerLocation returns the location of the first caller outside of this
+// file.
+func callerLocation() Location {
+	return stackLocation(func(runtime.Frame) bool { return false })
+}
+
+var (
+	// dslHelperNames is the set of dslHelpers (computed once, on first use).
+	dslHelperNames     map[string]bool
+	dslHelperNamesOnce sync.Once
+)
+
+// dslLocation returns the location of the keybinding definition that is
+// currently being built. DSL helpers (see dslHelpers) are skipped, similar to
+// `testing.T.Helper`, so the location is the line that called the outermost
+// helper.
+func dslLocation() Location {
+	dslHelperNamesOnce.Do(func() {
+		dslHelperNames = dslHelpers()
+	})
+	return stackLocation(func(frame runtime.Frame) bool {
+		return dslHelperNames[frame.Function]
+	})
+}
+
+// stackLocation returns the location of the first function in the stack that
+// isn't in this file or skipped.
+func stackLocation(skip func(runtime.Frame) bool) Location {
+	pcs := make([]uintptr, 32)
+	// Skip runtime.Callers and this function
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var last runtime.Frame
+	for {
+		frame, more := frames.Next()
+		last = frame
+		if filepath.Base(frame.File) != "diagnostics.go" && !skip(frame) {
+			break
+		}
+		if !more {
+			break
+		}
+	}
+	return Location{filepath.Base(last.File), last.Line}
+}
+
+// funcNames returns the set of names (as reported by the runtime) of the
+// provided functions.
+func funcNames(fs ...interface{}) map[string]bool {
+	m := map[string]bool{}
+	for _, f := range fs {
+		m[runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()] = true
+	}
+	return m
+}
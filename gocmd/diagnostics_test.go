@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDSLLocation(t *testing.T) {
+	_, _, line, _ := runtime.Caller(0)
+	k := kb("a")
+	m := textOnly("b")
+	seq := mc("c", "d")
+	want := []Location{
+		{"diagnostics_test.go", line + 1},
+		{"diagnostics_test.go", line + 2},
+		{"diagnostics_test.go", line + 3},
+	}
+	got := []Location{k.Location, m[groogBehaviorContext.value].Location, seq.Location}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("dslLocation() returned incorrect locations (-want, +got):\n%s", diff)
+	}
+}
+
+func TestDSLErrorsAreReportedAtDefinition(t *testing.T) {
+	_, _, line, _ := runtime.Caller(0)
+	kbDefs := map[Key]map[string]*KB{
+		ctrl("x"): {
+			always.value: mcWithArgs(kb("a"), termKeys("nope")),
+		},
+	}
+	ds := &Diagnostics{}
+	kbDefsToBindings(ds, kbDefs, nil)
+	want := []*Diagnostic{{
+		Severity: severityError,
+		Location: Location{"diagnostics_test.go", line + 3},
+		Message:  `failed to encode terminal keys [nope]: unknown terminal key "nope"`,
+	}}
+	if diff := cmp.Diff(want, ds.All()); diff != "" {
+		t.Errorf("kbDefsToBindings() recorded incorrect diagnostics (-want, +got):\n%s", diff)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	ds := &Diagnostics{}
+	if ds.HasErrors() {
+		t.Errorf("empty Diagnostics.HasErrors() returned true")
+	}
+
+	ds.Warnf("careful %d", 1)
+	if ds.HasErrors() {
+		t.Errorf("Diagnostics.HasErrors() returned true with only warnings")
+	}
+
+	ds.Errorf("oops %s", "two")
+	if !ds.HasErrors() {
+		t.Errorf("Diagnostics.HasErrors() returned false with errors")
+	}
+
+	ds.WarnAt(Location{"keybindings.go", 12}, "over %s", "there")
+	ds.ErrorAt(Location{"modes.go", 3}, "and %s", "here")
+	ds.ErrorAt(Location{File: "package-lock.json"}, "whole %s", "file")
+
+	_, _, line, _ := runtime.Caller(0)
+	want := strings.Join([]string{
+		fmt.Sprintf("diagnostics_test.go:%d: warning: careful 1", line-14),
+		fmt.Sprintf("diagnostics_test.go:%d: oops two", line-9),
+		"keybindings.go:12: warning: over there",
+		"modes.go:3: and here",
+		"package-lock.json: whole file",
+	}, "\n")
+	if diff := cmp.Diff(want, ds.String()); diff != "" {
+		t.Errorf("Diagnostics.String() returned incorrect value (-want, +got):\n%s", diff)
+	}
+}
+
+// diagnosticMessages returns the newline-separated messages of all diagnostics.
+func diagnosticMessages(ds *Diagnostics) string {
+	var r []string
+	for _, d := range ds.All() {
+		r = append(r, d.Message)
+	}
+	return strings.Join(r, "\n")
+}
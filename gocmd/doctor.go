@@ -0,0 +1,360 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+	"golang.org/x/exp/slices"
+)
+
+// The doctor cross-checks the generated package against the rest of the build
+// configuration (tsconfig.json, package-lock.json, and the files in the repo)
+// since none of those are generated from the same source.
+
+var (
+	machinePathRegex  = regexp.MustCompile(`file:///|\b[A-Za-z]:[\\/]|/Users/|/home/`)
+	versionRangeRegex = regexp.MustCompile(`^(?:\^|~|>=)?\s*([0-9]+(?:\.[0-9]+){0,2})(?:\.x)?$`)
+)
+
+func cleanPath(p string) string {
+	return path.Clean(strings.TrimPrefix(filepath.ToSlash(p), "./"))
+}
+
+type tsConfig struct {
+	CompilerOptions struct {
+		OutDir  string `json:"outDir"`
+		RootDir string `json:"rootDir"`
+	} `json:"compilerOptions"`
+}
+
+// readTSConfig reads the tsconfig file (which may contain comments and
+// trailing commas).
+func readTSConfig(fsys fs.FS, name string) (*tsConfig, error) {
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", name, err)
+	}
+	tc := &tsConfig{}
+	if err := json.Unmarshal([]byte(stripJSONComments(string(b))), tc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", name, err)
+	}
+	return tc, nil
+}
+
+// stripJSONComments converts JSON with comments (and trailing commas) into
+// regular JSON.
+func stripJSONComments(s string) string {
+	// scan calls f for every byte that isn't in a string and writes the bytes
+	// for which f returns true.
+	scan := func(s string, f func(i int) (skip int, keep bool)) string {
+		var sb strings.Builder
+		inString := false
+		for i := 0; i < len(s); i++ {
+			c := s[i]
+			if inString {
+				sb.WriteByte(c)
+				if c == '\\' && i+1 < len(s) {
+					i++
+					sb.WriteByte(s[i])
+				} else if c == '"' {
+					inString = false
+				}
+				continue
+			}
+			inString = c == '"'
+			skip, keep := f(i)
+			if keep {
+				sb.WriteByte(c)
+			}
+			i += skip
+		}
+		return sb.String()
+	}
+
+	s = scan(s, func(i int) (int, bool) {
+		switch {
+		case strings.HasPrefix(s[i:], "//"):
+			if end := strings.Index(s[i:], "\n"); end >= 0 {
+				// Keep the newline
+				return end - 1, false
+			}
+			return len(s), false
+		case strings.HasPrefix(s[i:], "/*"):
+			if end := strings.Index(s[i+2:], "*/"); end >= 0 {
+				return end + 3, false
+			}
+			return len(s), false
+		}
+		return 0, true
+	})
+	return scan(s, func(i int) (int, bool) {
+		if s[i] != ',' {
+			return 0, true
+		}
+		rest := strings.TrimLeft(s[i+1:], " \t\r\n")
+		return 0, !strings.HasPrefix(rest, "}") && !strings.HasPrefix(rest, "]")
+	})
+}
+
+// minVersion returns the minimum version allowed by a simple npm version range
+// (e.g. "^1.81.0", "~1.2", ">=1.0.0", or "16.x").
+func minVersion(r string) (*Version, error) {
+	m := versionRangeRegex.FindStringSubmatch(strings.TrimSpace(r))
+	if len(m) == 0 {
+		return nil, fmt.Errorf("unsupported version range %q", r)
+	}
+	parts := strings.Split(m[1], ".")
+	for len(parts) < 3 {
+		parts = append(parts, "0")
+	}
+	return parseVersion(strings.Join(parts, "."))
+}
+
+type packageLock struct {
+	Version  string `json:"version"`
+	Packages map[string]*struct {
+		Version         string            `json:"version"`
+		Dev             bool              `json:"dev"`
+		Dependencies    map[string]string `json:"dependencies"`
+		DevDependencies map[string]string `json:"devDependencies"`
+	} `json:"packages"`
+}
+
+// doctor records all of the inconsistencies between the package (and the
+// scripts and media it was generated from) and the files in fsys (the repo
+// root). Problems are reported at the file that needs to be fixed (package.json
+// is generated from package.go, so problems with it are reported there).
+func doctor(ds *Diagnostics, fsys fs.FS, p *Package, scripts map[string]Script, media []string) {
+	checkMain(ds, p, scripts)
+	checkTsc(ds, fsys, p, scripts)
+	checkEsbuild(ds, fsys, scripts)
+	checkScripts(ds, p)
+	checkEngine(ds, p)
+	checkFiles(ds, fsys, p, media)
+	checkLock(ds, fsys, p)
+}
+
+// checkMain verifies that Main is the file built by the vscode:prepublish
+// script (since that's the script run when packaging the extension).
+func checkMain(ds *Diagnostics, p *Package, scripts map[string]Script) {
+	main := cleanPath(p.Main)
+	writesMain := func(so *scriptOutput) bool { return so.writes(main) }
+
+	var all []*scriptOutput
+	for _, name := range sortedKeys(scripts) {
+		for _, so := range scriptOutputs(scripts, name) {
+			if !slices.ContainsFunc(all, func(a *scriptOutput) bool { return *a == *so }) {
+				all = append(all, so)
+			}
+		}
+	}
+
+	describe := func(outputs []*scriptOutput) string {
+		var r []string
+		for _, o := range outputs {
+			r = append(r, fmt.Sprintf("%s (%s)", o.Output, o.Tool))
+		}
+		slices.Sort(r)
+		return strings.Join(r, ", ")
+	}
+
+	if _, ok := scripts[prepublishScriptName]; !ok {
+		ds.WarnAt(Location{File: "scripts.go"}, "no %q script, so Main (%s) must be built manually before packaging", prepublishScriptName, p.Main)
+	} else if outputs := scriptOutputs(scripts, prepublishScriptName); !slices.ContainsFunc(outputs, writesMain) {
+		if len(outputs) == 0 {
+			ds.ErrorAt(Location{File: "package.go"}, "Main (%s) is not built by the %q script (which has no known outputs)", p.Main, prepublishScriptName)
+		} else {
+			ds.ErrorAt(Location{File: "package.go"}, "Main (%s) is not built by the %q script (which writes %s)", p.Main, prepublishScriptName, describe(outputs))
+		}
+	}
+
+	if !slices.ContainsFunc(all, writesMain) {
+		ds.ErrorAt(Location{File: "package.go"}, "Main (%s) is not written by any script (outputs: %s)", p.Main, describe(all))
+	}
+}
+
+// checkTsc verifies that the tsc scripts match their tsconfig.json (and that
+// tsc builds Main from an existing source file if it's responsible for it).
+func checkTsc(ds *Diagnostics, fsys fs.FS, p *Package, scripts map[string]Script) {
+	checked := map[Tsc]bool{}
+	for _, name := range sortedKeys(scripts) {
+		t, ok := scripts[name].(Tsc)
+		if !ok {
+			continue
+		}
+		// Watch mode doesn't change anything that's checked here.
+		t.Watch = false
+		if checked[t] {
+			continue
+		}
+		checked[t] = true
+
+		tc, err := readTSConfig(fsys, t.tsconfigPath())
+		if err != nil {
+			ds.ErrorAt(Location{File: "scripts.go"}, "script %q: %v", name, err)
+			continue
+		}
+		if cleanPath(tc.CompilerOptions.OutDir) != cleanPath(t.OutDir) {
+			ds.ErrorAt(Location{File: "scripts.go"}, "script %q has outDir %q, but %s has outDir %q", name, t.OutDir, t.tsconfigPath(), tc.CompilerOptions.OutDir)
+			continue
+		}
+
+		// tsc only emits files for sources under rootDir.
+		main := cleanPath(p.Main)
+		for _, so := range t.Outputs() {
+			if !so.writes(main) || tc.CompilerOptions.RootDir == "" {
+				continue
+			}
+			src := path.Join(cleanPath(tc.CompilerOptions.RootDir), strings.TrimSuffix(strings.TrimPrefix(main, so.Output), ".js")+".ts")
+			if _, err := fs.Stat(fsys, src); err != nil {
+				ds.ErrorAt(Location{File: "package.go"}, "Main (%s) is built by tsc from %s, which does not exist", p.Main, src)
+			}
+		}
+	}
+}
+
+// checkEsbuild verifies that the esbuild entry points exist.
+func checkEsbuild(ds *Diagnostics, fsys fs.FS, scripts map[string]Script) {
+	checked := map[string]bool{}
+	for _, name := range sortedKeys(scripts) {
+		e, ok := scripts[name].(Esbuild)
+		if !ok || checked[e.Entry] {
+			continue
+		}
+		checked[e.Entry] = true
+		if _, err := fs.Stat(fsys, cleanPath(e.Entry)); err != nil {
+			ds.ErrorAt(Location{File: "scripts.go"}, "script %q: entry point %s does not exist", name, e.Entry)
+		}
+	}
+}
+
+// checkScripts verifies that scripts don't depend on a specific machine.
+func checkScripts(ds *Diagnostics, p *Package) {
+	for _, name := range sortedKeys(p.Scripts) {
+		if loc := machinePathRegex.FindStringIndex(p.Scripts[name]); loc != nil {
+			ds.WarnAt(Location{File: "package.go"}, "script %q contains a machine-specific path (%q)", name, p.Scripts[name][loc[0]:])
+		}
+	}
+}
+
+// checkEngine verifies that the @types/vscode version doesn't include APIs
+// that aren't available in the minimum supported VS Code version.
+func checkEngine(ds *Diagnostics, p *Package) {
+	engine, ok := p.Engines["vscode"]
+	if !ok {
+		ds.ErrorAt(Location{File: "package.go"}, "engines.vscode is not set")
+		return
+	}
+	engineMin, err := minVersion(engine)
+	if err != nil {
+		ds.ErrorAt(Location{File: "package.go"}, "engines.vscode: %v", err)
+		return
+	}
+
+	types, ok := p.DevDependencies["@types/vscode"]
+	if !ok {
+		ds.WarnAt(Location{File: "package.go"}, "@types/vscode is not a devDependency")
+		return
+	}
+	typesMin, err := minVersion(types)
+	if err != nil {
+		ds.ErrorAt(Location{File: "package.go"}, "@types/vscode: %v", err)
+		return
+	}
+
+	if typesMin.Compare(engineMin) > 0 {
+		ds.ErrorAt(Location{File: "package.go"}, "@types/vscode (%s) is newer than engines.vscode (%s), so the extension may use APIs that aren't available in the minimum supported VS Code version", types, engine)
+	}
+}
+
+// checkFiles verifies that every snippet and media file exists.
+func checkFiles(ds *Diagnostics, fsys fs.FS, p *Package, media []string) {
+	for _, s := range p.contributions().Snipppets {
+		if _, err := fs.Stat(fsys, cleanPath(s.Path)); err != nil {
+			ds.ErrorAt(Location{File: "snippets.go"}, "snippet file %q does not exist", s.Path)
+		}
+	}
+	for _, m := range media {
+		if _, err := fs.Stat(fsys, cleanPath(m)); err != nil {
+			ds.ErrorAt(Location{File: "media.go"}, "media file %q does not exist", m)
+		}
+	}
+}
+
+// checkLock verifies that package-lock.json is in sync with the package.
+func checkLock(ds *Diagnostics, fsys fs.FS, p *Package) {
+	b, err := fs.ReadFile(fsys, "package-lock.json")
+	if err != nil {
+		ds.ErrorAt(Location{File: "package-lock.json"}, "failed to read package-lock.json: %v", err)
+		return
+	}
+	lock := &packageLock{}
+	if err := json.Unmarshal(b, lock); err != nil {
+		ds.ErrorAt(Location{File: "package-lock.json"}, "failed to parse package-lock.json: %v", err)
+		return
+	}
+
+	if lock.Version != p.Version {
+		ds.ErrorAt(Location{File: "package-lock.json"}, "version (%s) does not match the package version (%s)", lock.Version, p.Version)
+	}
+
+	root, ok := lock.Packages[""]
+	if !ok {
+		ds.WarnAt(Location{File: "package-lock.json"}, "no root package (lockfileVersion 1 isn't supported), so dependencies can't be checked")
+		return
+	}
+
+	check := func(kind string, want, got map[string]string) {
+		for _, dep := range sortedKeys(want) {
+			if v, ok := got[dep]; !ok {
+				ds.ErrorAt(Location{File: "package-lock.json"}, "%s %s@%s is missing (run `npm install`)", kind, dep, want[dep])
+			} else if v != want[dep] {
+				ds.ErrorAt(Location{File: "package-lock.json"}, "%s %s is %s, but package.json requires %s (run `npm install`)", kind, dep, v, want[dep])
+			} else if _, ok := lock.Packages["node_modules/"+dep]; !ok {
+				ds.ErrorAt(Location{File: "package-lock.json"}, "%s %s has no resolved package (run `npm install`)", kind, dep)
+			}
+		}
+		for _, dep := range sortedKeys(got) {
+			if _, ok := want[dep]; !ok {
+				ds.ErrorAt(Location{File: "package-lock.json"}, "%s %s@%s is not in package.json (run `npm install`)", kind, dep, got[dep])
+			}
+		}
+	}
+	check("dependency", p.Dependencies, root.Dependencies)
+	check("devDependency", p.DevDependencies, root.DevDependencies)
+}
+
+// doctor prints all of the inconsistencies in the build configuration.
+func (c *cli) doctor(o command.Output, d *command.Data) error {
+	p, ds := generateGroogPackage("")
+	defs := groogDefinitions()
+	if err := printDiagnostics(o, ds); err != nil {
+		return err
+	}
+
+	ds = &Diagnostics{}
+	doctor(ds, os.DirFS(filepath.Dir(filepath.Dir(runtimeNode.Get(d)))), p, defs.Scripts, defs.Media)
+	if len(ds.All()) == 0 {
+		o.Stdoutln("No problems found")
+		return nil
+	}
+
+	var errs int
+	for _, f := range ds.All() {
+		if f.Severity == severityError {
+			errs++
+		}
+		o.Stdoutln(f.String())
+	}
+	if errs > 0 {
+		return o.Stderrf("found %d error(s)\n", errs)
+	}
+	return nil
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStripJSONComments(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		s    string
+		want string
+	}{
+		{
+			name: "plain json",
+			s:    `{"a": [1, 2]}`,
+			want: `{"a": [1, 2]}`,
+		},
+		{
+			name: "line comments",
+			s:    "{\n\t\"a\": 1 // comment\n\t// \"b\": 2\n}",
+			want: "{\n\t\"a\": 1 \n\t\n}",
+		},
+		{
+			name: "block comments",
+			s:    `{"a": /* one */ 1 /* two */}`,
+			want: `{"a":  1 }`,
+		},
+		{
+			name: "trailing commas",
+			s:    "{\"a\": [1, 2, ], \"b\": 3,\n}",
+			want: "{\"a\": [1, 2 ], \"b\": 3\n}",
+		},
+		{
+			name: "trailing comma before comment",
+			s:    "{\"a\": 1, // comment\n}",
+			want: "{\"a\": 1 \n}",
+		},
+		{
+			name: "comment characters in strings",
+			s:    `{"a": "file:///c/*d*/", "b": "\"//,}"}`,
+			want: `{"a": "file:///c/*d*/", "b": "\"//,}"}`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := cmp.Diff(test.want, stripJSONComments(test.s)); diff != "" {
+				t.Errorf("stripJSONComments(%q) returned incorrect value (-want, +got):\n%s", test.s, diff)
+			}
+		})
+	}
+}
+
+func TestMinVersion(t *testing.T) {
+	for _, test := range []struct {
+		r       string
+		want    string
+		wantErr string
+	}{
+		{r: "^1.81.0", want: "1.81.0"},
+		{r: "~1.2", want: "1.2.0"},
+		{r: ">=1.0.0", want: "1.0.0"},
+		{r: "16.x", want: "16.0.0"},
+		{r: "2", want: "2.0.0"},
+		{r: "1.x || 2.x", wantErr: `unsupported version range "1.x || 2.x"`},
+	} {
+		t.Run(test.r, func(t *testing.T) {
+			var got, gotErr string
+			if v, err := minVersion(test.r); err != nil {
+				gotErr = err.Error()
+			} else {
+				got = v.String()
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr); diff != "" {
+				t.Errorf("minVersion(%q) returned incorrect error (-want, +got):\n%s", test.r, diff)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("minVersion(%q) returned incorrect value (-want, +got):\n%s", test.r, diff)
+			}
+		})
+	}
+}
+
+func doctorTestFS() fstest.MapFS {
+	return fstest.MapFS{
+		"tsconfig.json": {Data: []byte(`{
+	"compilerOptions": {
+		"outDir": "out",
+		"rootDir": "src", // comment
+	},
+}`)},
+		"src/extension.ts": {Data: []byte("ts")},
+		"snippets/go.json": {Data: []byte("{}")},
+		"media/icon.jpg":   {Data: []byte("jpg")},
+		"package-lock.json": {Data: []byte(`{
+  "version": "1.0.0",
+  "packages": {
+    "": {
+      "version": "1.0.0",
+      "dependencies": {"await-lock": "^2.2.2"},
+      "devDependencies": {"@types/vscode": "^1.81.0"}
+    },
+    "node_modules/await-lock": {"version": "2.2.2"},
+    "node_modules/@types/vscode": {"version": "1.81.0", "dev": true}
+  }
+}`)},
+	}
+}
+
+func doctorTestPackage() *Package {
+	return &Package{
+		Version:         "1.0.0",
+		Main:            "./dist/extension.js",
+		Engines:         map[string]string{"vscode": "^1.81.0"},
+		Dependencies:    map[string]string{"await-lock": "^2.2.2"},
+		DevDependencies: map[string]string{"@types/vscode": "^1.81.0"},
+		Contributes: &Contribution{
+			Snipppets: []*Snippet{{"snippets/go.json", "go"}},
+		},
+	}
+}
+
+func doctorTestScripts() map[string]Script {
+	esbuild := Esbuild{Entry: "./src/extension.ts", Outfile: "dist/extension.js", Externals: []string{"vscode"}, Bundle: true}
+	return map[string]Script{
+		"vscode:prepublish": NpmRun{"esbuild-base"},
+		"esbuild-base":      esbuild,
+		"compile":           Tsc{Project: "./", OutDir: "out"},
+		"watch":             Tsc{Project: "./", OutDir: "out", Watch: true},
+	}
+}
+
+// withoutKey returns a copy of the map without the provided key.
+func withoutKey[M ~map[string]V, V any](m M, key string) M {
+	r := M{}
+	for k, v := range m {
+		if k != key {
+			r[k] = v
+		}
+	}
+	return r
+}
+
+func TestDoctor(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		fsys    func(fstest.MapFS) fstest.MapFS
+		p       func(*Package)
+		scripts func(map[string]Script) map[string]Script
+		media   []string
+		want    []string
+	}{
+		{
+			name:  "no problems",
+			media: []string{"media/icon.jpg"},
+		},
+		{
+			name: "main is built by tsc",
+			p: func(p *Package) {
+				p.Main = "./out/extension.js"
+			},
+			want: []string{
+				`package.go: Main (./out/extension.js) is not built by the "vscode:prepublish" script (which writes dist/extension.js (esbuild))`,
+			},
+		},
+		{
+			name: "main isn't built",
+			p: func(p *Package) {
+				p.Main = "./build/extension.js"
+			},
+			want: []string{
+				`package.go: Main (./build/extension.js) is not built by the "vscode:prepublish" script (which writes dist/extension.js (esbuild))`,
+				`package.go: Main (./build/extension.js) is not written by any script (outputs: dist/extension.js (esbuild), out/ (tsc))`,
+			},
+		},
+		{
+			name: "main is built by tsc from a missing source",
+			p: func(p *Package) {
+				p.Main = "./out/other.js"
+			},
+			scripts: func(scripts map[string]Script) map[string]Script {
+				scripts["vscode:prepublish"] = NpmRun{"compile"}
+				return scripts
+			},
+			want: []string{
+				`package.go: Main (./out/other.js) is built by tsc from src/other.ts, which does not exist`,
+			},
+		},
+		{
+			name: "main is built by prepublish tsc",
+			p: func(p *Package) {
+				p.Main = "./out/extension.js"
+			},
+			scripts: func(scripts map[string]Script) map[string]Script {
+				scripts["vscode:prepublish"] = NpmRun{"compile"}
+				return scripts
+			},
+		},
+		{
+			name: "missing esbuild entry point",
+			scripts: func(scripts map[string]Script) map[string]Script {
+				scripts["esbuild-base"] = Esbuild{Entry: "./src/main.ts", Outfile: "dist/extension.js"}
+				return scripts
+			},
+			want: []string{
+				`scripts.go: script "esbuild-base": entry point ./src/main.ts does not exist`,
+			},
+		},
+		{
+			name: "tsc outDir mismatch",
+			scripts: func(scripts map[string]Script) map[string]Script {
+				scripts["compile"] = Tsc{Project: "./", OutDir: "build"}
+				return scripts
+			},
+			want: []string{
+				`scripts.go: script "compile" has outDir "build", but tsconfig.json has outDir "out"`,
+			},
+		},
+		{
+			name: "no prepublish script",
+			scripts: func(scripts map[string]Script) map[string]Script {
+				return withoutKey(scripts, "vscode:prepublish")
+			},
+			want: []string{
+				`scripts.go: warning: no "vscode:prepublish" script, so Main (./dist/extension.js) must be built manually before packaging`,
+			},
+		},
+		{
+			name: "missing tsconfig",
+			fsys: func(fsys fstest.MapFS) fstest.MapFS {
+				return withoutKey(fsys, "tsconfig.json")
+			},
+			want: []string{
+				`scripts.go: script "compile": failed to read tsconfig.json: open tsconfig.json: file does not exist`,
+			},
+		},
+		{
+			name: "machine-specific paths",
+			scripts: func(scripts map[string]Script) map[string]Script {
+				scripts["posttest"] = ShellScript("echo 'file:///C:/Users/me/coverage/index.html'")
+				scripts["open"] = ShellScript(`start C:\Users\me`)
+				return scripts
+			},
+			want: []string{
+				`package.go: warning: script "open" contains a machine-specific path ("C:\\Users\\me")`,
+				`package.go: warning: script "posttest" contains a machine-specific path ("file:///C:/Users/me/coverage/index.html'")`,
+			},
+		},
+		{
+			name: "types newer than engine",
+			p: func(p *Package) {
+				p.Engines["vscode"] = "^1.80.0"
+			},
+			want: []string{
+				`package.go: @types/vscode (^1.81.0) is newer than engines.vscode (^1.80.0), so the extension may use APIs that aren't available in the minimum supported VS Code version`,
+			},
+		},
+		{
+			name: "types older than engine",
+			p: func(p *Package) {
+				p.Engines["vscode"] = "^1.85.0"
+			},
+		},
+		{
+			name: "no engine",
+			p: func(p *Package) {
+				p.Engines = withoutKey(p.Engines, "vscode")
+			},
+			want: []string{
+				"package.go: engines.vscode is not set",
+			},
+		},
+		{
+			name: "missing snippets and media",
+			p: func(p *Package) {
+				p.Contributes.Snipppets = append(p.Contributes.Snipppets, &Snippet{"snippets/java.json", "java"})
+			},
+			media: []string{"media/icon.jpg", "media/other.jpg"},
+			want: []string{
+				`snippets.go: snippet file "snippets/java.json" does not exist`,
+				`media.go: media file "media/other.jpg" does not exist`,
+			},
+		},
+		{
+			name: "lock out of sync",
+			p: func(p *Package) {
+				p.Version = "1.0.1"
+				p.Dependencies = map[string]string{
+					"await-lock": "^2.3.0",
+					"glob":       "^10.3.3",
+				}
+				p.DevDependencies = nil
+			},
+			want: []string{
+				"package.go: warning: @types/vscode is not a devDependency",
+				"package-lock.json: version (1.0.0) does not match the package version (1.0.1)",
+				"package-lock.json: dependency await-lock is ^2.2.2, but package.json requires ^2.3.0 (run `npm install`)",
+				"package-lock.json: dependency glob@^10.3.3 is missing (run `npm install`)",
+				"package-lock.json: devDependency @types/vscode@^1.81.0 is not in package.json (run `npm install`)",
+			},
+		},
+		{
+			name: "unresolved dependency",
+			fsys: func(fsys fstest.MapFS) fstest.MapFS {
+				fsys["package-lock.json"] = &fstest.MapFile{Data: []byte(`{
+  "version": "1.0.0",
+  "packages": {
+    "": {
+      "dependencies": {"await-lock": "^2.2.2"},
+      "devDependencies": {"@types/vscode": "^1.81.0"}
+    },
+    "node_modules/@types/vscode": {"version": "1.81.0", "dev": true}
+  }
+}`)}
+				return fsys
+			},
+			want: []string{
+				"package-lock.json: dependency await-lock has no resolved package (run `npm install`)",
+			},
+		},
+		{
+			name: "missing lock",
+			fsys: func(fsys fstest.MapFS) fstest.MapFS {
+				return withoutKey(fsys, "package-lock.json")
+			},
+			want: []string{
+				"package-lock.json: failed to read package-lock.json: open package-lock.json: file does not exist",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fsys := doctorTestFS()
+			if test.fsys != nil {
+				fsys = test.fsys(fsys)
+			}
+			scripts := doctorTestScripts()
+			if test.scripts != nil {
+				scripts = test.scripts(scripts)
+			}
+			p := doctorTestPackage()
+			p.Scripts = renderScripts(scripts)
+			if test.p != nil {
+				test.p(p)
+			}
+
+			ds := &Diagnostics{}
+			doctor(ds, fsys, p, scripts, test.media)
+			var got []string
+			for _, d := range ds.All() {
+				got = append(got, d.String())
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("doctor() returned incorrect findings (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
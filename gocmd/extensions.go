@@ -0,0 +1,134 @@
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// Keybindings can run commands provided by other extensions, so those
+// extensions are added to extensionDependencies (otherwise, installing groog
+// on its own leaves those keys broken).
+
+// ExtensionRegistry determines which extension provides each command run by
+// the keybindings. Prefixes that end in a period match every command that
+// starts with them; all other prefixes only match the exact command.
+type ExtensionRegistry struct {
+	// Extensions maps command prefixes to the ID of the extension that
+	// provides them.
+	Extensions map[string]string
+	// Commands is the catalog of known commands (see builtin_commands.go).
+	// Its entries take precedence over the prefixes in Extensions.
+	Commands []*KnownCommand
+	// Optional is the extensions that aren't added to extensionDependencies
+	// (the keybindings for their commands just don't do anything if the
+	// extension isn't installed).
+	Optional []string
+}
+
+// matchesPrefix returns whether the command is matched by the prefix.
+func matchesPrefix(prefix, command string) bool {
+	if strings.HasSuffix(prefix, ".") {
+		return strings.HasPrefix(command, prefix)
+	}
+	return command == prefix
+}
+
+// provider returns the ID of the extension that provides the command, or an
+// empty string for VS Code commands. If the command isn't in the catalog, the
+// longest matching prefix is used, and ok is false if no prefix matches.
+func (er *ExtensionRegistry) provider(command string) (id string, ok bool) {
+	if kc := lookupCommand(er.Commands, command); kc != nil {
+		return kc.Extension, true
+	}
+	var best string
+	for prefix, ext := range er.Extensions {
+		if matchesPrefix(prefix, command) && len(prefix) > len(best) {
+			best, id, ok = prefix, ext, true
+		}
+	}
+	return id, ok
+}
+
+// sequenceCommands returns the commands run by the multi-command sequence (if
+// any) in the args.
+func sequenceCommands(args map[string]interface{}) []*KB {
+	var kbs []*KB
+	switch seq := args["sequence"].(type) {
+	case []*KB:
+		kbs = append(kbs, seq...)
+	case []map[string]interface{}:
+		for _, m := range seq {
+			kb := &KB{}
+			kb.Command, _ = m["command"].(string)
+			kb.Args, _ = m["args"].(map[string]interface{})
+			kbs = append(kbs, kb)
+		}
+	}
+	return kbs
+}
+
+// keybindingCommands returns every command run by the keybinding (including
+// the ones in its multi-command sequence).
+func keybindingCommands(kb *Keybinding) []*KB {
+	var commands []*KB
+	var add func(c *KB)
+	add = func(c *KB) {
+		commands = append(commands, c)
+		for _, sc := range sequenceCommands(c.Args) {
+			add(sc)
+		}
+	}
+	add(&KB{Command: kb.Command, Args: kb.Args})
+	return commands
+}
+
+// extensionDependencies returns the (sorted) extensions that provide the
+// commands run by the keybindings. Commands that start with the package name
+// are provided by the package itself, and removed keybindings don't run
+// anything, so neither add a dependency. Unknown commands are reported by
+// checkCommands.
+func extensionDependencies(er *ExtensionRegistry, name string, kbs []*Keybinding) []string {
+	deps := map[string]bool{}
+	for _, kb := range kbs {
+		if strings.HasPrefix(kb.Command, "-") {
+			continue
+		}
+		for _, c := range keybindingCommands(kb) {
+			if strings.HasPrefix(c.Command, name+".") {
+				continue
+			}
+			if id, ok := er.provider(c.Command); ok && id != "" && !slices.Contains(er.Optional, id) {
+				deps[id] = true
+			}
+		}
+	}
+	if len(deps) == 0 {
+		return nil
+	}
+	return sortedKeys(deps)
+}
+
+func groogExtensionRegistry() *ExtensionRegistry {
+	openInGitHub := "ziyasal.vscode-open-in-github"
+	return &ExtensionRegistry{
+		Extensions: map[string]string{
+			"termin-all-or-nothing.": "groogle.termin-all-or-nothing",
+			"faves.":                 "groogle.faves",
+			"go.":                    "golang.go",
+			"remote-wsl.":            "ms-vscode-remote.remote-wsl",
+
+			"extension.copyGitHubLinkToClipboard": openInGitHub,
+			"extension.openInGitHub":              openInGitHub,
+			"extension.openPrGitProvider":         openInGitHub,
+		},
+		Commands: groogCommandCatalog(),
+		Optional: []string{
+			// Only used by a couple of convenience bindings for Go files.
+			"golang.go",
+			// Only used when running in WSL.
+			"ms-vscode-remote.remote-wsl",
+			openInGitHub,
+		},
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func testExtensionRegistry() *ExtensionRegistry {
+	return &ExtensionRegistry{
+		Extensions: map[string]string{
+			"faves.":            "groogle.faves",
+			"go.":               "golang.go",
+			"go.test.coverage.": "other.coverage",
+			"extension.openIt":  "someone.open-it",
+		},
+		Commands: []*KnownCommand{
+			{ID: "editor.action.selectAll"},
+			{ID: "workbench.action.files.save"},
+			{ID: "noop"},
+			{ID: "go.test.package", Extension: "golang.go", Args: map[string]ArgType{"background": argBoolean}},
+			{ID: "go.test.file", Extension: "other.go"},
+		},
+		Optional: []string{"someone.open-it"},
+	}
+}
+
+func TestExtensionProvider(t *testing.T) {
+	for _, test := range []struct {
+		command string
+		want    string
+		wantOK  bool
+	}{
+		{command: "faves.toggle", want: "groogle.faves", wantOK: true},
+		{command: "go.test.package", want: "golang.go", wantOK: true},
+		{command: "go.test.file", want: "other.go", wantOK: true},
+		{command: "go.build", want: "golang.go", wantOK: true},
+		{command: "go.test.coverage.toggle", want: "other.coverage", wantOK: true},
+		{command: "extension.openIt", want: "someone.open-it", wantOK: true},
+		{command: "extension.openItAgain"},
+		{command: "editor.action.selectAll", wantOK: true},
+		{command: "noop", wantOK: true},
+		{command: "noopy"},
+		{command: "faves"},
+	} {
+		t.Run(test.command, func(t *testing.T) {
+			got, gotOK := testExtensionRegistry().provider(test.command)
+			if got != test.want || gotOK != test.wantOK {
+				t.Errorf("provider(%q) returned (%q, %v); want (%q, %v)", test.command, got, gotOK, test.want, test.wantOK)
+			}
+		})
+	}
+}
+
+func TestExtensionDependencies(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		kbs  []*Keybinding
+		want []string
+	}{
+		{
+			name: "no bindings",
+		},
+		{
+			name: "own and built-in commands",
+			kbs: []*Keybinding{
+				{Key: "ctrl+a", Command: "groog.cursorHome"},
+				{Key: "ctrl+b", Command: "editor.action.selectAll"},
+			},
+		},
+		{
+			name: "direct commands",
+			kbs: []*Keybinding{
+				{Key: "ctrl+a", Command: "go.test.package"},
+				{Key: "ctrl+b", Command: "faves.toggle"},
+				{Key: "ctrl+c", Command: "faves.search"},
+			},
+			want: []string{"golang.go", "groogle.faves"},
+		},
+		{
+			name: "multi-command sequences",
+			kbs: []*Keybinding{
+				mcKeybinding("ctrl+a", mc("workbench.action.files.save", "go.test.package")),
+				mcKeybinding("ctrl+b", mcWithArgs(kb("editor.action.selectAll"), mc("faves.toggle"))),
+			},
+			want: []string{"golang.go", "groogle.faves"},
+		},
+		{
+			name: "optional extensions",
+			kbs: []*Keybinding{
+				{Key: "ctrl+a", Command: "extension.openIt"},
+			},
+		},
+		{
+			name: "removed bindings",
+			kbs: []*Keybinding{
+				{Key: "ctrl+a", Command: "-faves.toggle"},
+			},
+		},
+		{
+			name: "unknown commands",
+			kbs: []*Keybinding{
+				{Key: "ctrl+a", Command: "mystery.command"},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := extensionDependencies(testExtensionRegistry(), "groog", test.kbs)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("extensionDependencies() returned incorrect value (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func mcKeybinding(key string, kb *KB) *Keybinding {
+	return &Keybinding{Key: key, Command: kb.Command, Args: kb.Args}
+}
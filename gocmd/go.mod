@@ -3,11 +3,9 @@ module example.com/clis
 go 1.18
 
 require (
+	github.com/google/go-cmp v0.5.8
 	github.com/leep-frog/command v0.0.0-20231202003652-6597a9498db9
 	golang.org/x/exp v0.0.0-20231006140011-7918f672742d
 )
 
-require (
-	github.com/google/go-cmp v0.5.8 // indirect
-	github.com/google/uuid v1.4.0 // indirect
-)
+require github.com/google/uuid v1.4.0 // indirect
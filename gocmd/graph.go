@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// The `graph` command exports the generated keybindings as a graph of context
+// keys, keys, and commands with their args (or multi-command sequences and
+// their steps), with edges labeled by when clauses. The JSON output is a
+// stable schema (see graphSchemaVersion) for other tooling, and the DOT output
+// can be rendered with Graphviz.
+
+type GraphFormat string
+
+const (
+	dotFormat  GraphFormat = "dot"
+	jsonFormat GraphFormat = "json"
+
+	// graphSchemaVersion must be incremented whenever the JSON schema changes
+	// in a way that isn't backwards compatible.
+	graphSchemaVersion = 1
+)
+
+var (
+	graphFormats = []GraphFormat{jsonFormat, dotFormat}
+)
+
+func parseGraphFormat(s string) (GraphFormat, error) {
+	for _, f := range graphFormats {
+		if string(f) == s {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unknown format %q (must be one of %v)", s, graphFormats)
+}
+
+// Node kinds
+const (
+	contextNode  = "context"
+	keyNode      = "key"
+	commandNode  = "command"
+	sequenceNode = "sequence"
+)
+
+// Edge kinds
+const (
+	// bindingEdge is from a key to the command (or sequence) it runs.
+	bindingEdge = "binding"
+	// removalEdge is from a key to the command whose binding is removed.
+	removalEdge = "removal"
+	// conditionEdge is from a context key to a key whose binding depends on it.
+	conditionEdge = "condition"
+	// stepEdge is from a sequence to a command it runs.
+	stepEdge = "step"
+)
+
+type graphNode struct {
+	ID    string `json:"id"`
+	Kind  string `json:"kind"`
+	Label string `json:"label"`
+	// Args are the args that a command node's command is run with.
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+type graphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+	When string `json:"when,omitempty"`
+	// Step is the (1-based) position of the command in the sequence.
+	Step int `json:"step,omitempty"`
+}
+
+// keybindingGraph is the graph of the keybindings.
+type keybindingGraph struct {
+	Version int          `json:"version"`
+	Nodes   []*graphNode `json:"nodes"`
+	Edges   []*graphEdge `json:"edges"`
+}
+
+// graphFilter limits the graph to the bindings for a key, that run a command,
+// or that depend on a context key (empty fields match everything).
+type graphFilter struct {
+	Key     string
+	Command string
+	Context string
+}
+
+func (gf *graphFilter) matches(kb *Keybinding, e whenExpr) bool {
+	if gf.Key != "" && kb.Key != gf.Key {
+		return false
+	}
+	if gf.Command != "" && !slices.ContainsFunc(keybindingCommands(kb), func(c *KB) bool {
+		return strings.TrimPrefix(c.Command, "-") == gf.Command
+	}) {
+		return false
+	}
+	if gf.Context != "" {
+		found := false
+		whenKeys(e, func(key string) {
+			found = found || key == gf.Context
+		})
+		return found
+	}
+	return true
+}
+
+func nodeID(kind, label string) string {
+	return fmt.Sprintf("%s:%s", kind, label)
+}
+
+// commandLabel returns the label of the command's node. The same command run
+// with different args is a different node, so the (canonical) args are part of
+// the label.
+func commandLabel(command string, args map[string]interface{}) string {
+	if len(args) == 0 {
+		return command
+	}
+	return fmt.Sprintf("%s %s", command, unicodeControlEscapes([]byte(jsonString(args))))
+}
+
+// newKeybindingGraph returns the graph of the keybindings that match the
+// filter.
+func newKeybindingGraph(kbs []*Keybinding, filter *graphFilter) (*keybindingGraph, error) {
+	nodes := map[string]*graphNode{}
+	addNode := func(kind, label string, args map[string]interface{}) string {
+		id := nodeID(kind, label)
+		nodes[id] = &graphNode{id, kind, label, args}
+		return id
+	}
+	edges := map[graphEdge]bool{}
+	addEdge := func(e graphEdge) {
+		edges[e] = true
+	}
+
+	// target adds the nodes for the command (and its sequence) and returns the
+	// ID of the command's node.
+	var target func(c *KB) string
+	target = func(c *KB) string {
+		sequence := sequenceCommands(c.Args)
+		if len(sequence) == 0 {
+			return addNode(commandNode, commandLabel(c.Command, c.Args), c.Args)
+		}
+		var labels []string
+		for _, sc := range sequence {
+			labels = append(labels, commandLabel(sc.Command, sc.Args))
+		}
+		id := addNode(sequenceNode, strings.Join(labels, ", "), nil)
+		for i, sc := range sequence {
+			addEdge(graphEdge{From: id, To: target(sc), Kind: stepEdge, Step: i + 1})
+		}
+		return id
+	}
+
+	for _, kb := range kbs {
+		e, err := parseWhen(kb.When)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse when clause %q: %v", kb.When, err)
+		}
+		if filter != nil && !filter.matches(kb, e) {
+			continue
+		}
+
+		key := addNode(keyNode, kb.Key, nil)
+		if command := strings.TrimPrefix(kb.Command, "-"); command != kb.Command {
+			addEdge(graphEdge{From: key, To: addNode(commandNode, commandLabel(command, kb.Args), kb.Args), Kind: removalEdge, When: kb.When})
+		} else {
+			addEdge(graphEdge{From: key, To: target(&KB{Command: kb.Command, Args: kb.Args}), Kind: bindingEdge, When: kb.When})
+		}
+		whenKeys(e, func(context string) {
+			addEdge(graphEdge{From: addNode(contextNode, context, nil), To: key, Kind: conditionEdge, When: kb.When})
+		})
+	}
+
+	g := &keybindingGraph{
+		Version: graphSchemaVersion,
+		Nodes:   []*graphNode{},
+		Edges:   []*graphEdge{},
+	}
+	for _, id := range sortedKeys(nodes) {
+		g.Nodes = append(g.Nodes, nodes[id])
+	}
+	for _, e := range maps.Keys(edges) {
+		e := e
+		g.Edges = append(g.Edges, &e)
+	}
+	sortFunc(g.Edges, func(a, b *graphEdge) bool {
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.When != b.When {
+			return a.When < b.When
+		}
+		return a.Step < b.Step
+	})
+	return g, nil
+}
+
+// dotQuote returns the string as a DOT quoted string.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+var (
+	dotNodeShapes = map[string]string{
+		contextNode:  "ellipse",
+		keyNode:      "box",
+		commandNode:  "box, style=rounded",
+		sequenceNode: "box, style=dashed",
+	}
+)
+
+// dot returns the graph in the Graphviz DOT language.
+func (g *keybindingGraph) dot() string {
+	r := []string{
+		"digraph keybindings {",
+		"  rankdir=LR;",
+	}
+	for _, n := range g.Nodes {
+		r = append(r, fmt.Sprintf("  %s [label=%s, shape=%s];", dotQuote(n.ID), dotQuote(n.Label), dotNodeShapes[n.Kind]))
+	}
+	for _, e := range g.Edges {
+		var attrs []string
+		switch {
+		case e.Kind == stepEdge:
+			attrs = append(attrs, fmt.Sprintf("label=%s", dotQuote(fmt.Sprint(e.Step))))
+		case e.When != "":
+			attrs = append(attrs, fmt.Sprintf("label=%s", dotQuote(e.When)))
+		}
+		switch e.Kind {
+		case removalEdge:
+			attrs = append(attrs, "style=dashed", "color=red")
+		case conditionEdge:
+			attrs = append(attrs, "style=dotted")
+		}
+		line := fmt.Sprintf("  %s -> %s", dotQuote(e.From), dotQuote(e.To))
+		if len(attrs) > 0 {
+			line += fmt.Sprintf(" [%s]", strings.Join(attrs, ", "))
+		}
+		r = append(r, line+";")
+	}
+	r = append(r, "}")
+	return strings.Join(r, "\n") + "\n"
+}
+
+func (c *cli) graph(o command.Output, d *command.Data, format GraphFormat, filter *graphFilter) error {
+	p, ds := generateGroogPackage("")
+	if err := printDiagnostics(o, ds); err != nil {
+		return err
+	}
+
+	g, err := newKeybindingGraph(p.Contributes.Keybindings, filter)
+	if err != nil {
+		return o.Err(err)
+	}
+	if format == dotFormat {
+		o.Stdout(g.dot())
+		return nil
+	}
+
+	b, err := marshalJson(g)
+	if err != nil {
+		return o.Err(err)
+	}
+	o.Stdoutln(string(b))
+	return nil
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func testGraphKeybindings() []*Keybinding {
+	return []*Keybinding{
+		{Key: "ctrl+a", Command: "groog.a", When: "a && !b"},
+		{Key: "ctrl+a", Command: "-groog.c", When: "b"},
+		{Key: "ctrl+b", Command: "groog.multiCommand.execute", Args: argsMap(MultiCommandArgs{Sequence: []*KB{kb("groog.a"), kbArgs("groog.b", map[string]interface{}{"n": 2})}})},
+		{Key: "ctrl+c", Command: "groog.b", When: "resourceLangId == 'go'"},
+		{Key: "ctrl+d", Command: "groog.a", Args: map[string]interface{}{"n": 1}},
+	}
+}
+
+func TestNewKeybindingGraph(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		kbs     []*Keybinding
+		filter  *graphFilter
+		want    *keybindingGraph
+		wantErr string
+	}{
+		{
+			name: "empty",
+			want: &keybindingGraph{
+				Version: graphSchemaVersion,
+				Nodes:   []*graphNode{},
+				Edges:   []*graphEdge{},
+			},
+		},
+		{
+			name: "all bindings",
+			kbs:  testGraphKeybindings(),
+			want: &keybindingGraph{
+				Version: graphSchemaVersion,
+				Nodes: []*graphNode{
+					{ID: "command:groog.a", Kind: commandNode, Label: "groog.a"},
+					{ID: `command:groog.a {"n":1}`, Kind: commandNode, Label: `groog.a {"n":1}`, Args: map[string]interface{}{"n": 1}},
+					{ID: "command:groog.b", Kind: commandNode, Label: "groog.b"},
+					{ID: `command:groog.b {"n":2}`, Kind: commandNode, Label: `groog.b {"n":2}`, Args: map[string]interface{}{"n": 2}},
+					{ID: "command:groog.c", Kind: commandNode, Label: "groog.c"},
+					{ID: "context:a", Kind: contextNode, Label: "a"},
+					{ID: "context:b", Kind: contextNode, Label: "b"},
+					{ID: "context:resourceLangId", Kind: contextNode, Label: "resourceLangId"},
+					{ID: "key:ctrl+a", Kind: keyNode, Label: "ctrl+a"},
+					{ID: "key:ctrl+b", Kind: keyNode, Label: "ctrl+b"},
+					{ID: "key:ctrl+c", Kind: keyNode, Label: "ctrl+c"},
+					{ID: "key:ctrl+d", Kind: keyNode, Label: "ctrl+d"},
+					{ID: `sequence:groog.a, groog.b {"n":2}`, Kind: sequenceNode, Label: `groog.a, groog.b {"n":2}`},
+				},
+				Edges: []*graphEdge{
+					{From: "context:a", To: "key:ctrl+a", Kind: conditionEdge, When: "a && !b"},
+					{From: "context:b", To: "key:ctrl+a", Kind: conditionEdge, When: "a && !b"},
+					{From: "context:b", To: "key:ctrl+a", Kind: conditionEdge, When: "b"},
+					{From: "context:resourceLangId", To: "key:ctrl+c", Kind: conditionEdge, When: "resourceLangId == 'go'"},
+					{From: "key:ctrl+a", To: "command:groog.a", Kind: bindingEdge, When: "a && !b"},
+					{From: "key:ctrl+a", To: "command:groog.c", Kind: removalEdge, When: "b"},
+					{From: "key:ctrl+b", To: `sequence:groog.a, groog.b {"n":2}`, Kind: bindingEdge},
+					{From: "key:ctrl+c", To: "command:groog.b", Kind: bindingEdge, When: "resourceLangId == 'go'"},
+					{From: "key:ctrl+d", To: `command:groog.a {"n":1}`, Kind: bindingEdge},
+					{From: `sequence:groog.a, groog.b {"n":2}`, To: "command:groog.a", Kind: stepEdge, Step: 1},
+					{From: `sequence:groog.a, groog.b {"n":2}`, To: `command:groog.b {"n":2}`, Kind: stepEdge, Step: 2},
+				},
+			},
+		},
+		{
+			name:   "filter by key",
+			kbs:    testGraphKeybindings(),
+			filter: &graphFilter{Key: "ctrl+c"},
+			want: &keybindingGraph{
+				Version: graphSchemaVersion,
+				Nodes: []*graphNode{
+					{ID: "command:groog.b", Kind: commandNode, Label: "groog.b"},
+					{ID: "context:resourceLangId", Kind: contextNode, Label: "resourceLangId"},
+					{ID: "key:ctrl+c", Kind: keyNode, Label: "ctrl+c"},
+				},
+				Edges: []*graphEdge{
+					{From: "context:resourceLangId", To: "key:ctrl+c", Kind: conditionEdge, When: "resourceLangId == 'go'"},
+					{From: "key:ctrl+c", To: "command:groog.b", Kind: bindingEdge, When: "resourceLangId == 'go'"},
+				},
+			},
+		},
+		{
+			name:   "filter by command",
+			kbs:    testGraphKeybindings(),
+			filter: &graphFilter{Command: "groog.b"},
+			want: &keybindingGraph{
+				Version: graphSchemaVersion,
+				Nodes: []*graphNode{
+					{ID: "command:groog.a", Kind: commandNode, Label: "groog.a"},
+					{ID: "command:groog.b", Kind: commandNode, Label: "groog.b"},
+					{ID: `command:groog.b {"n":2}`, Kind: commandNode, Label: `groog.b {"n":2}`, Args: map[string]interface{}{"n": 2}},
+					{ID: "context:resourceLangId", Kind: contextNode, Label: "resourceLangId"},
+					{ID: "key:ctrl+b", Kind: keyNode, Label: "ctrl+b"},
+					{ID: "key:ctrl+c", Kind: keyNode, Label: "ctrl+c"},
+					{ID: `sequence:groog.a, groog.b {"n":2}`, Kind: sequenceNode, Label: `groog.a, groog.b {"n":2}`},
+				},
+				Edges: []*graphEdge{
+					{From: "context:resourceLangId", To: "key:ctrl+c", Kind: conditionEdge, When: "resourceLangId == 'go'"},
+					{From: "key:ctrl+b", To: `sequence:groog.a, groog.b {"n":2}`, Kind: bindingEdge},
+					{From: "key:ctrl+c", To: "command:groog.b", Kind: bindingEdge, When: "resourceLangId == 'go'"},
+					{From: `sequence:groog.a, groog.b {"n":2}`, To: "command:groog.a", Kind: stepEdge, Step: 1},
+					{From: `sequence:groog.a, groog.b {"n":2}`, To: `command:groog.b {"n":2}`, Kind: stepEdge, Step: 2},
+				},
+			},
+		},
+		{
+			name:   "filter by removed command",
+			kbs:    testGraphKeybindings(),
+			filter: &graphFilter{Command: "groog.c"},
+			want: &keybindingGraph{
+				Version: graphSchemaVersion,
+				Nodes: []*graphNode{
+					{ID: "command:groog.c", Kind: commandNode, Label: "groog.c"},
+					{ID: "context:b", Kind: contextNode, Label: "b"},
+					{ID: "key:ctrl+a", Kind: keyNode, Label: "ctrl+a"},
+				},
+				Edges: []*graphEdge{
+					{From: "context:b", To: "key:ctrl+a", Kind: conditionEdge, When: "b"},
+					{From: "key:ctrl+a", To: "command:groog.c", Kind: removalEdge, When: "b"},
+				},
+			},
+		},
+		{
+			name:   "filter by context",
+			kbs:    testGraphKeybindings(),
+			filter: &graphFilter{Key: "ctrl+a", Context: "a"},
+			want: &keybindingGraph{
+				Version: graphSchemaVersion,
+				Nodes: []*graphNode{
+					{ID: "command:groog.a", Kind: commandNode, Label: "groog.a"},
+					{ID: "context:a", Kind: contextNode, Label: "a"},
+					{ID: "context:b", Kind: contextNode, Label: "b"},
+					{ID: "key:ctrl+a", Kind: keyNode, Label: "ctrl+a"},
+				},
+				Edges: []*graphEdge{
+					{From: "context:a", To: "key:ctrl+a", Kind: conditionEdge, When: "a && !b"},
+					{From: "context:b", To: "key:ctrl+a", Kind: conditionEdge, When: "a && !b"},
+					{From: "key:ctrl+a", To: "command:groog.a", Kind: bindingEdge, When: "a && !b"},
+				},
+			},
+		},
+		{
+			name: "invalid when clause",
+			kbs: []*Keybinding{
+				{Key: "ctrl+a", Command: "groog.a", When: "(a"},
+			},
+			wantErr: `failed to parse when clause "(a": column 3: missing closing parenthesis`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := newKeybindingGraph(test.kbs, test.filter)
+			var gotErr string
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr); diff != "" {
+				t.Errorf("newKeybindingGraph() returned incorrect error (-want, +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("newKeybindingGraph() returned incorrect value (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestKeybindingGraphJSON(t *testing.T) {
+	// Other tooling depends on this schema, so changes to it must increment
+	// graphSchemaVersion.
+	g, err := newKeybindingGraph(testGraphKeybindings(), &graphFilter{Key: "ctrl+b"})
+	if err != nil {
+		t.Fatalf("newKeybindingGraph() returned error: %v", err)
+	}
+	got, err := marshalJson(g)
+	if err != nil {
+		t.Fatalf("marshalJson() returned error: %v", err)
+	}
+	want := strings.Join([]string{
+		`{`,
+		`  "version": 1,`,
+		`  "nodes": [`,
+		`    {`,
+		`      "id": "command:groog.a",`,
+		`      "kind": "command",`,
+		`      "label": "groog.a"`,
+		`    },`,
+		`    {`,
+		`      "id": "command:groog.b {\"n\":2}",`,
+		`      "kind": "command",`,
+		`      "label": "groog.b {\"n\":2}",`,
+		`      "args": {`,
+		`        "n": 2`,
+		`      }`,
+		`    },`,
+		`    {`,
+		`      "id": "key:ctrl+b",`,
+		`      "kind": "key",`,
+		`      "label": "ctrl+b"`,
+		`    },`,
+		`    {`,
+		`      "id": "sequence:groog.a, groog.b {\"n\":2}",`,
+		`      "kind": "sequence",`,
+		`      "label": "groog.a, groog.b {\"n\":2}"`,
+		`    }`,
+		`  ],`,
+		`  "edges": [`,
+		`    {`,
+		`      "from": "key:ctrl+b",`,
+		`      "to": "sequence:groog.a, groog.b {\"n\":2}",`,
+		`      "kind": "binding"`,
+		`    },`,
+		`    {`,
+		`      "from": "sequence:groog.a, groog.b {\"n\":2}",`,
+		`      "to": "command:groog.a",`,
+		`      "kind": "step",`,
+		`      "step": 1`,
+		`    },`,
+		`    {`,
+		`      "from": "sequence:groog.a, groog.b {\"n\":2}",`,
+		`      "to": "command:groog.b {\"n\":2}",`,
+		`      "kind": "step",`,
+		`      "step": 2`,
+		`    }`,
+		`  ]`,
+		`}`,
+		``,
+	}, "\n")
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("marshalJson(graph) returned incorrect value (-want, +got):\n%s", diff)
+	}
+}
+
+func TestKeybindingGraphDot(t *testing.T) {
+	g := &keybindingGraph{
+		Nodes: []*graphNode{
+			{ID: "command:groog.a", Kind: commandNode, Label: "groog.a"},
+			{ID: "context:resourceFilename", Kind: contextNode, Label: "resourceFilename"},
+			{ID: "key:ctrl+a", Kind: keyNode, Label: "ctrl+a"},
+			{ID: "sequence:groog.a", Kind: sequenceNode, Label: "groog.a"},
+		},
+		Edges: []*graphEdge{
+			{From: "context:resourceFilename", To: "key:ctrl+a", Kind: conditionEdge, When: `resourceFilename =~ /\.go$/`},
+			{From: "key:ctrl+a", To: "command:groog.a", Kind: bindingEdge},
+			{From: "key:ctrl+a", To: "command:groog.a", Kind: removalEdge, When: "a"},
+			{From: "sequence:groog.a", To: "command:groog.a", Kind: stepEdge, Step: 1},
+		},
+	}
+	want := strings.Join([]string{
+		`digraph keybindings {`,
+		`  rankdir=LR;`,
+		`  "command:groog.a" [label="groog.a", shape=box, style=rounded];`,
+		`  "context:resourceFilename" [label="resourceFilename", shape=ellipse];`,
+		`  "key:ctrl+a" [label="ctrl+a", shape=box];`,
+		`  "sequence:groog.a" [label="groog.a", shape=box, style=dashed];`,
+		`  "context:resourceFilename" -> "key:ctrl+a" [label="resourceFilename =~ /\\.go$/", style=dotted];`,
+		`  "key:ctrl+a" -> "command:groog.a";`,
+		`  "key:ctrl+a" -> "command:groog.a" [label="a", style=dashed, color=red];`,
+		`  "sequence:groog.a" -> "command:groog.a" [label="1"];`,
+		`}`,
+		``,
+	}, "\n")
+	if diff := cmp.Diff(want, g.dot()); diff != "" {
+		t.Errorf("keybindingGraph.dot() returned incorrect value (-want, +got):\n%s", diff)
+	}
+}
+
+func TestParseGraphFormat(t *testing.T) {
+	if got, err := parseGraphFormat("dot"); err != nil || got != dotFormat {
+		t.Errorf("parseGraphFormat(dot) returned (%q, %v); want (%q, nil)", got, err, dotFormat)
+	}
+
+	wantErr := `unknown format "svg" (must be one of [json dot])`
+	if _, err := parseGraphFormat("svg"); err == nil || err.Error() != wantErr {
+		t.Errorf("parseGraphFormat(svg) returned error %v; want %q", err, wantErr)
+	}
+}
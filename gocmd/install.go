@@ -0,0 +1,373 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/leep-frog/command/command"
+	"golang.org/x/exp/slices"
+)
+
+// VS Code installs each extension in `<extensions dir>/<publisher>.<name>-<version>`
+// and keeps track of the installed extensions in `<extensions dir>/extensions.json`.
+// Installing here mirrors that layout so the extension can be tested against
+// any (e.g. portable or throwaway) extensions directory.
+
+const (
+	extensionsRegistryFile = "extensions.json"
+)
+
+// extensionsDir returns the provided extensions directory or, if empty, the
+// one used by VS Code.
+func extensionsDir(dir string) (string, error) {
+	if dir != "" {
+		return dir, nil
+	}
+	if dir := os.Getenv("VSCODE_EXTENSIONS"); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %v", err)
+	}
+	return filepath.Join(home, ".vscode", "extensions"), nil
+}
+
+// extensionID returns the identifier VS Code uses for the package.
+func extensionID(p *Package) string {
+	return strings.ToLower(fmt.Sprintf("%s.%s", p.Publisher, p.Name))
+}
+
+// extensionFS returns the extension's files in a VSIX (or in a directory with
+// the same layout as one) or in an extension directory.
+func extensionFS(fsys fs.FS) (fs.FS, error) {
+	if _, err := fs.Stat(fsys, path.Join(vsixExtensionDir, "package.json")); err == nil {
+		return fs.Sub(fsys, vsixExtensionDir)
+	}
+	if _, err := fs.Stat(fsys, "package.json"); err == nil {
+		return fsys, nil
+	}
+	return nil, fmt.Errorf("no package.json found in the extension")
+}
+
+// readExtensionPackage returns the package.json for the extension files.
+func readExtensionPackage(ext fs.FS) (*Package, error) {
+	b, err := fs.ReadFile(ext, "package.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read package.json: %v", err)
+	}
+	p := &Package{}
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("failed to parse package.json: %v", err)
+	}
+	if p.Publisher == "" || p.Name == "" || p.Version == "" {
+		return nil, fmt.Errorf("package.json must set publisher, name, and version")
+	}
+	return p, nil
+}
+
+// copyFS copies all of the files in fsys into dir.
+func copyFS(fsys fs.FS, dir string) error {
+	return fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(dir, filepath.FromSlash(p))
+		if d.IsDir() {
+			return os.MkdirAll(dest, 0755)
+		}
+		b, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(dest, b, 0644)
+	})
+}
+
+// installedExtension is an installed version of an extension.
+type installedExtension struct {
+	Dir     string
+	Version *Version
+}
+
+// installedVersions returns the versions of the extension that are installed
+// in the extensions directory, oldest first.
+func installedVersions(extensionsDir, id string) ([]*installedExtension, error) {
+	entries, err := os.ReadDir(extensionsDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read extensions directory: %v", err)
+	}
+
+	var r []*installedExtension
+	for _, e := range entries {
+		name := strings.ToLower(e.Name())
+		if !e.IsDir() || !strings.HasPrefix(name, id+"-") {
+			continue
+		}
+		v, err := parseVersion(strings.TrimPrefix(name, id+"-"))
+		if err != nil {
+			// Not one of ours (e.g. groogle.groog-other)
+			continue
+		}
+		r = append(r, &installedExtension{e.Name(), v})
+	}
+	sortFunc(r, func(a, b *installedExtension) bool {
+		return a.Version.Compare(b.Version) < 0
+	})
+	return r, nil
+}
+
+// readExtensionsRegistry returns the entries in extensions.json. The entries
+// are kept as generic json so fields we don't know about are preserved.
+func readExtensionsRegistry(extensionsDir string) ([]map[string]interface{}, error) {
+	b, err := os.ReadFile(filepath.Join(extensionsDir, extensionsRegistryFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", extensionsRegistryFile, err)
+	}
+	if len(bytes.TrimSpace(b)) == 0 {
+		return nil, nil
+	}
+
+	var entries []map[string]interface{}
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", extensionsRegistryFile, err)
+	}
+	return entries, nil
+}
+
+func writeExtensionsRegistry(extensionsDir string, entries []map[string]interface{}) error {
+	if entries == nil {
+		entries = []map[string]interface{}{}
+	}
+	b, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %v", extensionsRegistryFile, err)
+	}
+	if err := os.WriteFile(filepath.Join(extensionsDir, extensionsRegistryFile), b, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", extensionsRegistryFile, err)
+	}
+	return nil
+}
+
+// registryID returns the extension identifier of a registry entry.
+func registryID(entry map[string]interface{}) string {
+	identifier, _ := entry["identifier"].(map[string]interface{})
+	id, _ := identifier["id"].(string)
+	return strings.ToLower(id)
+}
+
+// registryEntry returns the extensions.json entry for an installed extension.
+func registryEntry(extensionsDir, id, version, relativeLocation string, installed time.Time) map[string]interface{} {
+	location := filepath.ToSlash(filepath.Join(extensionsDir, relativeLocation))
+	if !strings.HasPrefix(location, "/") {
+		// Windows paths (e.g. C:/Users/...)
+		location = "/" + location
+	}
+	return map[string]interface{}{
+		"identifier": map[string]interface{}{
+			"id": id,
+		},
+		"version": version,
+		"location": map[string]interface{}{
+			"$mid":   1,
+			"path":   location,
+			"scheme": "file",
+		},
+		"relativeLocation": relativeLocation,
+		"metadata": map[string]interface{}{
+			"installedTimestamp": installed.UnixMilli(),
+			"source":             "vsix",
+		},
+	}
+}
+
+// removeExtension removes every installed version of the extension except for
+// the one in keepDir (if provided) and returns the removed directories.
+func removeExtension(extensionsDir, id, keepDir string) ([]string, error) {
+	installed, err := installedVersions(extensionsDir, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, ie := range installed {
+		if ie.Dir == keepDir {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(extensionsDir, ie.Dir)); err != nil {
+			return removed, fmt.Errorf("failed to remove %s: %v", ie.Dir, err)
+		}
+		removed = append(removed, ie.Dir)
+	}
+
+	entries, err := readExtensionsRegistry(extensionsDir)
+	if err != nil {
+		return removed, err
+	}
+	n := len(entries)
+	entries = slices.DeleteFunc(entries, func(e map[string]interface{}) bool {
+		return registryID(e) == id && e["relativeLocation"] != keepDir
+	})
+	if len(entries) == n {
+		return removed, nil
+	}
+	return removed, writeExtensionsRegistry(extensionsDir, entries)
+}
+
+// installExtension copies the extension files into the extensions directory,
+// registers it in extensions.json, and removes all other installed versions.
+// It returns the installed package and the removed directories.
+func installExtension(extensionsDir string, src fs.FS, installed time.Time) (*Package, []string, error) {
+	ext, err := extensionFS(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := readExtensionPackage(ext)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	id := extensionID(p)
+	dir := fmt.Sprintf("%s-%s", id, p.Version)
+	dest := filepath.Join(extensionsDir, dir)
+	if err := os.RemoveAll(dest); err != nil {
+		return nil, nil, fmt.Errorf("failed to remove existing installation: %v", err)
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create extension directory: %v", err)
+	}
+	if err := copyFS(ext, dest); err != nil {
+		return nil, nil, fmt.Errorf("failed to copy extension files: %v", err)
+	}
+
+	removed, err := removeExtension(extensionsDir, id, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entries, err := readExtensionsRegistry(extensionsDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	entries = slices.DeleteFunc(entries, func(e map[string]interface{}) bool {
+		return registryID(e) == id
+	})
+	entries = append(entries, registryEntry(extensionsDir, id, p.Version, dir, installed))
+	if err := writeExtensionsRegistry(extensionsDir, entries); err != nil {
+		return nil, nil, err
+	}
+	return p, removed, nil
+}
+
+// listExtension returns a line for each installed version of the extension.
+func listExtension(extensionsDir, id string) ([]string, error) {
+	installed, err := installedVersions(extensionsDir, id)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := readExtensionsRegistry(extensionsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	registered := map[string]bool{}
+	for _, e := range entries {
+		if loc, ok := e["relativeLocation"].(string); ok && registryID(e) == id {
+			registered[loc] = true
+		}
+	}
+
+	var lines []string
+	for _, ie := range installed {
+		line := fmt.Sprintf("%s %s", id, ie.Version)
+		if !registered[ie.Dir] {
+			line += " (not registered in extensions.json)"
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// extensionSource returns the files for the extension at the provided path
+// (a VSIX or a directory). If the path is empty, the VSIX is built in memory.
+func (c *cli) extensionSource(o command.Output, d *command.Data, source string) (fs.FS, error) {
+	if source == "" {
+		_, b, err := c.buildVSIX(o, d)
+		if err != nil {
+			return nil, err
+		}
+		return zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	}
+
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return os.DirFS(source), nil
+	}
+	b, err := os.ReadFile(source)
+	if err != nil {
+		return nil, err
+	}
+	return zip.NewReader(bytes.NewReader(b), int64(len(b)))
+}
+
+func (c *cli) install(o command.Output, d *command.Data, extensionsDir, source string) error {
+	src, err := c.extensionSource(o, d, source)
+	if err != nil {
+		return o.Annotatef(err, "failed to load extension")
+	}
+	p, removed, err := installExtension(extensionsDir, src, time.Now())
+	if err != nil {
+		return o.Err(err)
+	}
+	for _, r := range removed {
+		o.Stdoutf("Removed %s\n", r)
+	}
+	o.Stdoutf("Successfully installed %s %s in %s\n", extensionID(p), p.Version, extensionsDir)
+	return nil
+}
+
+func (c *cli) uninstall(o command.Output, d *command.Data, extensionsDir string) error {
+	removed, err := removeExtension(extensionsDir, extensionID(groogBase()), "")
+	if err != nil {
+		return o.Err(err)
+	}
+	if len(removed) == 0 {
+		o.Stdoutf("%s is not installed in %s\n", extensionID(groogBase()), extensionsDir)
+		return nil
+	}
+	for _, r := range removed {
+		o.Stdoutf("Removed %s\n", r)
+	}
+	return nil
+}
+
+func (c *cli) list(o command.Output, d *command.Data, extensionsDir string) error {
+	lines, err := listExtension(extensionsDir, extensionID(groogBase()))
+	if err != nil {
+		return o.Err(err)
+	}
+	if len(lines) == 0 {
+		o.Stdoutf("%s is not installed in %s\n", extensionID(groogBase()), extensionsDir)
+	}
+	for _, line := range lines {
+		o.Stdoutln(line)
+	}
+	return nil
+}
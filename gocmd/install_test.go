@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func testExtensionPackageJSON(version string) []byte {
+	return []byte(`{"name": "groog", "publisher": "groogle", "version": "` + version + `"}`)
+}
+
+// writeTestFiles creates the files (relative to dir) with the provided contents.
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+}
+
+// readTestFiles returns the contents of all files in dir.
+func readTestFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = string(b)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", dir, err)
+	}
+	return files
+}
+
+func TestInstallExtension(t *testing.T) {
+	installed := time.UnixMilli(1700000000000)
+	otherEntry := `{"identifier":{"id":"other.ext"},"relativeLocation":"other.ext-1.0.0","version":"1.0.0"}`
+
+	for _, test := range []struct {
+		name        string
+		existing    map[string]string
+		src         fstest.MapFS
+		want        map[string]string
+		wantVersion string
+		wantRemoved []string
+		wantErr     string
+	}{
+		{
+			name: "installs vsix layout",
+			src: fstest.MapFS{
+				"[Content_Types].xml":        {Data: []byte("types")},
+				"extension.vsixmanifest":     {Data: []byte("manifest")},
+				"extension/package.json":     {Data: testExtensionPackageJSON("2.6.3")},
+				"extension/out/extension.js": {Data: []byte("js")},
+			},
+			want: map[string]string{
+				"groogle.groog-2.6.3/package.json":     string(testExtensionPackageJSON("2.6.3")),
+				"groogle.groog-2.6.3/out/extension.js": "js",
+				"extensions.json":                      `[{"identifier":{"id":"groogle.groog"},"location":{"$mid":1,"path":"/EXT/groogle.groog-2.6.3","scheme":"file"},"metadata":{"installedTimestamp":1700000000000,"source":"vsix"},"relativeLocation":"groogle.groog-2.6.3","version":"2.6.3"}]`,
+			},
+			wantVersion: "2.6.3",
+		},
+		{
+			name: "installs extension directory",
+			src: fstest.MapFS{
+				"package.json":     {Data: testExtensionPackageJSON("2.6.3")},
+				"out/extension.js": {Data: []byte("js")},
+			},
+			want: map[string]string{
+				"groogle.groog-2.6.3/package.json":     string(testExtensionPackageJSON("2.6.3")),
+				"groogle.groog-2.6.3/out/extension.js": "js",
+				"extensions.json":                      `[{"identifier":{"id":"groogle.groog"},"location":{"$mid":1,"path":"/EXT/groogle.groog-2.6.3","scheme":"file"},"metadata":{"installedTimestamp":1700000000000,"source":"vsix"},"relativeLocation":"groogle.groog-2.6.3","version":"2.6.3"}]`,
+			},
+			wantVersion: "2.6.3",
+		},
+		{
+			name: "replaces other versions and keeps other extensions",
+			existing: map[string]string{
+				"groogle.groog-2.6.2/package.json":   "old",
+				"groogle.groog-2.6.3/stale.js":       "stale",
+				"groogle.groog-notaversion/keep.txt": "keep",
+				"other.ext-1.0.0/package.json":       "other",
+				"extensions.json":                    `[` + otherEntry + `,{"identifier":{"id":"groogle.groog"},"relativeLocation":"groogle.groog-2.6.2","version":"2.6.2"}]`,
+			},
+			src: fstest.MapFS{
+				"extension/package.json": {Data: testExtensionPackageJSON("2.6.3")},
+			},
+			want: map[string]string{
+				"groogle.groog-2.6.3/package.json":   string(testExtensionPackageJSON("2.6.3")),
+				"groogle.groog-notaversion/keep.txt": "keep",
+				"other.ext-1.0.0/package.json":       "other",
+				"extensions.json":                    `[` + otherEntry + `,{"identifier":{"id":"groogle.groog"},"location":{"$mid":1,"path":"/EXT/groogle.groog-2.6.3","scheme":"file"},"metadata":{"installedTimestamp":1700000000000,"source":"vsix"},"relativeLocation":"groogle.groog-2.6.3","version":"2.6.3"}]`,
+			},
+			wantVersion: "2.6.3",
+			wantRemoved: []string{"groogle.groog-2.6.2"},
+		},
+		{
+			name: "no package.json",
+			src: fstest.MapFS{
+				"out/extension.js": {Data: []byte("js")},
+			},
+			want:    map[string]string{},
+			wantErr: "no package.json found in the extension",
+		},
+		{
+			name: "incomplete package.json",
+			src: fstest.MapFS{
+				"package.json": {Data: []byte(`{"name": "groog"}`)},
+			},
+			want:    map[string]string{},
+			wantErr: "package.json must set publisher, name, and version",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestFiles(t, dir, test.existing)
+
+			p, removed, err := installExtension(dir, test.src, installed)
+			var gotErr string
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr); diff != "" {
+				t.Errorf("installExtension() returned incorrect error (-want, +got):\n%s", diff)
+			}
+			var gotVersion string
+			if p != nil {
+				gotVersion = p.Version
+			}
+			if diff := cmp.Diff(test.wantVersion, gotVersion); diff != "" {
+				t.Errorf("installExtension() returned incorrect version (-want, +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(test.wantRemoved, removed); diff != "" {
+				t.Errorf("installExtension() returned incorrect removed directories (-want, +got):\n%s", diff)
+			}
+
+			want := map[string]string{}
+			location, err := json.Marshal(filepath.ToSlash(dir))
+			if err != nil {
+				t.Fatalf("failed to marshal directory: %v", err)
+			}
+			for k, v := range test.want {
+				want[k] = strings.ReplaceAll(v, `"/EXT`, strings.TrimSuffix(string(location), `"`))
+			}
+			if diff := cmp.Diff(want, readTestFiles(t, dir)); diff != "" {
+				t.Errorf("installExtension() resulted in incorrect files (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUninstallAndListExtension(t *testing.T) {
+	otherEntry := `{"identifier":{"id":"other.ext"},"relativeLocation":"other.ext-1.0.0","version":"1.0.0"}`
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"groogle.groog-2.10.0/package.json": "new",
+		"groogle.groog-2.9.1/package.json":  "old",
+		"other.ext-1.0.0/package.json":      "other",
+		"extensions.json":                   `[` + otherEntry + `,{"identifier":{"id":"Groogle.groog"},"relativeLocation":"groogle.groog-2.10.0","version":"2.10.0"}]`,
+	})
+
+	gotList, err := listExtension(dir, "groogle.groog")
+	if err != nil {
+		t.Fatalf("listExtension() returned error: %v", err)
+	}
+	wantList := []string{
+		"groogle.groog 2.9.1 (not registered in extensions.json)",
+		"groogle.groog 2.10.0",
+	}
+	if diff := cmp.Diff(wantList, gotList); diff != "" {
+		t.Errorf("listExtension() returned incorrect value (-want, +got):\n%s", diff)
+	}
+
+	removed, err := removeExtension(dir, "groogle.groog", "")
+	if err != nil {
+		t.Fatalf("removeExtension() returned error: %v", err)
+	}
+	if diff := cmp.Diff([]string{"groogle.groog-2.9.1", "groogle.groog-2.10.0"}, removed); diff != "" {
+		t.Errorf("removeExtension() returned incorrect removed directories (-want, +got):\n%s", diff)
+	}
+	wantFiles := map[string]string{
+		"other.ext-1.0.0/package.json": "other",
+		"extensions.json":              `[` + otherEntry + `]`,
+	}
+	if diff := cmp.Diff(wantFiles, readTestFiles(t, dir)); diff != "" {
+		t.Errorf("removeExtension() resulted in incorrect files (-want, +got):\n%s", diff)
+	}
+
+	gotList, err = listExtension(dir, "groogle.groog")
+	if err != nil {
+		t.Fatalf("listExtension() returned error: %v", err)
+	}
+	if len(gotList) != 0 {
+		t.Errorf("listExtension() after uninstall returned %v; want none", gotList)
+	}
+}
+
+func TestRemoveExtensionMissingDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "missing")
+	removed, err := removeExtension(dir, "groogle.groog", "")
+	if err != nil {
+		t.Fatalf("removeExtension() returned error: %v", err)
+	}
+	if len(removed) != 0 {
+		t.Errorf("removeExtension() returned %v; want none", removed)
+	}
+}
@@ -13,6 +13,8 @@ type WhenContext struct {
 	value           string
 	singleValue     bool
 	comparisonValue bool
+	// negation is the negated comparison (only set for comparisons).
+	negation string
 }
 
 func (wc *WhenContext) and(that *WhenContext) *WhenContext {
@@ -20,6 +22,7 @@ func (wc *WhenContext) and(that *WhenContext) *WhenContext {
 		fmt.Sprintf("%s && %s", wc.value, that.value),
 		false,
 		false,
+		"",
 	}
 }
 
@@ -28,46 +31,163 @@ func (wc *WhenContext) or(that *WhenContext) *WhenContext {
 		fmt.Sprintf("%s || %s", wc.value, that.value),
 		false,
 		false,
+		"",
 	}
 }
 
+// not negates the when context. Only single values and comparisons can be
+// negated (checkWhen reports any other negation).
 func (wc *WhenContext) not() *WhenContext {
-	if !wc.singleValue {
-		panic("Can only negate a single when context")
-	}
 	if wc.comparisonValue {
-		panic("Can't negate a comparison context")
+		return &WhenContext{wc.negation, false, true, wc.value}
+	}
+	if !wc.singleValue {
+		return &WhenContext{
+			fmt.Sprintf("!(%s)", wc.value),
+			false,
+			false,
+			"",
+		}
 	}
 	return &WhenContext{
 		fmt.Sprintf("!%s", wc.value),
 		false,
 		false,
+		"",
 	}
 }
 
 func wc(s string) *WhenContext {
-	return &WhenContext{s, true, false}
+	return &WhenContext{s, true, false, ""}
 }
 
 // See the following link for language codes: https://code.visualstudio.com/docs/languages/identifiers
 func whenFileType(languageId string) *WhenContext {
-	return wcCmp("resourceLangId", languageId, true)
+	return wcCmp("resourceLangId", opEq, languageId)
 }
 
 func whenNotFileType(languageId string) *WhenContext {
-	return wcCmp("resourceLangId", languageId, false)
+	return wcCmp("resourceLangId", opNotEq, languageId)
 }
 
-func wcCmp(key, value string, eql bool) *WhenContext {
-	op := "!="
-	if eql {
-		op = "=="
+// whenFileTypeIn is true when the file is any of the languages. A regular
+// expression is used (rather than an or) so the result is still a single
+// comparison that can be negated or and-ed.
+func whenFileTypeIn(languageIds ...string) *WhenContext {
+	var quoted []string
+	for _, l := range languageIds {
+		quoted = append(quoted, regexp.QuoteMeta(l))
 	}
-	return &WhenContext{
-		fmt.Sprintf("%s %s %v", key, op, value),
-		false,
-		true,
+	return wcCmp("resourceLangId", opMatch, regexp.MustCompile(fmt.Sprintf("^(%s)$", strings.Join(quoted, "|"))))
+}
+
+// whenEditorLang is true when the language of the active editor is
+// languageId (unlike whenFileType, this also works for untitled files).
+func whenEditorLang(languageId string) *WhenContext {
+	return wcCmp("editorLangId", opEq, languageId)
+}
+
+// whenOp is a when clause comparison operator (see
+// https://code.visualstudio.com/api/references/when-clause-contexts#conditional-operators).
+type whenOp string
+
+const (
+	opEq    whenOp = "=="
+	opNotEq whenOp = "!="
+	opMatch whenOp = "=~"
+	opIn    whenOp = "in"
+	opNotIn whenOp = "not in"
+	opLt    whenOp = "<"
+	opLte   whenOp = "<="
+	opGt    whenOp = ">"
+	opGte   whenOp = ">="
+)
+
+// whenOpNegations are the operators whose negation is another operator.
+// Others (e.g. the numeric operators, which are all false for undefined
+// keys) are negated with !(...).
+var whenOpNegations = map[whenOp]whenOp{
+	opEq:    opNotEq,
+	opNotEq: opEq,
+	opIn:    opNotIn,
+	opNotIn: opIn,
+}
+
+// wcCmp compares the context key to the value. The value must be a string,
+// number, or bool for == and !=, a number for the numeric operators, a
+// *regexp.Regexp for =~, and the name of another context key for in and
+// not in. Invalid values are left out of the comparison, so checkWhen
+// rejects the clause.
+func wcCmp(key string, op whenOp, value interface{}) *WhenContext {
+	v, err := formatWhenValue(op, value)
+	if err != nil {
+		v = ""
+	}
+
+	cmp := fmt.Sprintf("%s %s %s", key, op, v)
+	negation := fmt.Sprintf("!(%s)", cmp)
+	if nop, ok := whenOpNegations[op]; ok {
+		negation = fmt.Sprintf("%s %s %s", key, nop, v)
+	}
+	return &WhenContext{cmp, false, true, negation}
+}
+
+// formatWhenValue returns the value as it should appear in a when clause
+// comparison with the operator.
+func formatWhenValue(op whenOp, value interface{}) (string, error) {
+	switch op {
+	case opMatch:
+		re, ok := value.(*regexp.Regexp)
+		if !ok {
+			return fmt.Sprint(value), fmt.Errorf("%s requires a *regexp.Regexp", op)
+		}
+		return formatWhenRegexp(re), nil
+	case opIn, opNotIn:
+		key, ok := value.(string)
+		if !ok || !whenIdentifierRegex.MatchString(key) || whenIdentifierRegex.FindString(key) != key {
+			return fmt.Sprint(value), fmt.Errorf("%s requires a context key", op)
+		}
+		return key, nil
+	case opLt, opLte, opGt, opGte:
+		switch value.(type) {
+		case int, float64:
+			return fmt.Sprint(value), nil
+		}
+		return fmt.Sprint(value), fmt.Errorf("%s requires a number", op)
+	case opEq, opNotEq:
+		switch v := value.(type) {
+		case int, float64, bool:
+			return fmt.Sprint(v), nil
+		case string:
+			// VS Code doesn't support escapes in quoted strings.
+			if strings.Contains(v, "'") {
+				return fmt.Sprintf("'%s'", v), fmt.Errorf("string values can't contain single quotes")
+			}
+			return fmt.Sprintf("'%s'", v), nil
+		}
+		return fmt.Sprint(value), fmt.Errorf("%s requires a string, number, or bool", op)
+	}
+	return fmt.Sprint(value), fmt.Errorf("unknown operator")
+}
+
+// formatWhenRegexp returns the regular expression literal for the regexp. A
+// leading case-insensitive flag is converted to the JavaScript flag, and
+// slashes are escaped.
+func formatWhenRegexp(re *regexp.Regexp) string {
+	pattern, flags := re.String(), ""
+	if strings.HasPrefix(pattern, "(?i)") {
+		pattern, flags = strings.TrimPrefix(pattern, "(?i)"), "i"
 	}
+	var r strings.Builder
+	escaped := false
+	for _, c := range pattern {
+		if c == '/' && !escaped {
+			r.WriteRune('\\')
+		}
+		escaped = c == '\\' && !escaped
+		r.WriteRune(c)
+	}
+	return fmt.Sprintf("/%s/%s", r.String(), flags)
 }
 
 func groogContext(mode string) string {
@@ -83,12 +203,33 @@ func delay(n int) *int {
 	return &n
 }
 
+// withAsync sets the command to run asynchronously in a multi-command.
+func withAsync(kb *KB) *KB {
+	kb.Async = async(true)
+	return kb
+}
+
+// withDelay sets the command to run after a delay (in milliseconds) in a
+// multi-command.
+func withDelay(kb *KB, n int) *KB {
+	kb.Delay = delay(n)
+	return kb
+}
+
+// withPriority sets the priority of the binding over other bindings for the
+// same key.
+func withPriority(kb *KB, priority int) *KB {
+	kb.Priority = priority
+	return kb
+}
+
 var (
 	// When contexts
 	activePanel             = wc("activePanel")
 	always                  = wc("")
 	editorFocus             = wc("editorFocus")
 	editorTextFocus         = wc("editorTextFocus")
+	explorerFocus           = wc("filesExplorerFocus")
 	findWidgetVisible       = wc("findWidgetVisible")
 	findInputFocussed       = wc("findInputFocussed")
 	inputFocus              = wc("inputFocus")
@@ -160,29 +301,36 @@ const (
 	space     = "space"
 )
 
-func kbDefsToBindings() []*Keybinding {
+// kbDefsToBindings converts the keybinding definitions and removals into the
+// list of keybindings for package.json. The provided maps are not modified.
+func kbDefsToBindings(ds *Diagnostics, kbDefs map[Key]map[string]*KB, removals map[Key][]*Removal) []*Keybinding {
+	kbDefs = maps.Clone(kbDefs)
+
 	// First add overrides when not in text editor
 	for ci, c := range characters {
 		k := Key(c)
 		for si, s := range []Key{k, shift(k)} {
-			if _, ok := kbDefinitions[s]; ok {
-				panic(fmt.Sprintf("kbDefinitions already contains key for %s", s))
+			if m, ok := kbDefs[s]; ok {
+				var loc Location
+				if whens := sortedKeys(m); len(whens) > 0 && m[whens[0]] != nil {
+					loc = m[whens[0]].Location
+				}
+				ds.ErrorAt(loc, "kbDefinitions already contains key for %s", s)
+				continue
 			}
 			text := s
 			if si != 0 {
 				text = Key(shiftedCharacters[ci])
 			}
 
-			kbDefinitions[s] = map[string]*KB{
-				groogBehaviorContext.value: kbArgs("groog.type", map[string]interface{}{
-					"text": text,
-				}),
+			kbDefs[s] = map[string]*KB{
+				groogBehaviorContext.value: groogType(string(text)),
 			}
 		}
 	}
 
 	// Then create all json values
-	keys := append(maps.Keys(kbDefinitions), maps.Keys(removeKeybindings)...)
+	keys := append(maps.Keys(kbDefs), maps.Keys(removals)...)
 	slices.Sort(keys)
 
 	var kbs []*Keybinding
@@ -194,16 +342,25 @@ func kbDefsToBindings() []*Keybinding {
 		}
 		visited[key] = true
 
-		// Add the new keybindings
-		m := kbDefinitions[key]
+		// Add the new keybindings (VS Code runs the last matching binding, so
+		// higher priority bindings go last).
+		m := kbDefs[key]
 		whens := maps.Keys(m)
-		slices.Sort(whens)
+		sortFunc(whens, func(a, b string) bool {
+			if pa, pb := bindingPriority(m[a]), bindingPriority(m[b]); pa != pb {
+				return pa < pb
+			}
+			return a < b
+		})
 
 		for _, when := range whens {
 			kb := m[when]
 			if kb == nil {
 				continue
 			}
+			for _, err := range kb.Errors {
+				ds.ErrorAt(kb.Location, "%s", err)
+			}
 			for _, ka := range key.keyAliases() {
 				kbs = append(kbs, &Keybinding{
 					Key:     ka,
@@ -211,16 +368,20 @@ func kbDefsToBindings() []*Keybinding {
 					Command: kb.Command,
 					Args:    kb.Args,
 					// We don't set Async or Delay because those are only used in multi-command args
+					Location: kb.Location,
 				})
 			}
 		}
 
 		// Remove keybindings we don't want
-		for _, cmd := range removeKeybindings[key] {
+		for _, r := range removals[key] {
 			for _, ka := range key.keyAliases() {
 				kbs = append(kbs, &Keybinding{
-					Key:     ka,
-					Command: fmt.Sprintf("-%s", cmd),
+					Key:      ka,
+					Command:  fmt.Sprintf("-%s", r.Command),
+					When:     r.When,
+					Args:     r.Args,
+					Location: r.Location,
 				})
 			}
 		}
@@ -229,33 +390,39 @@ func kbDefsToBindings() []*Keybinding {
 	return kbs
 }
 
-var (
-	revealInNewEditor = onlyMC(
+func revealInNewEditor() map[string]*KB {
+	return onlyMC(
 		"workbench.action.splitEditorRight",
 		"editor.action.revealDefinition",
 	)
-)
+}
 
-var (
-	// Map from keybindings to command binding to remove
-	removeKeybindings = map[Key][]string{
+// groogRemovals returns a map from keybindings to command bindings to remove.
+func groogRemovals() map[Key][]*Removal {
+	return map[Key][]*Removal{
 		alt(shift("r")): {
-			"revealFileInOS",
-			"remote-wsl.revealInExplorer",
+			// VS Code only removes the default binding with the same when clause.
+			rmWhen("revealFileInOS", editorFocus.not()),
+			rm("remote-wsl.revealInExplorer"),
 		},
 		// Added by git extension
-		ctrlLeader("l", "g"): {"extension.openInGitHub"},
-		ctrlLeader("l", "p"): {"extension.openPrGitProvider"},
-		ctrlLeader("l", "c"): {"extension.copyGitHubLinkToClipboard"},
+		ctrlLeader("l", "g"): {rm("extension.openInGitHub")},
+		ctrlLeader("l", "p"): {rm("extension.openPrGitProvider")},
+		ctrlLeader("l", "c"): {rm("extension.copyGitHubLinkToClipboard")},
 	}
-	// Map from key to "when context" to command to run in that context
-	// TODO: logic to ensure unique keys (not guaranteed by compiler or runtime since using functions to generate keys)
-	kbDefinitions = map[Key]map[string]*KB{
+}
+
+// groogKeybindings returns a map from key to "when context" to command to run
+// in that context. A new map is created on every call so callers are free to
+// modify it.
+// TODO: logic to ensure unique keys (not guaranteed by compiler or runtime since using functions to generate keys)
+func groogKeybindings() map[Key]map[string]*KB {
+	return map[Key]map[string]*KB{
 		// Find bindings
 		ctrl("f"): {
 			groogQMK.and(terminalVisible).value: kb("groog.terminal.find"),
 			// This is mostly relevant for Find Simple Mode (so `ctrl+s; ctrl+s` results in redoing previous find)
-			groogQMK.and(terminalVisible.not()).and(inQuickOpen).and(groogSimpleFindMode).value: kb("workbench.action.acceptSelectedQuickOpenItem"),
+			groogQMK.and(terminalVisible.not()).and(inQuickOpen).and(groogSimpleFindMode).value: withPriority(kb("workbench.action.acceptSelectedQuickOpenItem"), 1),
 			groogQMK.and(terminalVisible.not()).value:                                           kb("groog.find"),
 			groogQMK.not().and(editorTextFocus.and(inQuickOpen.not())).value:                    kb("groog.cursorRight"),
 			always.value: kb("-workbench.action.terminal.focusFind"),
@@ -265,7 +432,7 @@ var (
 			groogQMK.value: kb("groog.cursorRight"),
 			groogQMK.not().and(terminalVisible).value: kb("groog.terminal.find"),
 			// This is mostly relevant for Find Simple Mode (so `ctrl+s; ctrl+s` results in redoing previous find)
-			groogQMK.not().and(terminalVisible.not()).and(inQuickOpen).and(groogSimpleFindMode).value: kb("workbench.action.acceptSelectedQuickOpenItem"),
+			groogQMK.not().and(terminalVisible.not()).and(inQuickOpen).and(groogSimpleFindMode).value: withPriority(kb("workbench.action.acceptSelectedQuickOpenItem"), 1),
 			groogQMK.not().and(terminalVisible.not()).value:                                           kb("groog.find"),
 		},
 		// Don't use 'terminalVisible' here because we don't want ctrl+r to activate terminal find mode.
@@ -273,11 +440,11 @@ var (
 		ctrl("r"): contextualKB(groogTerminalFindMode, kb("groog.terminal.reverseFind"), kb("groog.reverseFind")),
 		shift(enter): {
 			groogFindMode.value:         kb("editor.action.previousMatchFindAction"),
-			groogTerminalFindMode.value: kb("groog.terminal.reverseFind"),
+			groogTerminalFindMode.value: withPriority(kb("groog.terminal.reverseFind"), 1),
 		},
 		enter: {
-			inSnippetMode.value:         kb("jumpToNextSnippetPlaceholder"),
-			groogTerminalFindMode.value: kb("groog.terminal.find"),
+			inSnippetMode.value:         withPriority(kb("jumpToNextSnippetPlaceholder"), 3),
+			groogTerminalFindMode.value: withPriority(kb("groog.terminal.find"), 2),
 			groogFindMode.value:         kb("editor.action.nextMatchFindAction"),
 			// This is needed so enter hits are recorded
 			// Don't do for tab since that can add a variable
@@ -285,19 +452,13 @@ var (
 			// groog.tab later on, but given tab's dynamic nature
 			// depending on file type and context, that may become
 			// tricky rather quickly.
-			groogRecording.value: kbArgs("groog.type", map[string]interface{}{
-				"text": "\n",
-			}),
+			groogRecording.value: withPriority(groogType("\n"), 1),
 		},
 		space: {
-			groogBehaviorContext.value: kbArgs("groog.type", map[string]interface{}{
-				"text": " ",
-			}),
+			groogBehaviorContext.value: groogType(" "),
 		},
 		shift(space): {
-			groogBehaviorContext.value: kbArgs("groog.type", map[string]interface{}{
-				"text": " ",
-			}),
+			groogBehaviorContext.value: groogType(" "),
 		},
 		alt("r"):        findToggler("Regex", nil, nil),
 		alt("c"):        findToggler("CaseSensitive", nil, nil),
@@ -359,7 +520,8 @@ var (
 			sideBarFocus.and(inQuickOpen.not().and(suggestWidgetVisible.not())).value:  kb("workbench.action.focusActiveEditorGroup"),
 			inQuickOpen.and(suggestWidgetVisible.not()).and(groogFindMode.not()).value: kb("workbench.action.closeQuickOpen"),
 			suggestWidgetVisible.value: kb("hideSuggestWidget"),
-			always.value:               kb("groog.ctrlG"),
+			// Only run if nothing more specific applies.
+			always.value: withPriority(kb("groog.ctrlG"), -1),
 		},
 		ctrl("/"): {
 			activePanel.value: nil,
@@ -395,15 +557,8 @@ var (
 		alt("h"):       only("groog.deleteWordLeft"),
 		alt(backspace): textOnly("groog.deleteWordLeft"),
 		ctrl(backspace): {
-			// Requires following command in shell/powershell profiles:
-			// Bash:
-			// bind '"\C-x\C-h":backward-kill-word'
-			//
-			// PowerShell:
-			// Set-PSReadLineKeyHandler -Chord Ctrl+x,Ctrl+h -ScriptBlock {
-			// 	[Microsoft.PowerShell.PSConsoleReadLine]::BackwardDeleteWord()
-			// }
-			groogQMK.and(panelFocus).value: sendSequence("\u0018\u0008"),
+			// Requires the shell profile generated by `vs-package shell-profile`
+			groogQMK.and(panelFocus).value: shellTermKeys(backwardKillWord, "C-x", "C-h"),
 			editorTextFocus.value:          kb("groog.deleteWordLeft"),
 			// groogQMK.not().or(panelFocus.not()).value: kb("groog.deleteWordLeft"),
 		},
@@ -445,8 +600,8 @@ var (
 			groogQMK.and(groogFindMode.not()).value: kb("workbench.action.files.newUntitledFile"),
 		},
 		ctrlX("d"):       only("editor.action.revealDefinition"),
-		ctrl(shift("d")): revealInNewEditor,
-		shift(delete):    revealInNewEditor,
+		ctrl(shift("d")): revealInNewEditor(),
+		shift(delete):    revealInNewEditor(),
 		ctrl(pageup):     prevTab(),
 		ctrl(pagedown):   nextTab(),
 		ctrl("u"):        prevTab(),
@@ -511,14 +666,8 @@ var (
 			nil),
 		ctrlZ("c"): only("groog.copyFilename"),
 
-		// To determine this, I did the following
-		// - ran `sed -n l` (as recommended in (1))
-		// - pressed "ctrl+/"
-		// - pressed enter to see following output: "\037$"
-		// - Converted 37 octal to hexidecimal (looked up in (2)) to get 001f
-		// (1): https://unix.stackexchange.com/questions/76566/where-do-i-find-a-list-of-terminal-key-codes-to-remap-shortcuts-in-bash
-		// (2): https://en.wikipedia.org/wiki/List_of_Unicode_characters
-		ctrl("z"): panelSplit(sendSequence("\u001F"), nil),
+		// Terminals send the same character for ctrl+/ and ctrl+_ (which is undo in bash).
+		ctrl("z"): panelSplit(termKeys("C-/"), nil),
 
 		// Formatting
 		ctrlX(tab):       only("groog.format"),
@@ -569,7 +718,7 @@ var (
 
 		// Markdown
 		ctrlX("m"): {
-			"editorLangId == 'markdown'": kb("markdown.showPreviewToSide"),
+			whenEditorLang("markdown").value: kb("markdown.showPreviewToSide"),
 		},
 
 		// Git
@@ -583,13 +732,7 @@ var (
 
 		ctrlX("t"): {
 			goFile.value: mcWithArgs(
-				&KB{
-					Command: "go.test.package",
-					Async:   async(true),
-					Args: map[string]interface{}{
-						"background": true,
-					},
-				},
+				withAsync(goTestPackage(true)),
 				&KB{
 					Command: "termin-all-or-nothing.openPanel",
 					Delay:   delay(50),
@@ -601,19 +744,8 @@ var (
 			),
 			// For all other file types, use the custom function
 			notGoFile.value: mcWithArgs(
-				&KB{
-					Command: "groog.testFile",
-					Args: map[string]interface{}{
-						"part": 0,
-					},
-				},
-				&KB{
-					Command: "groog.testFile",
-					Delay:   delay(25),
-					Args: map[string]interface{}{
-						"part": 1,
-					},
-				},
+				testFile(0),
+				withDelay(testFile(1), 25),
 			),
 		},
 
@@ -635,7 +767,36 @@ var (
 		// Prevent focus mode from ever being activated.
 		ctrl("m"): only("-editor.action.toggleTabFocusMode"),
 	}
-)
+}
+
+// Removal is a default keybinding to remove. VS Code matches removals on the
+// key, command, and when clause only, so an empty When removes the command in
+// every context. Args are included in the generated removal, but they never
+// limit which bindings are removed.
+type Removal struct {
+	Command string
+	When    string
+	Args    map[string]interface{}
+	// Location is where the removal is defined.
+	Location Location
+}
+
+func rm(command string) *Removal {
+	return rmWhenArgs(command, always, nil)
+}
+
+func rmWhen(command string, context *WhenContext) *Removal {
+	return rmWhenArgs(command, context, nil)
+}
+
+func rmWhenArgs(command string, context *WhenContext, args map[string]interface{}) *Removal {
+	return &Removal{
+		Command:  command,
+		When:     context.value,
+		Args:     args,
+		Location: dslLocation(),
+	}
+}
 
 type KB struct {
 	Command string                 `json:"command"`
@@ -643,6 +804,17 @@ type KB struct {
 	// This is for multi-command (it's a pointer so omitempty works)
 	Async *bool `json:"async,omitempty"`
 	Delay *int  `json:"delay,omitempty"`
+	// ShellSetup is the shell configuration needed for the terminal sequence
+	// sent by this command (see shell.go).
+	ShellSetup *ShellSetup `json:"-"`
+	// Priority determines which binding runs when multiple bindings for the
+	// same key match (the highest one wins). See binding_order.go.
+	Priority int `json:"-"`
+	// Location is where the binding is defined.
+	Location Location `json:"-"`
+	// Errors are the problems found while building the binding. They're
+	// reported (at Location) when the binding is converted to a Keybinding.
+	Errors []string `json:"-"`
 }
 
 func terminAllOrNothingWrap(command string, args map[string]interface{}) map[string]interface{} {
@@ -694,50 +866,50 @@ func onlyMC(cmds ...string) map[string]*KB {
 }
 
 func notification(message string) *KB {
-	return kbArgs("groog.message.info", map[string]interface{}{
-		"message": message,
-	})
+	return kbArgs("groog.message.info", argsMap(MessageArgs{Message: message}))
 }
 
 func errorNotification(message string) *KB {
-	return kbArgs("groog.message.info", map[string]interface{}{
-		"message": message,
-		"error":   true,
-	})
+	return kbArgs("groog.message.info", argsMap(MessageArgs{Message: message, Error: true}))
 }
 
 func mcWithArgs(cmds ...*KB) *KB {
-	return kbArgs("groog.multiCommand.execute", map[string]interface{}{
-		"sequence": cmds,
-	})
+	k := kbArgs("groog.multiCommand.execute", argsMap(MultiCommandArgs{Sequence: cmds}))
+	for _, c := range cmds {
+		k.Errors = append(k.Errors, c.Errors...)
+	}
+	return k
 }
 
 func mc(cmds ...string) *KB {
-	var sequence []map[string]interface{}
+	var sequence []*KB
 	for _, c := range cmds {
-		sequence = append(sequence, map[string]interface{}{
-			"command": c,
-		})
+		sequence = append(sequence, kb(c))
 	}
-
-	return kbArgs("groog.multiCommand.execute", map[string]interface{}{
-		"sequence": sequence,
-	})
-}
-
-func sendSequence(text string) *KB {
-	return kbArgs("workbench.action.terminal.sendSequence", map[string]interface{}{
-		"text": text,
-	})
+	return mcWithArgs(sequence...)
 }
 
 func kbArgs(cmd string, args map[string]interface{}) *KB {
 	return &KB{
-		Command: cmd,
-		Args:    args,
+		Command:  cmd,
+		Args:     args,
+		Location: dslLocation(),
 	}
 }
 
+// dslHelpers returns the names of the functions that build definitions (KBs,
+// removals, commands, and modes) on behalf of their caller. They're skipped
+// when determining a definition's location.
+func dslHelpers() map[string]bool {
+	return funcNames(
+		kbArgs, kb, mc, mcWithArgs, notification, errorNotification,
+		only, onlyArgs, textOnly, onlyWhen, onlyWhenArgs, onlyMC,
+		findToggler, sendSequence, termKeys, shellTermKeys,
+		goTestPackage, groogType, testFile,
+		rm, rmWhen, rmWhenArgs, cc, ccArgs, groogMode,
+	)
+}
+
 type Key string
 
 func (k Key) ToString() string {
@@ -770,8 +942,9 @@ func findToggler(suffix string, context *WhenContext, m map[string]*KB) map[stri
 		neg = context.and(neg)
 	}
 	r := map[string]*KB{
-		ef.value:  mc(groogCmd, fmt.Sprintf("toggleFind%s", suffix)),
-		se.value:  mc(groogCmd, fmt.Sprintf("toggleSearchEditor%s", suffix)),
+		ef.value: mc(groogCmd, fmt.Sprintf("toggleFind%s", suffix)),
+		// The search editor is also an editor.
+		se.value:  withPriority(mc(groogCmd, fmt.Sprintf("toggleSearchEditor%s", suffix)), 1),
 		sv.value:  mc(groogCmd, fmt.Sprintf("toggleSearch%s", suffix)),
 		neg.value: mc(groogCmd, fmt.Sprintf("toggleSearch%s", suffix)),
 	}
@@ -793,21 +966,12 @@ func shift(c Key) Key {
 	return Key(fmt.Sprintf("shift+%s", c))
 }
 
-var (
-	simpleContextRegex = regexp.MustCompile(`^[a-zA-Z\.]+$`)
-)
-
-// contextualKB will run the trueKB if contextKey is set
-// and falseKB otherwise. An error is returned if `contextKey` is not
-// a single variable.
+// contextualKB will run the trueKB if context is true and falseKB otherwise.
+// The context must be a single value or comparison (so it can be negated).
 func contextualKB(context *WhenContext, trueKB, falseKB *KB) map[string]*KB {
-	contextKey := context.value
-	if !simpleContextRegex.MatchString(contextKey) {
-		panic(fmt.Sprintf("context key (%q) does not match required regexp (%s)", contextKey, simpleContextRegex))
-	}
 	return map[string]*KB{
-		contextKey:                     trueKB,
-		fmt.Sprintf("!%s", contextKey): falseKB,
+		context.value:       trueKB,
+		context.not().value: falseKB,
 	}
 }
 
@@ -823,7 +987,8 @@ func panelSplit(panelKB, otherKB *KB) map[string]*KB {
 
 func terminalPanelSplit(terminalKB, panelKB, otherKB *KB) map[string]*KB {
 	return map[string]*KB{
-		terminalFocus.value:                       terminalKB,
+		// Terminals can also be opened in the editor area.
+		terminalFocus.value:                       withPriority(terminalKB, 1),
 		panelFocus.and(terminalFocus.not()).value: panelKB,
 		panelFocus.not().value:                    otherKB,
 	}
@@ -880,10 +1045,9 @@ func ctrlLBindings() map[string]*KB {
 	return map[string]*KB{
 		inQuickOpen.value: mc(repeat("workbench.action.quickOpenNavigatePreviousInFilePicker", 5)...),
 		inQuickOpen.not().and(terminalFocus.not()).value: kb("groog.jump"),
-		// Sending this sequence sends the equivalent of pressing the page-up key while in the terminal.
+		// Sends the equivalent of pressing the page-up key while in the terminal.
 		// See this stack overflow post: https://stackoverflow.com/questions/61742559/need-vscode-sendsequence-keybindings-for-previous-command-next-command-move-to
-		// and this page that it links to (ctrl+f for "pageup"): https://invisible-island.net/xterm/ctlseqs/ctlseqs.html
-		inQuickOpen.not().and(terminalFocus).value: sendSequence("\u001b[5~"),
+		inQuickOpen.not().and(terminalFocus).value: termKeys("pageup"),
 	}
 }
 
@@ -892,31 +1056,31 @@ func ctrlVBindings() map[string]*KB {
 		inQuickOpen.value: mc(repeat("workbench.action.quickOpenNavigateNextInFilePicker", 5)...),
 		inQuickOpen.not().and(terminalFocus.not()).value: kb("groog.fall"),
 		// See ctrlLBindings function for description of what this means
-		inQuickOpen.not().and(terminalFocus).value: sendSequence("\u001b[6~"),
+		inQuickOpen.not().and(terminalFocus).value: termKeys("pagedown"),
 	}
 }
 
 func upBindings() map[string]*KB {
 	return map[string]*KB{
-		groogTerminalFindMode.value: kb("groog.terminal.reverseFind"),
+		groogTerminalFindMode.value: withPriority(kb("groog.terminal.reverseFind"), 2),
 		always.value:                kb("-workbench.action.quickOpen"),
 		editorTextFocus.and(suggestWidgetVisible.not()).value: kb("groog.cursorUp"),
 		editorTextFocus.and(suggestWidgetVisible).value:       kb("selectPrevSuggestion"),
-		inQuickOpen.and(groogFindMode.not()).value:            kb("workbench.action.quickOpenNavigatePreviousInFilePicker"),
-		groogFindMode.value:                                   kb("groog.reverseFind"),
-		searchViewletFocus.value:                              kb("list.focusUp"),
+		inQuickOpen.and(groogFindMode.not()).value:            withPriority(kb("workbench.action.quickOpenNavigatePreviousInFilePicker"), 3),
+		groogFindMode.value:                                   withPriority(kb("groog.reverseFind"), 1),
+		searchViewletFocus.value:                              withPriority(kb("list.focusUp"), 3),
 	}
 }
 
 func downBindings() map[string]*KB {
 	return map[string]*KB{
-		groogTerminalFindMode.value: kb("groog.terminal.find"),
+		groogTerminalFindMode.value: withPriority(kb("groog.terminal.find"), 2),
 		always.value:                kb("-workbench.action.files.newUntitledFile"),
 		editorTextFocus.and(suggestWidgetVisible.not()).value:   kb("groog.cursorDown"),
 		editorTextFocus.and(suggestWidgetVisible).value:         kb("selectNextSuggestion"),
-		inQuickOpen.and(groogFindMode.not()).value:              kb("workbench.action.quickOpenNavigateNextInFilePicker"),
-		groogFindMode.value:                                     kb("groog.find"),
-		searchInputBoxFocus.value:                               kb("search.action.focusSearchList"),
+		inQuickOpen.and(groogFindMode.not()).value:              withPriority(kb("workbench.action.quickOpenNavigateNextInFilePicker"), 3),
+		groogFindMode.value:                                     withPriority(kb("groog.find"), 1),
+		searchInputBoxFocus.value:                               withPriority(kb("search.action.focusSearchList"), 3),
 		searchInputBoxFocus.not().and(searchViewletFocus).value: kb("list.focusDown"),
 	}
 }
@@ -931,7 +1095,7 @@ func leftBindings() map[string]*KB {
 
 func paste() map[string]*KB {
 	return map[string]*KB{
-		editorTextFocus.or(groogFindMode).value: kb("groog.paste"),
+		editorTextFocus.or(groogFindMode).value: withPriority(kb("groog.paste"), 1),
 		editorTextFocus.not().value:             kb("editor.action.clipboardPasteAction"),
 	}
 }
@@ -963,7 +1127,7 @@ func altT() map[string]*KB {
 			},
 			kb("workbench.action.acceptSelectedQuickOpenItem"),
 			*/
-			sendSequence("\u001b[A\u000d"),
+			termKeys("up", "enter"),
 			kb("terminal.focus"),
 		),
 	)
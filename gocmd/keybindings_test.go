@@ -0,0 +1,520 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestWhenContext(t *testing.T) {
+	a := wc("a")
+	b := wc("b")
+	c := wc("c")
+
+	for _, test := range []struct {
+		name string
+		wc   *WhenContext
+		want string
+	}{
+		{
+			name: "single value",
+			wc:   a,
+			want: "a",
+		},
+		{
+			name: "and",
+			wc:   a.and(b),
+			want: "a && b",
+		},
+		{
+			name: "or",
+			wc:   a.or(b),
+			want: "a || b",
+		},
+		{
+			name: "not",
+			wc:   a.not(),
+			want: "!a",
+		},
+		{
+			name: "chained",
+			wc:   a.not().and(b).or(c.not()),
+			want: "!a && b || !c",
+		},
+		{
+			name: "file type",
+			wc:   whenFileType("go"),
+			want: "resourceLangId == 'go'",
+		},
+		{
+			name: "not file type",
+			wc:   whenNotFileType("go"),
+			want: "resourceLangId != 'go'",
+		},
+		{
+			name: "file type in",
+			wc:   whenFileTypeIn("go", "java", "c++"),
+			want: `resourceLangId =~ /^(go|java|c\+\+)$/`,
+		},
+		{
+			name: "editor language",
+			wc:   whenEditorLang("markdown"),
+			want: "editorLangId == 'markdown'",
+		},
+		{
+			name: "regex with slashes",
+			wc:   wcCmp("resourceFilename", opMatch, regexp.MustCompile(`(?i)^src/.*\/test/`)),
+			want: `resourceFilename =~ /^src\/.*\/test\//i`,
+		},
+		{
+			name: "in",
+			wc:   wcCmp("resourceFilename", opIn, "groog.files"),
+			want: "resourceFilename in groog.files",
+		},
+		{
+			name: "not in",
+			wc:   wcCmp("resourceFilename", opNotIn, "groog.files"),
+			want: "resourceFilename not in groog.files",
+		},
+		{
+			name: "numeric comparisons",
+			wc:   wcCmp("count", opLt, 1).and(wcCmp("count", opLte, 2)).and(wcCmp("count", opGt, 3.5)).and(wcCmp("count", opGte, 4)),
+			want: "count < 1 && count <= 2 && count > 3.5 && count >= 4",
+		},
+		{
+			name: "bool comparison",
+			wc:   wcCmp("editorFocus", opEq, true),
+			want: "editorFocus == true",
+		},
+		{
+			name: "groog context",
+			wc:   wc(groogContext("find")),
+			want: "groog.context.findMode",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := cmp.Diff(test.want, test.wc.value); diff != "" {
+				t.Errorf("WhenContext produced incorrect value (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWcCmpInvalid(t *testing.T) {
+	keys := map[string]*ContextKey{
+		"a": {Key: "a", Type: contextString},
+	}
+	for _, test := range []struct {
+		name    string
+		op      whenOp
+		value   interface{}
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "regex without regexp",
+			op:      opMatch,
+			value:   "^go$",
+			want:    "a =~ ",
+			wantErr: `failed to parse when clause "a =~ ": column 6: expected a value after "=~"`,
+		},
+		{
+			name:    "in without context key",
+			op:      opIn,
+			value:   "not a key",
+			want:    "a in ",
+			wantErr: `failed to parse when clause "a in ": column 6: expected a context key after "in"`,
+		},
+		{
+			name:    "numeric comparison with string",
+			op:      opLt,
+			value:   "3",
+			want:    "a < ",
+			wantErr: `failed to parse when clause "a < ": column 5: expected a value after "<"`,
+		},
+		{
+			name:    "single quote",
+			op:      opEq,
+			value:   "it's",
+			want:    "a == ",
+			wantErr: `failed to parse when clause "a == ": column 6: expected a value after "=="`,
+		},
+		{
+			name:    "unsupported value",
+			op:      opNotEq,
+			value:   []string{"a"},
+			want:    "a != ",
+			wantErr: `failed to parse when clause "a != ": column 6: expected a value after "!="`,
+		},
+		{
+			name:  "valid",
+			op:    opEq,
+			value: 3,
+			want:  "a == 3",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := wcCmp("a", test.op, test.value)
+			if diff := cmp.Diff(test.want, got.value); diff != "" {
+				t.Errorf("wcCmp() returned incorrect value (-want, +got):\n%s", diff)
+			}
+
+			ds := &Diagnostics{}
+			checkWhen(ds, Location{}, keys, nil, got.value)
+			if diff := cmp.Diff(test.wantErr, diagnosticMessages(ds)); diff != "" {
+				t.Errorf("checkWhen(%q) recorded incorrect diagnostics (-want, +got):\n%s", got.value, diff)
+			}
+		})
+	}
+}
+
+func TestWhenContextNot(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		wc   *WhenContext
+		want string
+	}{
+		{
+			name: "negate single value",
+			wc:   wc("a"),
+			want: "!a",
+		},
+		{
+			name: "negate multiple values",
+			wc:   wc("a").and(wc("b")),
+			want: "!(a && b)",
+		},
+		{
+			name: "negate equality",
+			wc:   whenFileType("go"),
+			want: "resourceLangId != 'go'",
+		},
+		{
+			name: "negate inequality",
+			wc:   whenNotFileType("go"),
+			want: "resourceLangId == 'go'",
+		},
+		{
+			name: "negate in",
+			wc:   wcCmp("resourceFilename", opIn, "groog.files"),
+			want: "resourceFilename not in groog.files",
+		},
+		{
+			name: "negate regex",
+			wc:   whenFileTypeIn("go", "java"),
+			want: "!(resourceLangId =~ /^(go|java)$/)",
+		},
+		{
+			name: "negate numeric comparison",
+			wc:   wcCmp("count", opGte, 2),
+			want: "!(count >= 2)",
+		},
+		{
+			name: "negate negated comparison",
+			wc:   wcCmp("count", opGte, 2).not(),
+			want: "count >= 2",
+		},
+		{
+			name: "negate negation",
+			wc:   wc("a").not(),
+			want: "!(!a)",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := cmp.Diff(test.want, test.wc.not().value); diff != "" {
+				t.Errorf("WhenContext.not() returned incorrect value (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPopLeader(t *testing.T) {
+	for _, test := range []struct {
+		key    Key
+		want   string
+		wantOK bool
+	}{
+		{
+			key: ctrl("x"),
+		},
+		{
+			key: "x",
+		},
+		{
+			key:    ctrlX("s"),
+			want:   "ctrl+x ctrl+s",
+			wantOK: true,
+		},
+		{
+			key:    ctrlZ(pagedown),
+			want:   "ctrl+z ctrl+pagedown",
+			wantOK: true,
+		},
+		{
+			key:    ctrlLeader("l", "g"),
+			want:   "ctrl+l ctrl+g",
+			wantOK: true,
+		},
+		{
+			key: alt("x") + " s",
+		},
+	} {
+		t.Run(string(test.key), func(t *testing.T) {
+			got, ok := popLeader(test.key)
+			if ok != test.wantOK {
+				t.Errorf("popLeader(%q) returned ok=%v; want %v", test.key, ok, test.wantOK)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("popLeader(%q) returned incorrect value (-want, +got):\n%s", test.key, diff)
+			}
+		})
+	}
+}
+
+func TestKeyAliases(t *testing.T) {
+	for _, test := range []struct {
+		key  Key
+		want []string
+	}{
+		{
+			key:  "a",
+			want: []string{"a"},
+		},
+		{
+			key:  ctrl(shift("a")),
+			want: []string{"ctrl+shift+a"},
+		},
+		{
+			key:  ctrlX("f"),
+			want: []string{"ctrl+x f", "ctrl+x ctrl+f"},
+		},
+		{
+			key:  ctrlX(tab),
+			want: []string{"ctrl+x tab", "ctrl+x ctrl+tab"},
+		},
+	} {
+		t.Run(string(test.key), func(t *testing.T) {
+			if diff := cmp.Diff(test.want, test.key.keyAliases()); diff != "" {
+				t.Errorf("Key(%q).keyAliases() returned incorrect value (-want, +got):\n%s", test.key, diff)
+			}
+		})
+	}
+}
+
+func TestContextualKB(t *testing.T) {
+	trueKB := kb("true.command")
+	falseKB := kb("false.command")
+
+	for _, test := range []struct {
+		name    string
+		context *WhenContext
+		want    map[string]*KB
+	}{
+		{
+			name:    "simple context",
+			context: activePanel,
+			want: map[string]*KB{
+				"activePanel":  trueKB,
+				"!activePanel": falseKB,
+			},
+		},
+		{
+			name:    "dotted context",
+			context: groogQMK,
+			want: map[string]*KB{
+				"groog.context.qmkMode":  trueKB,
+				"!groog.context.qmkMode": falseKB,
+			},
+		},
+		{
+			name:    "compound context",
+			context: activePanel.and(groogQMK),
+			want: map[string]*KB{
+				"activePanel && groog.context.qmkMode":    trueKB,
+				"!(activePanel && groog.context.qmkMode)": falseKB,
+			},
+		},
+		{
+			name:    "negated context",
+			context: activePanel.not(),
+			want: map[string]*KB{
+				"!activePanel":    trueKB,
+				"!(!activePanel)": falseKB,
+			},
+		},
+		{
+			name:    "comparison context",
+			context: goFile,
+			want: map[string]*KB{
+				"resourceLangId == 'go'": trueKB,
+				"resourceLangId != 'go'": falseKB,
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := cmp.Diff(test.want, contextualKB(test.context, trueKB, falseKB)); diff != "" {
+				t.Errorf("contextualKB() returned incorrect value (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestKbDefsToBindings(t *testing.T) {
+	kbDefs := map[Key]map[string]*KB{
+		ctrlX("s"): only("workbench.action.files.save"),
+		ctrl("a"):  keyboardSplit(kb("groog.cursorHome"), kb("editor.action.selectAll")),
+		ctrl("z"):  {activePanel.value: nil},
+		ctrl("b"): {
+			"a": withPriority(kb("groog.a"), 1),
+			"b": kb("groog.b"),
+		},
+	}
+	removals := map[Key][]*Removal{
+		alt("r"): {
+			rmWhen("revealFileInOS", editorFocus.not()),
+			rmWhenArgs("some.command", always, map[string]interface{}{"a": "b"}),
+		},
+	}
+
+	got := kbDefsToBindings(&Diagnostics{}, kbDefs, removals)
+	// Filter out the character bindings
+	var filtered []*Keybinding
+	for _, kb := range got {
+		if kb.Command != "groog.type" {
+			filtered = append(filtered, kb)
+		}
+	}
+
+	want := []*Keybinding{
+		{
+			Key:     "alt+r",
+			Command: "-revealFileInOS",
+			When:    "!editorFocus",
+		},
+		{
+			Key:     "alt+r",
+			Command: "-some.command",
+			Args:    map[string]interface{}{"a": "b"},
+		},
+		{
+			Key:     "ctrl+a",
+			Command: "groog.cursorHome",
+			When:    "!groog.context.qmkMode",
+		},
+		{
+			Key:     "ctrl+a",
+			Command: "editor.action.selectAll",
+			When:    "groog.context.qmkMode",
+		},
+		// Higher priority bindings go last
+		{
+			Key:     "ctrl+b",
+			Command: "groog.b",
+			When:    "b",
+		},
+		{
+			Key:     "ctrl+b",
+			Command: "groog.a",
+			When:    "a",
+		},
+		{
+			Key:     "ctrl+x s",
+			Command: "workbench.action.files.save",
+		},
+		{
+			Key:     "ctrl+x ctrl+s",
+			Command: "workbench.action.files.save",
+		},
+	}
+	// Locations are tested in TestKbDefsToBindingsLocations.
+	if diff := cmp.Diff(want, filtered, cmpopts.IgnoreFields(Keybinding{}, "Location")); diff != "" {
+		t.Errorf("kbDefsToBindings() returned incorrect value (-want, +got):\n%s", diff)
+	}
+
+	if len(kbDefs) != 4 {
+		t.Errorf("kbDefsToBindings() modified the provided definitions")
+	}
+
+	// Running again should produce the same result.
+	if diff := cmp.Diff(got, kbDefsToBindings(&Diagnostics{}, kbDefs, removals)); diff != "" {
+		t.Errorf("kbDefsToBindings() returned different values on second run (-first, +second):\n%s", diff)
+	}
+}
+
+func TestKbDefsToBindingsLocations(t *testing.T) {
+	_, _, line, _ := runtime.Caller(0)
+	kbDefs := map[Key]map[string]*KB{
+		ctrlX("s"): only("workbench.action.files.save"),
+	}
+	removals := map[Key][]*Removal{
+		ctrlX("s"): {rm("workbench.action.files.saveAs")},
+	}
+
+	var got []string
+	for _, kb := range kbDefsToBindings(&Diagnostics{}, kbDefs, removals) {
+		if kb.Key == "ctrl+x s" {
+			got = append(got, fmt.Sprintf("%s %s", kb.Command, kb.Location))
+		}
+	}
+	want := []string{
+		fmt.Sprintf("workbench.action.files.save keybindings_test.go:%d", line+2),
+		fmt.Sprintf("-workbench.action.files.saveAs keybindings_test.go:%d", line+5),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("kbDefsToBindings() returned incorrect locations (-want, +got):\n%s", diff)
+	}
+}
+
+// vscodeDefaultWhens are the when clauses of the default VS Code bindings
+// that are removed in specific contexts.
+var vscodeDefaultWhens = map[string]string{
+	"alt+shift+i editor.action.insertCursorAtEndOfEachLineSelected": "editorTextFocus",
+	"alt+shift+r revealFileInOS":                                    "!editorFocus",
+}
+
+func TestRemovalsMatchDefaults(t *testing.T) {
+	// VS Code only removes a default binding if the removal's when clause is
+	// exactly the same as the default's.
+	for _, kb := range groogPackage("").Contributes.Keybindings {
+		if !strings.HasPrefix(kb.Command, "-") || kb.When == "" {
+			continue
+		}
+		id := fmt.Sprintf("%s %s", kb.Key, strings.TrimPrefix(kb.Command, "-"))
+		want, ok := vscodeDefaultWhens[id]
+		if !ok {
+			t.Errorf("removal of %s (when %q) does not have a known default binding", id, kb.When)
+			continue
+		}
+		if kb.When != want {
+			t.Errorf("removal of %s has when %q, but the default binding has when %q", id, kb.When, want)
+		}
+	}
+}
+
+func TestKbDefsToBindingsCharacterOverlap(t *testing.T) {
+	ds := &Diagnostics{}
+	got := kbDefsToBindings(ds, map[Key]map[string]*KB{
+		"a": only("some.command"),
+	}, nil)
+
+	if diff := cmp.Diff("kbDefinitions already contains key for a", diagnosticMessages(ds)); diff != "" {
+		t.Errorf("kbDefsToBindings() recorded incorrect diagnostics (-want, +got):\n%s", diff)
+	}
+
+	// The explicit definition should be kept
+	var aBindings []*Keybinding
+	for _, kb := range got {
+		if kb.Key == "a" {
+			aBindings = append(aBindings, kb)
+		}
+	}
+	want := []*Keybinding{{Key: "a", Command: "some.command"}}
+	if diff := cmp.Diff(want, aBindings, cmpopts.IgnoreFields(Keybinding{}, "Location")); diff != "" {
+		t.Errorf("kbDefsToBindings() returned incorrect bindings for key (-want, +got):\n%s", diff)
+	}
+}
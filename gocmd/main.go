@@ -8,7 +8,6 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
-	"strconv"
 	"strings"
 
 	"github.com/leep-frog/command/command"
@@ -35,18 +34,39 @@ func (*cli) Setup() []string { return nil }
 func (*cli) Changed() bool   { return false }
 
 var (
-	versionRegex = regexp.MustCompile("^(\\s*Version:\\s*[\"`])([0-9\\.]+)([\"`],)$")
+	versionRegex = regexp.MustCompile("^(\\s*Version:\\s*[\"`])([0-9]+\\.[0-9]+\\.[0-9]+(?:-[0-9A-Za-z\\.\\-]+)?(?:\\+[0-9A-Za-z\\.\\-]+)?)([\"`],)$")
 	runtimeNode  = commander.RuntimeCaller()
 )
 
 func (c *cli) Node() command.Node {
 	versionSectionArg := commander.OptionalArg[int]("VERSION", "Version section offset (0 for smallest, 1 for middle, 2 for major)", commander.Default(0), commander.Between(0, 2, true))
+	shellFlag := commander.Flag[string]("shell", 's', "Shell for which to generate the profile (bash, zsh, pwsh, or fish)", commander.Default(string(bash)))
+	setFlag := commander.Flag[string]("set", 's', "Explicit semantic version to release")
+	majorFlag := commander.BoolFlag("major", 'M', "Increment the major version")
+	minorFlag := commander.BoolFlag("minor", 'm', "Increment the minor version")
+	patchFlag := commander.BoolFlag("patch", 'p', "Increment the patch version (default)")
+	preReleaseFlag := commander.BoolFlag("pre-release", 'r', "Release to the pre-release channel (odd minor version)")
+	dryRunFlag := commander.BoolFlag("dry-run", 'd', "Print the new changelog section without writing any files")
+	allowSmallerBumpFlag := commander.BoolFlag("allow-smaller-bump", 'a', "Release even if the version bump is smaller than the one recommended by the manifest changes")
+	extensionsDirFlag := commander.Flag[string]("extensions-dir", 'e', "VS Code extensions directory (defaults to $VSCODE_EXTENSIONS or ~/.vscode/extensions)")
+	sourceArg := commander.OptionalArg[string]("SOURCE", "VSIX file or extension directory to install (defaults to building the VSIX)")
+	revAArg := commander.Arg[string]("REV_A", "Git revision to diff from")
+	revBArg := commander.OptionalArg[string]("REV_B", "Git revision to diff to (defaults to the working tree)", commander.Default(workingTreeRevision))
+	keyArg := commander.Arg[string]("KEY", "Key (as it appears in package.json) for which to print the truth table")
+	formatFlag := commander.Flag[string]("format", 'f', "Output format (markdown or csv)", commander.Default(string(markdownFormat)))
+	graphFormatFlag := commander.Flag[string]("format", 'f', "Output format (json or dot)", commander.Default(string(jsonFormat)))
+	keyFlag := commander.Flag[string]("key", 'k', "Only include bindings for the key")
+	commandFlag := commander.Flag[string]("command", 'c', "Only include bindings that run (or remove) the command")
+	contextFlag := commander.Flag[string]("context", 'x', "Only include bindings whose when clause uses the context key")
 
 	return commander.SerialNodes(
 		runtimeNode,
 		&commander.BranchNode{
 			Branches: map[string]command.Node{
 				"update u": commander.SerialNodes(
+					commander.FlagProcessor(
+						dryRunFlag,
+					),
 					versionSectionArg,
 					&commander.ExecutorProcessor{func(o command.Output, d *command.Data) error {
 						_, fileName, _, ok := runtime.Caller(0)
@@ -62,46 +82,184 @@ func (c *cli) Node() command.Node {
 							return o.Annotatef(err, "failed to read package.go")
 						}
 
-						contents := strings.Split(string(b), "\n")
-						var newContents []string
-						var replaced int
-						var newVersion string
-						for _, line := range contents {
-							m := versionRegex.FindStringSubmatch(line)
-							if len(m) > 0 {
-								replaced++
-								prefix, version, suffix := m[1], m[2], m[3]
-								versionParts := strings.Split(version, ".")
+						newContents, newVersion, err := bumpVersion(string(b), versionSectionArg.Get(d))
+						if err != nil {
+							return o.Err(err)
+						}
 
-								indexToChange := len(versionParts) - 1 - versionSectionArg.Get(d)
+						if dryRunFlag.Get(d) {
+							return c.updateChangelog(o, d, newVersion, true)
+						}
+						if _, _, err := untaggedVersion(localGit(filepath.Dir(filepath.Dir(fileName))), newVersion); err != nil {
+							return o.Err(err)
+						}
 
-								vNum, err := strconv.Atoi(versionParts[indexToChange])
-								if err != nil {
-									return o.Annotatef(err, "failed to convert version")
-								}
+						if err := os.WriteFile(packageFile, []byte(newContents), 0644); err != nil {
+							return o.Annotatef(err, "failed to write new contents to package.go")
+						}
 
-								// Clear out smaller versions
-								for i := indexToChange; i < len(versionParts); i++ {
-									versionParts[i] = "0"
-								}
-								versionParts[indexToChange] = fmt.Sprintf("%d", vNum+1)
-								newVersion = strings.Join(versionParts, ".")
-								line = fmt.Sprintf("%s%s%s", prefix, newVersion, suffix)
-							}
-							newContents = append(newContents, line)
+						o.Stdoutln("Successfully updated to new version:", newVersion)
+
+						if err := c.regeneratePackageJson(o, d, newVersion); err != nil {
+							return err
 						}
+						return c.updateChangelog(o, d, newVersion, false)
+					}},
+				),
+				"release": commander.SerialNodes(
+					commander.FlagProcessor(
+						setFlag,
+						majorFlag,
+						minorFlag,
+						patchFlag,
+						preReleaseFlag,
+						dryRunFlag,
+						allowSmallerBumpFlag,
+					),
+					&commander.ExecutorProcessor{func(o command.Output, d *command.Data) error {
+						opts := &releaseOptions{
+							set:        setFlag.Get(d),
+							part:       patchPart,
+							preRelease: preReleaseFlag.Get(d),
+							dryRun:     dryRunFlag.Get(d),
 
-						if replaced == 0 {
-							return o.Stderrf("Made no replacements")
+							allowSmallerBump: allowSmallerBumpFlag.Get(d),
 						}
 
-						if err := os.WriteFile(packageFile, []byte(strings.Join(newContents, "\n")), 0644); err != nil {
-							return o.Annotatef(err, "failed to write new contents to package.go")
+						var selected []string
+						if opts.set != "" {
+							selected = append(selected, "--set")
+						}
+						if majorFlag.Get(d) {
+							selected = append(selected, "--major")
+							opts.part = majorPart
+						}
+						if minorFlag.Get(d) {
+							selected = append(selected, "--minor")
+							opts.part = minorPart
+						}
+						if patchFlag.Get(d) {
+							selected = append(selected, "--patch")
+						}
+						if len(selected) > 1 {
+							return o.Stderrf("only one of %s may be provided\n", strings.Join(selected, ", "))
 						}
 
-						o.Stdoutln("Successfully updated to new version:", newVersion)
+						return c.release(o, d, opts)
+					}},
+				),
+				"diff": commander.SerialNodes(
+					revAArg,
+					revBArg,
+					&commander.ExecutorProcessor{func(o command.Output, d *command.Data) error {
+						return c.diff(o, d, revAArg.Get(d), revBArg.Get(d))
+					}},
+				),
+				"vsix": commander.SerialNodes(
+					&commander.ExecutorProcessor{func(o command.Output, d *command.Data) error {
+						return c.vsix(o, d)
+					}},
+				),
+				"install": commander.SerialNodes(
+					commander.FlagProcessor(
+						extensionsDirFlag,
+					),
+					sourceArg,
+					&commander.ExecutorProcessor{func(o command.Output, d *command.Data) error {
+						dir, err := extensionsDir(extensionsDirFlag.Get(d))
+						if err != nil {
+							return o.Err(err)
+						}
+						return c.install(o, d, dir, sourceArg.Get(d))
+					}},
+				),
+				"uninstall": commander.SerialNodes(
+					commander.FlagProcessor(
+						extensionsDirFlag,
+					),
+					&commander.ExecutorProcessor{func(o command.Output, d *command.Data) error {
+						dir, err := extensionsDir(extensionsDirFlag.Get(d))
+						if err != nil {
+							return o.Err(err)
+						}
+						return c.uninstall(o, d, dir)
+					}},
+				),
+				"list": commander.SerialNodes(
+					commander.FlagProcessor(
+						extensionsDirFlag,
+					),
+					&commander.ExecutorProcessor{func(o command.Output, d *command.Data) error {
+						dir, err := extensionsDir(extensionsDirFlag.Get(d))
+						if err != nil {
+							return o.Err(err)
+						}
+						return c.list(o, d, dir)
+					}},
+				),
+				"doctor": commander.SerialNodes(
+					&commander.ExecutorProcessor{func(o command.Output, d *command.Data) error {
+						return c.doctor(o, d)
+					}},
+				),
+				"dead": commander.SerialNodes(
+					&commander.ExecutorProcessor{func(o command.Output, d *command.Data) error {
+						return c.deadBindings(o, d)
+					}},
+				),
+				"table": commander.SerialNodes(
+					commander.FlagProcessor(
+						formatFlag,
+					),
+					keyArg,
+					&commander.ExecutorProcessor{func(o command.Output, d *command.Data) error {
+						format, err := parseTableFormat(formatFlag.Get(d))
+						if err != nil {
+							return o.Err(err)
+						}
+						return c.truthTable(o, d, keyArg.Get(d), format)
+					}},
+				),
+				"graph": commander.SerialNodes(
+					commander.FlagProcessor(
+						graphFormatFlag,
+						keyFlag,
+						commandFlag,
+						contextFlag,
+					),
+					&commander.ExecutorProcessor{func(o command.Output, d *command.Data) error {
+						format, err := parseGraphFormat(graphFormatFlag.Get(d))
+						if err != nil {
+							return o.Err(err)
+						}
+						return c.graph(o, d, format, &graphFilter{
+							Key:     keyFlag.Get(d),
+							Command: commandFlag.Get(d),
+							Context: contextFlag.Get(d),
+						})
+					}},
+				),
+				"modes": commander.SerialNodes(
+					&commander.ExecutorProcessor{func(o command.Output, d *command.Data) error {
+						return c.modes(o, d)
+					}},
+				),
+				"shell-profile": commander.SerialNodes(
+					commander.FlagProcessor(
+						shellFlag,
+					),
+					&commander.ExecutorProcessor{func(o command.Output, d *command.Data) error {
+						shell, err := parseShell(shellFlag.Get(d))
+						if err != nil {
+							return o.Err(err)
+						}
 
-						return c.regeneratePackageJson(o, d, newVersion)
+						profile, err := shellProfile(shell, groogKeybindings())
+						if err != nil {
+							return o.Annotatef(err, "failed to generate shell profile")
+						}
+						o.Stdout(profile)
+						return nil
 					}},
 				),
 			},
@@ -114,10 +272,34 @@ func (c *cli) Node() command.Node {
 	)
 }
 
+// bumpVersion increments the version section (0 for smallest, 1 for middle,
+// 2 for major) of the version set in the provided package.go contents.
+// Smaller sections are reset to zero and the minor version keeps the current
+// release channel (see nextVersion).
+func bumpVersion(contents string, section int) (string, string, error) {
+	cur, err := currentVersion(contents)
+	if err != nil {
+		return "", "", err
+	}
+	next, err := nextVersion(cur, VersionPart(section), cur.isPreReleaseChannel())
+	if err != nil {
+		return "", "", err
+	}
+	newContents, err := setPackageGoVersion(contents, next)
+	if err != nil {
+		return "", "", err
+	}
+	return newContents, next.String(), nil
+}
+
 func (c *cli) regeneratePackageJson(o command.Output, d *command.Data, versionOverride string) error {
-	filename := filepath.Join(filepath.Dir(filepath.Dir(runtimeNode.Get(d))), "package.json")
+	root := filepath.Dir(filepath.Dir(runtimeNode.Get(d)))
+	filename := filepath.Join(root, "package.json")
 
-	p := groogPackage(versionOverride)
+	p, ds := generateGroogPackage(versionOverride)
+	if err := printDiagnostics(o, ds); err != nil {
+		return err
+	}
 
 	b, err := marshalJson(p)
 	if err != nil {
@@ -128,19 +310,35 @@ func (c *cli) regeneratePackageJson(o command.Output, d *command.Data, versionOv
 		return fmt.Errorf("failed to write json to output file: %v", err)
 	}
 
+	if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(commandArgsTSFile)), []byte(tsInterfaces(p.Contributes.Commands)), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", commandArgsTSFile, err)
+	}
+
 	o.Stdoutln("Successfully updated package.json")
 	return nil
 }
 
+// printDiagnostics prints all of the diagnostics and returns an error if any
+// of them are errors.
+func printDiagnostics(o command.Output, ds *Diagnostics) error {
+	for _, d := range ds.All() {
+		o.Stderrln(d.String())
+	}
+	if ds.HasErrors() {
+		return fmt.Errorf("package generation failed")
+	}
+	return nil
+}
+
 // marhsalJson properly serializes html safe characters.
 // Without this, sometimes json marshaling writes \u0026 and sometimes
 // it writes `&` (for ampersand and other html characters like `<`)
 // This logic ensures we always write the actual characters and not their coded ones.
-func marshalJson(p *Package) ([]byte, error) {
+func marshalJson(v interface{}) ([]byte, error) {
 	unindentedBuffer := bytes.NewBuffer([]byte{})
 	unicodeLiteralEncoder := json.NewEncoder(unindentedBuffer)
 	unicodeLiteralEncoder.SetEscapeHTML(false)
-	if err := unicodeLiteralEncoder.Encode(p); err != nil {
+	if err := unicodeLiteralEncoder.Encode(v); err != nil {
 		return nil, fmt.Errorf("failed to marshal json: %v", err)
 	}
 
@@ -149,5 +347,28 @@ func marshalJson(p *Package) ([]byte, error) {
 		return nil, fmt.Errorf("failed to indent json: %v", err)
 	}
 
-	return indentedBuffer.Bytes(), nil
+	return unicodeControlEscapes(indentedBuffer.Bytes()), nil
+}
+
+// unicodeControlEscapes rewrites the `\b` and `\f` escapes as `\u0008` and
+// `\u000c`. Go 1.22 started using the short escapes, so without this the
+// output would depend on the toolchain version.
+func unicodeControlEscapes(b []byte) []byte {
+	r := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		if b[i] != '\\' || i+1 == len(b) {
+			r = append(r, b[i])
+			continue
+		}
+		i++
+		switch b[i] {
+		case 'b':
+			r = append(r, `\u0008`...)
+		case 'f':
+			r = append(r, `\u000c`...)
+		default:
+			r = append(r, '\\', b[i])
+		}
+	}
+	return r
 }
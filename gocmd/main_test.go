@@ -0,0 +1,172 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestVersionRegex(t *testing.T) {
+	for _, test := range []struct {
+		line string
+		want []string
+	}{
+		{
+			line: "\t\tVersion:     \"2.6.3\",",
+			want: []string{"\t\tVersion:     \"2.6.3\",", "\t\tVersion:     \"", "2.6.3", "\","},
+		},
+		{
+			line: "Version: `1.0.0`,",
+			want: []string{"Version: `1.0.0`,", "Version: `", "1.0.0", "`,"},
+		},
+		{
+			line: "Version: `1.0`,",
+		},
+		{
+			line: "\t\tVersion:     \"2.7.0-beta.1+abc\",",
+			want: []string{"\t\tVersion:     \"2.7.0-beta.1+abc\",", "\t\tVersion:     \"", "2.7.0-beta.1+abc", "\","},
+		},
+		{
+			line: "\t\tVersion:     \"2.6.3\"",
+		},
+		{
+			line: "\t\tVersion:     \"v2.6.3\",",
+		},
+		{
+			line: "\t\tNotVersion:  \"2.6.3\",",
+		},
+	} {
+		t.Run(test.line, func(t *testing.T) {
+			if diff := cmp.Diff(test.want, versionRegex.FindStringSubmatch(test.line)); diff != "" {
+				t.Errorf("versionRegex.FindStringSubmatch(%q) returned incorrect value (-want, +got):\n%s", test.line, diff)
+			}
+		})
+	}
+}
+
+func TestBumpVersion(t *testing.T) {
+	contents := "func p() *Package {\n\treturn &Package{\n\t\tVersion:     \"2.6.3\",\n\t}\n}\n"
+	for _, test := range []struct {
+		name         string
+		contents     string
+		section      int
+		want         string
+		wantContents string
+		wantErr      string
+	}{
+		{
+			name:         "bump patch",
+			contents:     contents,
+			want:         "2.6.4",
+			wantContents: "func p() *Package {\n\treturn &Package{\n\t\tVersion:     \"2.6.4\",\n\t}\n}\n",
+		},
+		{
+			name:         "bump minor",
+			contents:     contents,
+			section:      1,
+			want:         "2.8.0",
+			wantContents: "func p() *Package {\n\treturn &Package{\n\t\tVersion:     \"2.8.0\",\n\t}\n}\n",
+		},
+		{
+			name:         "bump pre-release minor",
+			contents:     "Version: \"2.7.3\",",
+			section:      1,
+			want:         "2.9.0",
+			wantContents: "Version: \"2.9.0\",",
+		},
+		{
+			name:         "bump major",
+			contents:     contents,
+			section:      2,
+			want:         "3.0.0",
+			wantContents: "func p() *Package {\n\treturn &Package{\n\t\tVersion:     \"3.0.0\",\n\t}\n}\n",
+		},
+		{
+			name:         "bump multiple digits",
+			contents:     "Version: \"9.98.9\",",
+			section:      1,
+			want:         "9.100.0",
+			wantContents: "Version: \"9.100.0\",",
+		},
+		{
+			name:         "bump patch with build metadata",
+			contents:     "Version: \"2.8.0+abc\",",
+			want:         "2.8.1",
+			wantContents: "Version: \"2.8.1\",",
+		},
+		{
+			name:         "bump patch of pre-release",
+			contents:     "Version: \"2.6.3-beta.1\",",
+			want:         "2.6.3",
+			wantContents: "Version: \"2.6.3\",",
+		},
+		{
+			name:         "bump minor of pre-release",
+			contents:     "Version: \"2.6.3-beta.1\",",
+			section:      1,
+			want:         "2.8.0",
+			wantContents: "Version: \"2.8.0\",",
+		},
+		{
+			name:     "invalid version",
+			contents: "Version: \"1.02.3\",",
+			wantErr:  `invalid semantic version "1.02.3"`,
+		},
+		{
+			name:     "no version",
+			contents: "func p() {}",
+			wantErr:  "no version found in package.go",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			gotContents, got, err := bumpVersion(test.contents, test.section)
+			var gotErr string
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr); diff != "" {
+				t.Errorf("bumpVersion() returned incorrect error (-want, +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("bumpVersion() returned incorrect version (-want, +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(test.wantContents, gotContents); diff != "" {
+				t.Errorf("bumpVersion() returned incorrect contents (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMarshalJson(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{
+			name: "html characters",
+			v:    map[string]string{"when": "a && b < c"},
+			want: "{\n  \"when\": \"a && b < c\"\n}\n",
+		},
+		{
+			name: "control characters",
+			v:    map[string]string{"text": "\u0018\u0008\u000c\n"},
+			want: "{\n  \"text\": \"\\u0018\\u0008\\u000c\\n\"\n}\n",
+		},
+		{
+			name: "escaped backslashes",
+			v:    map[string]string{"regex": `\b\\f`},
+			want: "{\n  \"regex\": \"\\\\b\\\\\\\\f\"\n}\n",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := marshalJson(test.v)
+			if err != nil {
+				t.Fatalf("marshalJson(%v) returned error: %v", test.v, err)
+			}
+			if diff := cmp.Diff(test.want, string(got)); diff != "" {
+				t.Errorf("marshalJson(%v) returned incorrect value (-want, +got):\n%s", test.v, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// The manifest diff compares the generated package at two revisions in terms
+// of the things that actually matter to users (keys, commands, settings)
+// rather than the thousands of lines of generated json.
+
+const (
+	// workingTreeRevision is the revision name used for the current (possibly
+	// uncommitted) state of the repo.
+	workingTreeRevision = "."
+)
+
+// manifestAtRevision returns the package generated at the provided revision.
+// The working tree's package is generated in process. Other revisions are
+// checked out in a temporary git worktree and generated by running that
+// revision's gocmd. If that fails (e.g. the revision doesn't build), then the
+// package.json committed at that revision is used instead.
+func manifestAtRevision(o command.Output, git gitRunner, rev string) (*Package, error) {
+	if rev == workingTreeRevision {
+		p, ds := generateGroogPackage("")
+		if ds.HasErrors() {
+			return nil, fmt.Errorf("failed to generate package for working tree:\n%s", ds)
+		}
+		return p, nil
+	}
+
+	dir, err := os.MkdirTemp("", "vs-package-diff-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	worktree := filepath.Join(dir, "groog")
+	if _, err := git("worktree", "add", "--detach", worktree, rev); err != nil {
+		return nil, err
+	}
+	defer git("worktree", "remove", "--force", worktree)
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = filepath.Join(worktree, "gocmd")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		o.Stderrf("failed to generate package at %s (using committed package.json instead): %v\n%s\n", rev, err, out)
+	}
+
+	b, err := os.ReadFile(filepath.Join(worktree, "package.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read package.json at %s: %v", rev, err)
+	}
+	p := &Package{}
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("failed to parse package.json at %s: %v", rev, err)
+	}
+	return p, nil
+}
+
+// ManifestDiff is the semantic difference between two packages.
+type ManifestDiff struct {
+	AddedCommands   []*Command
+	RemovedCommands []*Command
+	// RenamedCommands are commands whose title changed.
+	RenamedCommands []*CommandRename
+
+	AddedProperties   []string
+	RemovedProperties []string
+	ChangedProperties []string
+
+	AddedBindings   []*Keybinding
+	RemovedBindings []*Keybinding
+	// ReboundBindings are (key, when) pairs that now run a different command.
+	ReboundBindings []*BindingChange
+	// WhenChangedBindings are key and command pairs whose when clause changed.
+	WhenChangedBindings []*BindingChange
+}
+
+type CommandRename struct {
+	Command  string
+	OldTitle string
+	NewTitle string
+}
+
+type BindingChange struct {
+	Old *Keybinding
+	New *Keybinding
+}
+
+func (md *ManifestDiff) empty() bool {
+	return reflect.DeepEqual(md, &ManifestDiff{})
+}
+
+// diffManifests returns the semantic difference from package a to package b.
+func diffManifests(a, b *Package) *ManifestDiff {
+	md := &ManifestDiff{}
+	ac, bc := a.contributions(), b.contributions()
+
+	// Commands
+	aCmds, bCmds := map[string]*Command{}, map[string]*Command{}
+	for _, c := range ac.Commands {
+		aCmds[c.Command] = c
+	}
+	for _, c := range bc.Commands {
+		bCmds[c.Command] = c
+	}
+	for _, id := range sortedKeys(bCmds) {
+		if old, ok := aCmds[id]; !ok {
+			md.AddedCommands = append(md.AddedCommands, bCmds[id])
+		} else if old.Title != bCmds[id].Title {
+			md.RenamedCommands = append(md.RenamedCommands, &CommandRename{id, old.Title, bCmds[id].Title})
+		}
+	}
+	for _, id := range sortedKeys(aCmds) {
+		if _, ok := bCmds[id]; !ok {
+			md.RemovedCommands = append(md.RemovedCommands, aCmds[id])
+		}
+	}
+
+	// Configuration properties
+	aProps, bProps := ac.Configuration.properties(), bc.Configuration.properties()
+	for _, p := range sortedKeys(bProps) {
+		if old, ok := aProps[p]; !ok {
+			md.AddedProperties = append(md.AddedProperties, p)
+		} else if !jsonEqual(old, bProps[p]) {
+			md.ChangedProperties = append(md.ChangedProperties, p)
+		}
+	}
+	for _, p := range sortedKeys(aProps) {
+		if _, ok := bProps[p]; !ok {
+			md.RemovedProperties = append(md.RemovedProperties, p)
+		}
+	}
+
+	// Keybindings
+	type keyWhen struct {
+		key, when string
+	}
+	aKBs, bKBs := map[keyWhen]*Keybinding{}, map[keyWhen]*Keybinding{}
+	var aOrder, bOrder []keyWhen
+	for _, kb := range withoutLeaderAliases(ac.Keybindings) {
+		kw := keyWhen{kb.Key, bindingWhen(kb)}
+		if _, ok := aKBs[kw]; !ok {
+			aOrder = append(aOrder, kw)
+		}
+		aKBs[kw] = kb
+	}
+	for _, kb := range withoutLeaderAliases(bc.Keybindings) {
+		kw := keyWhen{kb.Key, bindingWhen(kb)}
+		if _, ok := bKBs[kw]; !ok {
+			bOrder = append(bOrder, kw)
+		}
+		bKBs[kw] = kb
+	}
+
+	var added, removed []*Keybinding
+	for _, kw := range bOrder {
+		bkb := bKBs[kw]
+		akb, ok := aKBs[kw]
+		if !ok {
+			added = append(added, bkb)
+		} else if akb.Command != bkb.Command || !jsonEqual(akb.Args, bkb.Args) {
+			md.ReboundBindings = append(md.ReboundBindings, &BindingChange{akb, bkb})
+		}
+	}
+	for _, kw := range aOrder {
+		if _, ok := bKBs[kw]; !ok {
+			removed = append(removed, aKBs[kw])
+		}
+	}
+
+	// Pair up removed and added bindings for the same key and command
+	// (i.e. only the when clause changed).
+	for _, akb := range removed {
+		idx := slices.IndexFunc(added, func(bkb *Keybinding) bool {
+			return bkb.Key == akb.Key && bkb.Command == akb.Command && jsonEqual(akb.Args, bkb.Args)
+		})
+		if idx < 0 {
+			md.RemovedBindings = append(md.RemovedBindings, akb)
+			continue
+		}
+		md.WhenChangedBindings = append(md.WhenChangedBindings, &BindingChange{akb, added[idx]})
+		added = slices.Delete(added, idx, idx+1)
+	}
+	md.AddedBindings = added
+
+	return md
+}
+
+func (p *Package) contributions() *Contribution {
+	if p.Contributes == nil {
+		return &Contribution{}
+	}
+	return p.Contributes
+}
+
+func (c *Configuration) properties() map[string]map[string]interface{} {
+	if c == nil {
+		return nil
+	}
+	return c.Properties
+}
+
+// bindingWhen returns the when clause that identifies the binding. Removals
+// are keyed separately so they don't collide with the binding they replace.
+func bindingWhen(kb *Keybinding) string {
+	if strings.HasPrefix(kb.Command, "-") {
+		return fmt.Sprintf("%s (removal of %s)", kb.When, kb.Command)
+	}
+	return kb.When
+}
+
+// withoutLeaderAliases removes the bindings that were only added as leader
+// key aliases (see Key.keyAliases) of another binding.
+func withoutLeaderAliases(kbs []*Keybinding) []*Keybinding {
+	type binding struct {
+		key, when, command, args string
+	}
+	toBinding := func(key string, kb *Keybinding) binding {
+		return binding{key, kb.When, kb.Command, jsonString(kb.Args)}
+	}
+
+	aliases := map[binding]bool{}
+	for _, kb := range kbs {
+		if alias, ok := popLeader(Key(kb.Key)); ok {
+			aliases[toBinding(alias, kb)] = true
+		}
+	}
+
+	var r []*Keybinding
+	for _, kb := range kbs {
+		if !aliases[toBinding(kb.Key, kb)] {
+			r = append(r, kb)
+		}
+	}
+	return r
+}
+
+func (md *ManifestDiff) String() string {
+	if md.empty() {
+		return "No semantic changes\n"
+	}
+
+	var sections []string
+	add := func(title string, lines []string) {
+		if len(lines) > 0 {
+			sections = append(sections, fmt.Sprintf("%s:\n%s", title, strings.Join(lines, "\n")))
+		}
+	}
+
+	var cmds []string
+	for _, c := range md.AddedCommands {
+		cmds = append(cmds, fmt.Sprintf("  + %s (%s)", c.Command, c.Title))
+	}
+	for _, c := range md.RemovedCommands {
+		cmds = append(cmds, fmt.Sprintf("  - %s (%s)", c.Command, c.Title))
+	}
+	for _, c := range md.RenamedCommands {
+		cmds = append(cmds, fmt.Sprintf("  ~ %s: %q -> %q", c.Command, c.OldTitle, c.NewTitle))
+	}
+	add("Commands", cmds)
+
+	var props []string
+	for _, p := range md.AddedProperties {
+		props = append(props, fmt.Sprintf("  + %s", p))
+	}
+	for _, p := range md.RemovedProperties {
+		props = append(props, fmt.Sprintf("  - %s", p))
+	}
+	for _, p := range md.ChangedProperties {
+		props = append(props, fmt.Sprintf("  ~ %s", p))
+	}
+	add("Configuration", props)
+
+	var kbs []string
+	for _, kb := range md.AddedBindings {
+		kbs = append(kbs, fmt.Sprintf("  + %s", describeBinding(kb)))
+	}
+	for _, kb := range md.RemovedBindings {
+		kbs = append(kbs, fmt.Sprintf("  - %s", describeBinding(kb)))
+	}
+	for _, c := range md.ReboundBindings {
+		kbs = append(kbs, fmt.Sprintf("  ~ %s%s: %s -> %s", c.New.Key, describeWhen(c.New.When), describeCommand(c.Old), describeCommand(c.New)))
+	}
+	for _, c := range md.WhenChangedBindings {
+		kbs = append(kbs, fmt.Sprintf("  ~ %s -> %s: when %q -> %q", c.New.Key, describeCommand(c.New), c.Old.When, c.New.When))
+	}
+	add("Keybindings", kbs)
+
+	return strings.Join(sections, "\n\n") + "\n"
+}
+
+func describeBinding(kb *Keybinding) string {
+	return fmt.Sprintf("%s%s -> %s", kb.Key, describeWhen(kb.When), describeCommand(kb))
+}
+
+func describeWhen(when string) string {
+	if when == "" {
+		return ""
+	}
+	return fmt.Sprintf(" [%s]", when)
+}
+
+func describeCommand(kb *Keybinding) string {
+	if len(kb.Args) == 0 {
+		return kb.Command
+	}
+	// Terminal sequences are shown as the keys they're made of.
+	if text, ok := kb.Args["text"].(string); ok && kb.Command == sendSequenceCommand && len(kb.Args) == 1 {
+		return fmt.Sprintf("%s (%s)", kb.Command, describeTermSequence(text))
+	}
+	return fmt.Sprintf("%s %s", kb.Command, jsonString(kb.Args))
+}
+
+// jsonString returns the canonical json representation of v (i.e. object
+// keys are always sorted, regardless of whether v is a struct or a map).
+func jsonString(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	var generic interface{}
+	if err := json.Unmarshal(b, &generic); err != nil {
+		return string(b)
+	}
+	if b, err = json.Marshal(generic); err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
+
+// jsonEqual compares values by their json representation (so values parsed
+// from package.json compare equal to the generated values).
+func jsonEqual(a, b interface{}) bool {
+	return jsonString(a) == jsonString(b)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := maps.Keys(m)
+	slices.Sort(keys)
+	return keys
+}
+
+// diff prints the semantic difference between the packages at two revisions.
+func (c *cli) diff(o command.Output, d *command.Data, revA, revB string) error {
+	git := localGit(filepath.Dir(filepath.Dir(runtimeNode.Get(d))))
+
+	a, err := manifestAtRevision(o, git, revA)
+	if err != nil {
+		return o.Annotatef(err, "failed to build package at %s", revA)
+	}
+	b, err := manifestAtRevision(o, git, revB)
+	if err != nil {
+		return o.Annotatef(err, "failed to build package at %s", revB)
+	}
+
+	o.Stdout(diffManifests(a, b).String())
+	return nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func testPackage(cmds []*Command, props map[string]map[string]interface{}, kbs []*Keybinding) *Package {
+	return &Package{
+		Contributes: &Contribution{
+			Commands:      cmds,
+			Keybindings:   kbs,
+			Configuration: &Configuration{Properties: props},
+		},
+	}
+}
+
+func TestDiffManifests(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		a          *Package
+		b          *Package
+		want       *ManifestDiff
+		wantString string
+	}{
+		{
+			name:       "empty packages",
+			a:          &Package{},
+			b:          &Package{},
+			want:       &ManifestDiff{},
+			wantString: "No semantic changes\n",
+		},
+		{
+			name: "identical packages",
+			a: testPackage(
+				[]*Command{{Command: "groog.a", Title: "A"}},
+				map[string]map[string]interface{}{"groog.p": {"type": "string"}},
+				[]*Keybinding{{Key: "ctrl+a", Command: "groog.a", When: "editorTextFocus"}},
+			),
+			b: testPackage(
+				[]*Command{{Command: "groog.a", Title: "A"}},
+				map[string]map[string]interface{}{"groog.p": {"type": "string"}},
+				[]*Keybinding{{Key: "ctrl+a", Command: "groog.a", When: "editorTextFocus"}},
+			),
+			want:       &ManifestDiff{},
+			wantString: "No semantic changes\n",
+		},
+		{
+			name: "command changes",
+			a: testPackage([]*Command{
+				{Command: "groog.a", Title: "A"},
+				{Command: "groog.b", Title: "B"},
+				{Command: "groog.c", Title: "C"},
+			}, nil, nil),
+			b: testPackage([]*Command{
+				{Command: "groog.a", Title: "A"},
+				{Command: "groog.c", Title: "See"},
+				{Command: "groog.d", Title: "D"},
+			}, nil, nil),
+			want: &ManifestDiff{
+				AddedCommands:   []*Command{{Command: "groog.d", Title: "D"}},
+				RemovedCommands: []*Command{{Command: "groog.b", Title: "B"}},
+				RenamedCommands: []*CommandRename{{"groog.c", "C", "See"}},
+			},
+			wantString: `Commands:
+  + groog.d (D)
+  - groog.b (B)
+  ~ groog.c: "C" -> "See"
+`,
+		},
+		{
+			name: "configuration changes",
+			a: testPackage(nil, map[string]map[string]interface{}{
+				"groog.keep":    {"type": "string"},
+				"groog.remove":  {"type": "string"},
+				"groog.changed": {"type": "string", "default": "a"},
+			}, nil),
+			b: testPackage(nil, map[string]map[string]interface{}{
+				"groog.keep":    {"type": "string"},
+				"groog.add":     {"type": "boolean"},
+				"groog.changed": {"type": "string", "default": "b"},
+			}, nil),
+			want: &ManifestDiff{
+				AddedProperties:   []string{"groog.add"},
+				RemovedProperties: []string{"groog.remove"},
+				ChangedProperties: []string{"groog.changed"},
+			},
+			wantString: `Configuration:
+  + groog.add
+  - groog.remove
+  ~ groog.changed
+`,
+		},
+		{
+			name: "keybinding changes",
+			a: testPackage(nil, nil, []*Keybinding{
+				{Key: "ctrl+a", Command: "groog.a"},
+				{Key: "ctrl+b", Command: "groog.b", When: "editorTextFocus"},
+				{Key: "ctrl+c", Command: "groog.c", When: "editorTextFocus"},
+				{Key: "ctrl+d", Command: "groog.type", Args: map[string]interface{}{"text": "d"}},
+			}),
+			b: testPackage(nil, nil, []*Keybinding{
+				{Key: "ctrl+b", Command: "groog.other", When: "editorTextFocus"},
+				{Key: "ctrl+c", Command: "groog.c", When: "!editorTextFocus"},
+				{Key: "ctrl+d", Command: "groog.type", Args: map[string]interface{}{"text": "D"}},
+				{Key: "ctrl+e", Command: "groog.e", When: "terminalFocus"},
+			}),
+			want: &ManifestDiff{
+				AddedBindings:   []*Keybinding{{Key: "ctrl+e", Command: "groog.e", When: "terminalFocus"}},
+				RemovedBindings: []*Keybinding{{Key: "ctrl+a", Command: "groog.a"}},
+				ReboundBindings: []*BindingChange{
+					{
+						Old: &Keybinding{Key: "ctrl+b", Command: "groog.b", When: "editorTextFocus"},
+						New: &Keybinding{Key: "ctrl+b", Command: "groog.other", When: "editorTextFocus"},
+					},
+					{
+						Old: &Keybinding{Key: "ctrl+d", Command: "groog.type", Args: map[string]interface{}{"text": "d"}},
+						New: &Keybinding{Key: "ctrl+d", Command: "groog.type", Args: map[string]interface{}{"text": "D"}},
+					},
+				},
+				WhenChangedBindings: []*BindingChange{{
+					Old: &Keybinding{Key: "ctrl+c", Command: "groog.c", When: "editorTextFocus"},
+					New: &Keybinding{Key: "ctrl+c", Command: "groog.c", When: "!editorTextFocus"},
+				}},
+			},
+			wantString: `Keybindings:
+  + ctrl+e [terminalFocus] -> groog.e
+  - ctrl+a -> groog.a
+  ~ ctrl+b [editorTextFocus]: groog.b -> groog.other
+  ~ ctrl+d: groog.type {"text":"d"} -> groog.type {"text":"D"}
+  ~ ctrl+c -> groog.c: when "editorTextFocus" -> "!editorTextFocus"
+`,
+		},
+		{
+			name: "leader aliases are collapsed",
+			a:    testPackage(nil, nil, nil),
+			b: testPackage(nil, nil, []*Keybinding{
+				{Key: "ctrl+x s", Command: "groog.save"},
+				{Key: "ctrl+x ctrl+s", Command: "groog.save"},
+			}),
+			want: &ManifestDiff{
+				AddedBindings: []*Keybinding{{Key: "ctrl+x s", Command: "groog.save"}},
+			},
+			wantString: `Keybindings:
+  + ctrl+x s -> groog.save
+`,
+		},
+		{
+			name: "leader key bound to a different command is not an alias",
+			a:    testPackage(nil, nil, nil),
+			b: testPackage(nil, nil, []*Keybinding{
+				{Key: "ctrl+x s", Command: "groog.save"},
+				{Key: "ctrl+x ctrl+s", Command: "groog.other"},
+			}),
+			want: &ManifestDiff{
+				AddedBindings: []*Keybinding{
+					{Key: "ctrl+x s", Command: "groog.save"},
+					{Key: "ctrl+x ctrl+s", Command: "groog.other"},
+				},
+			},
+			wantString: `Keybindings:
+  + ctrl+x s -> groog.save
+  + ctrl+x ctrl+s -> groog.other
+`,
+		},
+		{
+			name: "removals don't collide with bindings",
+			a: testPackage(nil, nil, []*Keybinding{
+				{Key: "ctrl+a", Command: "groog.a", When: "editorTextFocus"},
+			}),
+			b: testPackage(nil, nil, []*Keybinding{
+				{Key: "ctrl+a", Command: "groog.a", When: "editorTextFocus"},
+				{Key: "ctrl+a", Command: "-cursorHome", When: "editorTextFocus"},
+			}),
+			want: &ManifestDiff{
+				AddedBindings: []*Keybinding{{Key: "ctrl+a", Command: "-cursorHome", When: "editorTextFocus"}},
+			},
+			wantString: `Keybindings:
+  + ctrl+a [editorTextFocus] -> -cursorHome
+`,
+		},
+		{
+			name: "terminal sequences are shown as keys",
+			a:    testPackage(nil, nil, nil),
+			b: testPackage(nil, nil, []*Keybinding{
+				{Key: "ctrl+x ctrl+h", Command: sendSequenceCommand, Args: map[string]interface{}{"text": "\u0018\u0008"}},
+				{Key: "ctrl+v", Command: sendSequenceCommand, Args: map[string]interface{}{"text": "\u001b[6~"}},
+			}),
+			want: &ManifestDiff{
+				AddedBindings: []*Keybinding{
+					{Key: "ctrl+x ctrl+h", Command: sendSequenceCommand, Args: map[string]interface{}{"text": "\u0018\u0008"}},
+					{Key: "ctrl+v", Command: sendSequenceCommand, Args: map[string]interface{}{"text": "\u001b[6~"}},
+				},
+			},
+			wantString: `Keybindings:
+  + ctrl+x ctrl+h -> workbench.action.terminal.sendSequence (C-x C-h)
+  + ctrl+v -> workbench.action.terminal.sendSequence (pagedown)
+`,
+		},
+		{
+			name: "generated and parsed args are equal",
+			a: testPackage(nil, nil, []*Keybinding{
+				{Key: "ctrl+a", Command: "groog.multiCommand.execute", Args: map[string]interface{}{
+					"sequence": []*KB{{Command: "groog.a", Async: async(true)}},
+				}},
+			}),
+			b: testPackage(nil, nil, []*Keybinding{
+				{Key: "ctrl+a", Command: "groog.multiCommand.execute", Args: map[string]interface{}{
+					"sequence": []interface{}{map[string]interface{}{"command": "groog.a", "async": true}},
+				}},
+			}),
+			want:       &ManifestDiff{},
+			wantString: "No semantic changes\n",
+		},
+		{
+			name: "all sections",
+			a: testPackage(
+				nil,
+				map[string]map[string]interface{}{"groog.p": {"type": "string"}},
+				[]*Keybinding{{Key: "ctrl+a", Command: "groog.a"}},
+			),
+			b: testPackage(
+				[]*Command{{Command: "groog.a", Title: "A"}},
+				nil,
+				nil,
+			),
+			want: &ManifestDiff{
+				AddedCommands:     []*Command{{Command: "groog.a", Title: "A"}},
+				RemovedProperties: []string{"groog.p"},
+				RemovedBindings:   []*Keybinding{{Key: "ctrl+a", Command: "groog.a"}},
+			},
+			wantString: `Commands:
+  + groog.a (A)
+
+Configuration:
+  - groog.p
+
+Keybindings:
+  - ctrl+a -> groog.a
+`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := diffManifests(test.a, test.b)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("diffManifests() returned incorrect value (-want, +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(test.wantString, got.String()); diff != "" {
+				t.Errorf("diffManifests().String() returned incorrect value (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDiffManifestsGroogPackage(t *testing.T) {
+	p, ds := generateGroogPackage("")
+	if ds.HasErrors() {
+		t.Fatalf("generateGroogPackage() returned errors:\n%s", ds)
+	}
+	if got := diffManifests(p, p); !got.empty() {
+		t.Errorf("diffManifests(p, p) returned non-empty diff:\n%s", got)
+	}
+}
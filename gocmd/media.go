@@ -0,0 +1,13 @@
+package main
+
+import "fmt"
+
+// groogMedia returns the media files that the extension loads at runtime
+// (see src/color_mode.ts).
+func groogMedia() []string {
+	var media []string
+	for _, mode := range []string{"find", "mark", "record"} {
+		media = append(media, fmt.Sprintf("media/%s-gutter-icon.jpg", mode))
+	}
+	return media
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// The extension's modes (see setGroogContext in src/interfaces.ts) are set
+// and cleared by commands (see Command.Enters, Command.Exits, and
+// Command.Toggles) and read by when clauses. The modes are modeled as a state
+// machine (one state per combination of active modes) whose transitions are
+// the keybindings (and the commands, which can also be run from the command
+// palette) that change the active modes. The machine is used to verify that
+// every mode can be exited (with ctrl+g where expected) and that no binding
+// depends on a combination of modes that never occurs.
+
+// GroogMode is a mode set by the extension.
+type GroogMode struct {
+	Name string
+	// Setting is whether the mode is a setting that's saved across sessions
+	// (so it may already be set when VS Code starts). Settings are changed
+	// explicitly, so they don't need to be exitable.
+	Setting bool
+	// KeepOnCtrlG is whether ctrl+g leaves the mode active (every other mode
+	// must be exitable with ctrl+g).
+	KeepOnCtrlG bool
+	// Location is where the mode is defined.
+	Location Location
+}
+
+// groogMode returns the mode with the location of its definition.
+func groogMode(m GroogMode) *GroogMode {
+	m.Location = dslLocation()
+	return &m
+}
+
+// groogModes returns the modes set by the extension.
+func groogModes() []*GroogMode {
+	return []*GroogMode{
+		groogMode(GroogMode{Name: "find"}),
+		groogMode(GroogMode{Name: "find.simple", Setting: true}),
+		groogMode(GroogMode{Name: "mark"}),
+		groogMode(GroogMode{Name: "qmk", Setting: true}),
+		// Recordings are ended explicitly (see groog.record.endRecording).
+		groogMode(GroogMode{Name: "record", KeepOnCtrlG: true}),
+		groogMode(GroogMode{Name: "terminal.find"}),
+	}
+}
+
+// modeState is a combination of active modes (bit i is set if the i-th mode
+// is active).
+type modeState uint
+
+type modeTransition struct {
+	From, To modeState
+}
+
+// modeKeyBindings are the bindings (that aren't removed) for a key.
+type modeKeyBindings struct {
+	key   string
+	kbs   []*Keybinding
+	exprs []whenExpr
+	wv    *whenVariables
+	// modeAtoms maps the index of each mode's atom to the mode's index.
+	modeAtoms map[int]int
+}
+
+// modeMachine is the state machine of the modes.
+type modeMachine struct {
+	modes []*GroogMode
+	// initial are the states that VS Code can start in.
+	initial []modeState
+	// states are the reachable states (in ascending order).
+	states []modeState
+	// transitions are the labels (keybindings or commands) for each
+	// transition between different states.
+	transitions map[modeTransition]map[string]bool
+
+	commands    map[string]*Command
+	keys        []*modeKeyBindings
+	ctrlGWinner map[modeState][]*Keybinding
+}
+
+// stateName returns the active modes in the state.
+func (mm *modeMachine) stateName(s modeState) string {
+	var names []string
+	for i, m := range mm.modes {
+		if s>>i&1 == 1 {
+			names = append(names, m.Name)
+		}
+	}
+	if len(names) == 0 {
+		return "(none)"
+	}
+	return strings.Join(names, " + ")
+}
+
+// apply returns the state after running the keybinding's commands.
+func (mm *modeMachine) apply(s modeState, kb *Keybinding) modeState {
+	index := func(name string) int {
+		return slices.IndexFunc(mm.modes, func(m *GroogMode) bool { return m.Name == name })
+	}
+	for _, c := range keybindingCommands(kb) {
+		pc, ok := mm.commands[c.Command]
+		if !ok {
+			continue
+		}
+		for _, name := range pc.Enters {
+			if i := index(name); i >= 0 {
+				s |= 1 << i
+			}
+		}
+		for _, name := range pc.Exits {
+			if i := index(name); i >= 0 {
+				s &^= 1 << i
+			}
+		}
+		for _, name := range pc.Toggles {
+			if i := index(name); i >= 0 {
+				s ^= 1 << i
+			}
+		}
+	}
+	return s
+}
+
+// consistent returns whether the row assigns the modes' atoms the values in
+// the state.
+func (mkb *modeKeyBindings) consistent(s modeState, row uint) bool {
+	for j, i := range mkb.modeAtoms {
+		if row>>j&1 != uint(s>>i&1) {
+			return false
+		}
+	}
+	return true
+}
+
+// winners returns the bindings that run when the key is pressed in some
+// context while the modes in the state are active.
+func (mkb *modeKeyBindings) winners(s modeState) []*Keybinding {
+	if len(mkb.wv.atoms) > maxWhenVariables {
+		// Too many variables to check, so any binding could win.
+		return mkb.kbs
+	}
+	won := map[int]bool{}
+	for row := uint(0); row < 1<<len(mkb.wv.atoms); row++ {
+		if !mkb.consistent(s, row) || !mkb.wv.possible(row) {
+			continue
+		}
+		winner := -1
+		for i, e := range mkb.exprs {
+			if mkb.wv.eval(e, row) {
+				winner = i
+			}
+		}
+		if winner >= 0 {
+			won[winner] = true
+		}
+	}
+	var kbs []*Keybinding
+	for i, kb := range mkb.kbs {
+		if won[i] {
+			kbs = append(kbs, kb)
+		}
+	}
+	return kbs
+}
+
+// matches returns whether the binding's when clause can be true while the
+// modes in the state are active.
+func (mkb *modeKeyBindings) matches(s modeState, i int) bool {
+	if len(mkb.wv.atoms) > maxWhenVariables {
+		return true
+	}
+	for row := uint(0); row < 1<<len(mkb.wv.atoms); row++ {
+		if mkb.consistent(s, row) && mkb.wv.possible(row) && mkb.wv.eval(mkb.exprs[i], row) {
+			return true
+		}
+	}
+	return false
+}
+
+// whenUsesModes returns whether the when clause depends on any of the modes.
+func whenUsesModes(e whenExpr, modes []*GroogMode) bool {
+	uses := false
+	whenKeys(e, func(key string) {
+		uses = uses || slices.ContainsFunc(modes, func(m *GroogMode) bool { return key == groogContext(m.Name) })
+	})
+	return uses
+}
+
+// newModeMachine builds the state machine for the modes from the package's
+// commands and keybindings.
+func newModeMachine(ds *Diagnostics, modes []*GroogMode, contexts []*ContextKey, p *Package) *modeMachine {
+	mm := &modeMachine{
+		modes:       modes,
+		transitions: map[modeTransition]map[string]bool{},
+		commands:    map[string]*Command{},
+		ctrlGWinner: map[modeState][]*Keybinding{},
+	}
+
+	modeIndex := map[string]int{}
+	for i, m := range modes {
+		modeIndex[m.Name] = i
+	}
+	var palette []*Command
+	for _, c := range p.Contributes.Commands {
+		for _, name := range append(append(append([]string{}, c.Enters...), c.Exits...), c.Toggles...) {
+			if _, ok := modeIndex[name]; !ok {
+				ds.ErrorAt(c.Location, "command %q declares unknown groog mode %q", c.Command, name)
+			}
+		}
+		if len(c.Enters)+len(c.Exits)+len(c.Toggles) > 0 {
+			mm.commands[c.Command] = c
+			palette = append(palette, c)
+		}
+	}
+
+	// Group the bindings by key (only keys that can change the modes, and
+	// ctrl+g, are needed).
+	changesModes := map[string]bool{string(ctrl("g")): true}
+	for _, kb := range p.Contributes.Keybindings {
+		changesModes[kb.Key] = changesModes[kb.Key] || slices.ContainsFunc(keybindingCommands(kb), func(c *KB) bool {
+			_, ok := mm.commands[c.Command]
+			return ok
+		})
+	}
+	excludes := contextExclusions(contexts)
+	byKey := map[string]*modeKeyBindings{}
+	kbs := p.Contributes.Keybindings
+	for i, kb := range kbs {
+		if strings.HasPrefix(kb.Command, "-") || slices.ContainsFunc(kbs[i+1:], func(r *Keybinding) bool {
+			return r.Key == kb.Key && removes(r, kb)
+		}) {
+			continue
+		}
+		e, err := parseWhen(kb.When)
+		if err != nil {
+			// Reported by checkWhen
+			continue
+		}
+		if !changesModes[kb.Key] && !whenUsesModes(e, modes) {
+			continue
+		}
+		mkb, ok := byKey[kb.Key]
+		if !ok {
+			mkb = &modeKeyBindings{
+				key:       kb.Key,
+				wv:        &whenVariables{ids: map[string]int{}, excludes: excludes},
+				modeAtoms: map[int]int{},
+			}
+			byKey[kb.Key] = mkb
+			mm.keys = append(mm.keys, mkb)
+		}
+		mkb.kbs = append(mkb.kbs, kb)
+		mkb.exprs = append(mkb.exprs, e)
+		mkb.wv.collect(e)
+	}
+	for _, mkb := range mm.keys {
+		for j, a := range mkb.wv.atoms {
+			for i, m := range modes {
+				if a.id == groogContext(m.Name) {
+					mkb.modeAtoms[j] = i
+				}
+			}
+		}
+	}
+
+	// Settings may be set on startup
+	var settings []int
+	for i, m := range modes {
+		if m.Setting {
+			settings = append(settings, i)
+		}
+	}
+	for combo := 0; combo < 1<<len(settings); combo++ {
+		var s modeState
+		for j, i := range settings {
+			if combo>>j&1 == 1 {
+				s |= 1 << i
+			}
+		}
+		mm.initial = append(mm.initial, s)
+	}
+
+	visited := map[modeState]bool{}
+	queue := append([]modeState{}, mm.initial...)
+	for _, s := range queue {
+		visited[s] = true
+	}
+	addTransition := func(from, to modeState, label string) {
+		if from == to {
+			return
+		}
+		t := modeTransition{from, to}
+		if mm.transitions[t] == nil {
+			mm.transitions[t] = map[string]bool{}
+		}
+		mm.transitions[t][label] = true
+		if !visited[to] {
+			visited[to] = true
+			queue = append(queue, to)
+		}
+	}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		for _, mkb := range mm.keys {
+			if !changesModes[mkb.key] {
+				continue
+			}
+			winners := mkb.winners(s)
+			if mkb.key == string(ctrl("g")) {
+				mm.ctrlGWinner[s] = winners
+			}
+			for _, kb := range winners {
+				addTransition(s, mm.apply(s, kb), fmt.Sprintf("%s: %s", kb.Key, keybindingLabel(kb)))
+			}
+		}
+		for _, c := range palette {
+			addTransition(s, mm.apply(s, &Keybinding{Command: c.Command}), c.Command)
+		}
+	}
+	mm.states = maps.Keys(visited)
+	slices.Sort(mm.states)
+	return mm
+}
+
+// check records diagnostics for modes that can't be entered or exited and
+// for bindings that depend on combinations of modes that never occur.
+func (mm *modeMachine) check(ds *Diagnostics) {
+	for i, m := range mm.modes {
+		active := func(s modeState) bool { return s>>i&1 == 1 }
+
+		if !slices.ContainsFunc(mm.states, active) {
+			ds.ErrorAt(m.Location, "groog mode %q can never be entered", m.Name)
+			continue
+		}
+		if m.Setting {
+			continue
+		}
+
+		exited := false
+		for t := range mm.transitions {
+			exited = exited || (active(t.From) && !active(t.To))
+		}
+		if !exited {
+			ds.ErrorAt(m.Location, "groog mode %q can never be exited", m.Name)
+			continue
+		}
+
+		if m.KeepOnCtrlG {
+			continue
+		}
+		for _, s := range mm.states {
+			if active(s) && !slices.ContainsFunc(mm.ctrlGWinner[s], func(kb *Keybinding) bool {
+				return !active(mm.apply(s, kb))
+			}) {
+				ds.ErrorAt(m.Location, "groog mode %q can't be exited with ctrl+g when the active modes are %s", m.Name, mm.stateName(s))
+				break
+			}
+		}
+	}
+
+	for _, mkb := range mm.keys {
+		if len(mkb.modeAtoms) == 0 {
+			continue
+		}
+		for i, kb := range mkb.kbs {
+			if !slices.ContainsFunc(mm.states, func(s modeState) bool { return mkb.matches(s, i) }) {
+				ds.ErrorAt(kb.Location, "binding for %s (%s when %q) requires a combination of groog modes that never occurs", kb.Key, kb.Command, kb.When)
+			}
+		}
+	}
+}
+
+// checkModes verifies the state machine of the modes.
+func checkModes(ds *Diagnostics, modes []*GroogMode, contexts []*ContextKey, p *Package) {
+	newModeMachine(ds, modes, contexts, p).check(ds)
+}
+
+// dot returns the state machine in the Graphviz DOT language.
+func (mm *modeMachine) dot() string {
+	r := []string{
+		"digraph modes {",
+		"  rankdir=LR;",
+	}
+	id := func(s modeState) string {
+		return dotQuote(fmt.Sprintf("state:%s", mm.stateName(s)))
+	}
+	for _, s := range mm.states {
+		shape := "ellipse"
+		if slices.Contains(mm.initial, s) {
+			shape = "doublecircle"
+		}
+		r = append(r, fmt.Sprintf("  %s [label=%s, shape=%s];", id(s), dotQuote(mm.stateName(s)), shape))
+	}
+	ts := maps.Keys(mm.transitions)
+	sortFunc(ts, func(a, b modeTransition) bool {
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		return a.To < b.To
+	})
+	for _, t := range ts {
+		r = append(r, fmt.Sprintf("  %s -> %s [label=%s];", id(t.From), id(t.To), dotQuote(strings.Join(sortedKeys(mm.transitions[t]), "\n"))))
+	}
+	r = append(r, "}")
+	return strings.Join(r, "\n") + "\n"
+}
+
+func (c *cli) modes(o command.Output, d *command.Data) error {
+	p, ds := generateGroogPackage("")
+	if err := printDiagnostics(o, ds); err != nil {
+		return err
+	}
+
+	// The machine's problems were already reported when the package was built.
+	defs := groogDefinitions()
+	o.Stdout(newModeMachine(&Diagnostics{}, defs.Modes, defs.Contexts, p).dot())
+	return nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestModeMachine(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		modes    []*GroogMode
+		commands []*Command
+		kbs      []*Keybinding
+		// wantStates are the names of the reachable states.
+		wantStates      []string
+		wantTransitions map[string][]string
+		wantDiagnostics []string
+	}{
+		{
+			name:       "no modes",
+			wantStates: []string{"(none)"},
+		},
+		{
+			name: "valid modes",
+			modes: []*GroogMode{
+				{Name: "a"},
+				{Name: "b", Setting: true},
+				{Name: "c", KeepOnCtrlG: true},
+			},
+			commands: []*Command{
+				enters(cc("x.startA", "Start A"), "a"),
+				exits(cc("x.ctrlG", "Ctrl-G"), "a"),
+				enters(cc("x.startC", "Start C"), "c"),
+				exits(cc("x.endC", "End C"), "c"),
+				cc("x.other", "Other"),
+			},
+			kbs: []*Keybinding{
+				{Key: "ctrl+a", Command: "x.startA", When: "groog.context.bMode"},
+				{Key: "ctrl+g", Command: "x.ctrlG"},
+				{Key: "ctrl+g", Command: "x.other", When: "editorFocus"},
+				{Key: "ctrl+c", Command: "x.endC", When: "groog.context.cMode"},
+				{Key: "ctrl+c", Command: "x.startC", When: "!groog.context.cMode"},
+			},
+			wantStates: []string{"(none)", "a", "b", "a + b", "c", "a + c", "b + c", "a + b + c"},
+			wantTransitions: map[string][]string{
+				"(none) -> a":        {"x.startA"},
+				"(none) -> c":        {"ctrl+c: x.startC", "x.startC"},
+				"a -> (none)":        {"ctrl+g: x.ctrlG", "x.ctrlG"},
+				"a -> a + c":         {"ctrl+c: x.startC", "x.startC"},
+				"b -> a + b":         {"ctrl+a: x.startA", "x.startA"},
+				"b -> b + c":         {"ctrl+c: x.startC", "x.startC"},
+				"a + b -> b":         {"ctrl+g: x.ctrlG", "x.ctrlG"},
+				"a + b -> a + b + c": {"ctrl+c: x.startC", "x.startC"},
+				"c -> (none)":        {"ctrl+c: x.endC", "x.endC"},
+				"c -> a + c":         {"x.startA"},
+				"a + c -> a":         {"ctrl+c: x.endC", "x.endC"},
+				"a + c -> c":         {"ctrl+g: x.ctrlG", "x.ctrlG"},
+				"b + c -> b":         {"ctrl+c: x.endC", "x.endC"},
+				"b + c -> a + b + c": {"ctrl+a: x.startA", "x.startA"},
+				"a + b + c -> a + b": {"ctrl+c: x.endC", "x.endC"},
+				"a + b + c -> b + c": {"ctrl+g: x.ctrlG", "x.ctrlG"},
+			},
+		},
+		{
+			name: "multi-command",
+			modes: []*GroogMode{
+				{Name: "a"},
+			},
+			commands: []*Command{
+				toggles(cc("x.toggleA", "Toggle A"), "a"),
+				ccArgs("groog.multiCommand.execute", "Multi-command", MultiCommandArgs{}),
+			},
+			kbs: []*Keybinding{
+				{Key: "ctrl+g", Command: "groog.multiCommand.execute", Args: argsMap(MultiCommandArgs{Sequence: []*KB{kb("x.toggleA"), kb("x.other")}}), When: "groog.context.aMode"},
+			},
+			wantStates: []string{"(none)", "a"},
+			wantTransitions: map[string][]string{
+				"(none) -> a": {"x.toggleA"},
+				"a -> (none)": {"ctrl+g: groog.multiCommand.execute [x.toggleA, x.other]", "x.toggleA"},
+			},
+		},
+		{
+			name: "invalid modes",
+			modes: []*GroogMode{
+				{Name: "a"},
+				{Name: "b"},
+				{Name: "c"},
+				{Name: "d"},
+				{Name: "e", Setting: true},
+			},
+			commands: []*Command{
+				enters(cc("x.startA", "Start A"), "a", "z"),
+				enters(cc("x.startB", "Start B"), "b"),
+				exits(cc("x.endB", "End B"), "b"),
+				enters(cc("x.startC", "Start C"), "c"),
+				exits(cc("x.ctrlG", "Ctrl-G"), "c"),
+				exits(cc("x.endD", "End D"), "d"),
+			},
+			kbs: []*Keybinding{
+				{Key: "ctrl+g", Command: "x.ctrlG", When: "!groog.context.bMode"},
+				{Key: "ctrl+g", Command: "x.other", When: "groog.context.bMode"},
+				{Key: "ctrl+d", Command: "x.other", When: "groog.context.dMode && !groog.context.aMode"},
+				{Key: "ctrl+e", Command: "x.other", When: "!groog.context.dMode && groog.context.eMode"},
+				{Key: "ctrl+e", Command: "-x.other", When: "groog.context.dMode"},
+			},
+			wantStates: []string{
+				"(none)", "a", "b", "a + b", "c", "a + c", "b + c", "a + b + c",
+				"e", "a + e", "b + e", "a + b + e", "c + e", "a + c + e", "b + c + e", "a + b + c + e",
+			},
+			wantDiagnostics: []string{
+				`command "x.startA" declares unknown groog mode "z"`,
+				`groog mode "a" can never be exited`,
+				`groog mode "b" can't be exited with ctrl+g when the active modes are b`,
+				`groog mode "c" can't be exited with ctrl+g when the active modes are b + c`,
+				`groog mode "d" can never be entered`,
+				`binding for ctrl+d (x.other when "groog.context.dMode && !groog.context.aMode") requires a combination of groog modes that never occurs`,
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			p := &Package{
+				Contributes: &Contribution{
+					Commands:    test.commands,
+					Keybindings: test.kbs,
+				},
+			}
+			ds := &Diagnostics{}
+			mm := newModeMachine(ds, test.modes, nil, p)
+			mm.check(ds)
+			var gotDiagnostics []string
+			for _, d := range ds.All() {
+				gotDiagnostics = append(gotDiagnostics, d.Message)
+			}
+			if diff := cmp.Diff(test.wantDiagnostics, gotDiagnostics); diff != "" {
+				t.Errorf("modeMachine.check() recorded incorrect diagnostics (-want, +got):\n%s", diff)
+			}
+
+			var gotStates []string
+			for _, s := range mm.states {
+				gotStates = append(gotStates, mm.stateName(s))
+			}
+			if diff := cmp.Diff(test.wantStates, gotStates); diff != "" {
+				t.Errorf("newModeMachine() produced incorrect states (-want, +got):\n%s", diff)
+			}
+
+			if test.wantTransitions == nil {
+				return
+			}
+			gotTransitions := map[string][]string{}
+			for tr, labels := range mm.transitions {
+				gotTransitions[mm.stateName(tr.From)+" -> "+mm.stateName(tr.To)] = sortedKeys(labels)
+			}
+			if diff := cmp.Diff(test.wantTransitions, gotTransitions); diff != "" {
+				t.Errorf("newModeMachine() produced incorrect transitions (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestModeMachineExcludedContexts(t *testing.T) {
+	// ctrl+g only runs x.other while the terminal is focused, but that can't
+	// happen at the same time as editor focus.
+	contexts := []*ContextKey{
+		{Key: "editorTextFocus", Type: contextBool, Excludes: []string{"terminalFocus"}},
+		{Key: "terminalFocus", Type: contextBool},
+	}
+	p := &Package{
+		Contributes: &Contribution{
+			Commands: []*Command{
+				enters(cc("x.startA", "Start A"), "a"),
+				exits(cc("x.ctrlG", "Ctrl-G"), "a"),
+			},
+			Keybindings: []*Keybinding{
+				{Key: "ctrl+g", Command: "x.ctrlG", When: "editorTextFocus && groog.context.aMode"},
+				{Key: "ctrl+g", Command: "x.other", When: "terminalFocus"},
+			},
+		},
+	}
+	ds := &Diagnostics{}
+	newModeMachine(ds, []*GroogMode{{Name: "a"}}, contexts, p).check(ds)
+	if diff := cmp.Diff("", diagnosticMessages(ds)); diff != "" {
+		t.Errorf("modeMachine.check() recorded incorrect diagnostics (-want, +got):\n%s", diff)
+	}
+}
+
+func TestModeMachineDot(t *testing.T) {
+	p := &Package{
+		Contributes: &Contribution{
+			Commands: []*Command{
+				enters(cc("x.startA", "Start A"), "a"),
+				exits(cc("x.ctrlG", "Ctrl-G"), "a"),
+			},
+			Keybindings: []*Keybinding{
+				{Key: "ctrl+g", Command: "x.ctrlG"},
+			},
+		},
+	}
+	mm := newModeMachine(&Diagnostics{}, []*GroogMode{{Name: "a"}, {Name: "q", Setting: true}}, nil, p)
+	want := strings.Join([]string{
+		`digraph modes {`,
+		`  rankdir=LR;`,
+		`  "state:(none)" [label="(none)", shape=doublecircle];`,
+		`  "state:a" [label="a", shape=ellipse];`,
+		`  "state:q" [label="q", shape=doublecircle];`,
+		`  "state:a + q" [label="a + q", shape=ellipse];`,
+		`  "state:(none)" -> "state:a" [label="x.startA"];`,
+		`  "state:a" -> "state:(none)" [label="ctrl+g: x.ctrlG\nx.ctrlG"];`,
+		`  "state:q" -> "state:a + q" [label="x.startA"];`,
+		`  "state:a + q" -> "state:q" [label="ctrl+g: x.ctrlG\nx.ctrlG"];`,
+		`}`,
+		``,
+	}, "\n")
+	if diff := cmp.Diff(want, mm.dot()); diff != "" {
+		t.Errorf("modeMachine.dot() returned incorrect value (-want, +got):\n%s", diff)
+	}
+}
+
+func TestGroogModeDeclarations(t *testing.T) {
+	// Every mode must be declared as entered by some command.
+	entered := map[string]bool{}
+	for _, c := range groogCommands() {
+		for _, name := range append(append([]string{}, c.Enters...), c.Toggles...) {
+			entered[name] = true
+		}
+	}
+	for _, m := range groogModes() {
+		if !entered[m.Name] {
+			t.Errorf("no command enters groog mode %q", m.Name)
+		}
+	}
+}
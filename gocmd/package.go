@@ -1,9 +1,109 @@
 package main
 
-import "golang.org/x/exp/slices"
+import (
+	"fmt"
 
+	"golang.org/x/exp/slices"
+)
+
+// Definitions is the full set of inputs from which the package is generated.
+type Definitions struct {
+	// Base is the package metadata. Its Scripts, ExtensionDependencies, and
+	// Contributes fields are ignored and generated from the rest of the
+	// definitions.
+	Base          *Package
+	Scripts       map[string]Script
+	Commands      []*Command
+	Keybindings   map[Key]map[string]*KB
+	Removals      map[Key][]*Removal
+	Configuration *Configuration
+	Snippets      []*Snippet
+	// Extensions determines the extensionDependencies of the package.
+	Extensions *ExtensionRegistry
+	// Contexts are the context keys that can be used in when clauses.
+	Contexts []*ContextKey
+	// Modes are the groog modes that commands enter and exit.
+	Modes []*GroogMode
+	// Media are the files the extension loads at runtime. They aren't part of
+	// package.json, but they must be included in the VSIX.
+	Media []string
+}
+
+// groogDefinitions returns a new set of definitions for the groog extension.
+func groogDefinitions() *Definitions {
+	return &Definitions{
+		Base:          groogBase(),
+		Scripts:       groogScripts(),
+		Commands:      groogCommands(),
+		Keybindings:   groogKeybindings(),
+		Removals:      groogRemovals(),
+		Configuration: groogConfiguration(),
+		Snippets:      groogSnippets(),
+		Extensions:    groogExtensionRegistry(),
+		Contexts:      groogContextKeys(),
+		Modes:         groogModes(),
+		Media:         groogMedia(),
+	}
+}
+
+// groogPackage builds the groog package. It panics if any errors are recorded
+// (use generateGroogPackage to report them instead).
 func groogPackage(versionOverride string) *Package {
-	p := &Package{
+	p, ds := generateGroogPackage(versionOverride)
+	if ds.HasErrors() {
+		panic(fmt.Sprintf("failed to generate the groog package:\n%s", ds))
+	}
+	return p
+}
+
+// generateGroogPackage builds the groog package and returns it along with all
+// of the diagnostics recorded while doing so.
+func generateGroogPackage(versionOverride string) (*Package, *Diagnostics) {
+	ds := &Diagnostics{}
+	return buildPackage(ds, groogDefinitions(), versionOverride), ds
+}
+
+// buildPackage generates the package from the provided definitions and
+// records any problems with them in ds. The definitions are not modified, so
+// this can be run multiple times (and for multiple sets of definitions) in the
+// same process.
+func buildPackage(ds *Diagnostics, defs *Definitions, versionOverride string) *Package {
+	base := *defs.Base
+	p := &base
+
+	if versionOverride != "" {
+		p.Version = versionOverride
+	}
+
+	p.Scripts = renderScripts(defs.Scripts)
+	p.Contributes = &Contribution{
+		Commands:      slices.Clone(defs.Commands),
+		Keybindings:   kbDefsToBindings(ds, defs.Keybindings, defs.Removals),
+		Configuration: defs.Configuration,
+		Snipppets:     slices.Clone(defs.Snippets),
+	}
+	sortFunc(p.Contributes.Commands, func(a, b *Command) bool {
+		return a.Command < b.Command
+	})
+	if defs.Contexts != nil {
+		// Checked before simplification so negated compound clauses are
+		// reported.
+		checkWhenClauses(ds, defs.Contexts, p, p.Contributes.Keybindings)
+		checkBindingOrder(ds, defs.Contexts, defs.Keybindings)
+	}
+	simplifyWhenClauses(ds, p.Contributes.Keybindings)
+	if defs.Modes != nil {
+		checkModes(ds, defs.Modes, defs.Contexts, p)
+	}
+	if defs.Extensions != nil {
+		checkCommands(ds, defs.Extensions, p, p.Contributes.Keybindings)
+		p.ExtensionDependencies = extensionDependencies(defs.Extensions, p.Name, p.Contributes.Keybindings)
+	}
+	return p
+}
+
+func groogBase() *Package {
+	return &Package{
 		Name:        "groog",
 		DisplayName: "groog",
 		Description: "",
@@ -20,22 +120,6 @@ func groogPackage(versionOverride string) *Package {
 		Categories: []string{
 			"Other",
 		},
-		Scripts: map[string]string{
-
-			"vscode:prepublish": "npm run esbuild-base -- --minify",
-			"esbuild-base":      "esbuild ./src/extension.ts --bundle --outfile=dist/extension.js --external:vscode --format=cjs --platform=node",
-			"esbuild":           "npm run esbuild-base -- --sourcemap",
-			"esbuild-watch":     "npm run esbuild-base -- --sourcemap --watch",
-			"test-compile":      "tsc -p ./",
-
-			"compile":  "tsc -p ./",
-			"watch":    "tsc -watch -p ./",
-			"pretest":  "npm run compile",
-			"lint":     "eslint src --fix --ext ts",
-			"test":     "vscode-test --coverage --coverageReporter lcov --coverageReporter html",
-			"posttest": "echo 'Open the following file for html coverage report:\nfile:///C:/Users/gleep/Desktop/Coding/vs-code/groog/coverage/Desktop/Coding/vs-code/groog/src/index.html'",
-			"coverage": "c8 --reporter lcov --check-coverage npm run test",
-		},
 		Dependencies: map[string]string{
 			"await-lock":             "^2.2.2",
 			"escape-string-regexp":   "^5.0.0",
@@ -60,21 +144,6 @@ func groogPackage(versionOverride string) *Package {
 		// actually need to populate this at all, but it needs to be present.
 		ActivationEvents: []string{},
 	}
-
-	if versionOverride != "" {
-		p.Version = versionOverride
-	}
-
-	p.Contributes = &Contribution{
-		Commands:      CustomCommands,
-		Keybindings:   kbDefsToBindings(),
-		Configuration: groogConfiguration(),
-		Snipppets:     Snippets,
-	}
-	sortFunc(p.Contributes.Commands, func(a, b *Command) bool {
-		return a.Command < b.Command
-	})
-	return p
 }
 
 func sortFunc[T any](ts []T, f func(a, b T) bool) {
@@ -100,26 +169,20 @@ type Package struct {
 	Dependencies     map[string]string `json:"dependencies"`
 	DevDependencies  map[string]string `json:"devDependencies"`
 	ActivationEvents []string          `json:"activationEvents"`
-	Contributes      *Contribution     `json:"contributes"`
+	// ExtensionDependencies is generated from the commands run by the
+	// keybindings (see extensions.go).
+	ExtensionDependencies []string `json:"extensionDependencies,omitempty"`
+	// ExtensionPack is the extensions that are installed along with this one.
+	ExtensionPack []string      `json:"extensionPack,omitempty"`
+	Contributes   *Contribution `json:"contributes"`
 }
 
+// sort sorts the commands. The keybindings aren't sorted since their order
+// determines which binding runs (see binding_order.go).
 func (p *Package) sort() {
 	sortFunc(p.Contributes.Commands, func(a, b *Command) bool {
 		return a.Title < b.Title
 	})
-
-	sortFunc(p.Contributes.Keybindings, func(a, b *Keybinding) bool {
-		if a.Key != b.Key {
-			return a.Key < b.Key
-		}
-		if a.When != b.When {
-			return a.When < b.When
-		}
-		if a.Command != b.Command {
-			return a.Command < b.Command
-		}
-		return len(a.Args) < len(b.Args)
-	})
 }
 
 type Repository struct {
@@ -139,4 +202,7 @@ type Keybinding struct {
 	Command string                 `json:"command,omitempty"`
 	When    string                 `json:"when,omitempty"`
 	Args    map[string]interface{} `json:"args,omitempty"`
+	// Location is where the binding (or removal) is defined. Problems with
+	// the binding are reported there.
+	Location Location `json:"-"`
 }
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/exp/slices"
+)
+
+var (
+	update = flag.Bool("update", false, "Update package.json instead of comparing against it")
+
+	packageFile = filepath.Join("..", "package.json")
+)
+
+func TestPackageJSON(t *testing.T) {
+	p, ds := generateGroogPackage("")
+	if len(ds.All()) != 0 {
+		t.Errorf("generateGroogPackage() recorded diagnostics:\n%s", ds)
+	}
+
+	got, err := marshalJson(p)
+	if err != nil {
+		t.Fatalf("marshalJson(groogPackage) returned error: %v", err)
+	}
+
+	if *update {
+		if err := os.WriteFile(packageFile, got, 0644); err != nil {
+			t.Fatalf("failed to update %s: %v", packageFile, err)
+		}
+	}
+
+	want, err := os.ReadFile(packageFile)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", packageFile, err)
+	}
+
+	if diff := cmp.Diff(string(want), string(got)); diff != "" {
+		t.Errorf("groogPackage() produced diff from %s (-want, +got) (run `go test -update` if this is expected):\n%s", packageFile, diff)
+	}
+}
+
+func TestBuildPackageIsRepeatable(t *testing.T) {
+	defs := groogDefinitions()
+	first := buildPackage(&Diagnostics{}, defs, "")
+	second := buildPackage(&Diagnostics{}, defs, "1.2.3")
+
+	if diff := cmp.Diff(groogDefinitions(), defs); diff != "" {
+		t.Errorf("buildPackage() modified the definitions (-want, +got):\n%s", diff)
+	}
+
+	if second.Version != "1.2.3" {
+		t.Errorf("buildPackage(&Diagnostics{}, defs, %q) set version to %q", "1.2.3", second.Version)
+	}
+	if first.Version == second.Version {
+		t.Errorf("buildPackage() version override modified the base package")
+	}
+
+	if diff := cmp.Diff(first.Contributes, second.Contributes); diff != "" {
+		t.Errorf("buildPackage() produced different contributions (-first, +second):\n%s", diff)
+	}
+}
+
+func TestBuildPackageDiagnosticLocations(t *testing.T) {
+	_, _, line, _ := runtime.Caller(0)
+	defs := &Definitions{
+		Base: &Package{Name: "test", Engines: map[string]string{"vscode": "^1.81.0"}},
+		Commands: []*Command{
+			enters(cc("test.enterA", "Enter A"), "a", "z"),
+		},
+		Keybindings: map[Key]map[string]*KB{
+			ctrl("a"): {
+				wc("unknownKey").value:  kb("test.enterA"),
+				wc("editorFocus").value: kb("test.other"),
+			},
+			ctrl("b"): onlyWhen("test.other", editorFocus.and(editorFocus.not())),
+		},
+		Contexts: []*ContextKey{
+			{Key: "editorFocus", Type: contextBool},
+			{Key: groogContext("a"), Type: contextBool},
+		},
+		Modes: []*GroogMode{
+			groogMode(GroogMode{Name: "a"}),
+		},
+	}
+
+	ds := &Diagnostics{}
+	buildPackage(ds, defs, "")
+	var got []string
+	for _, d := range ds.All() {
+		// Ignore the generated character bindings.
+		if d.File == "package_test.go" {
+			got = append(got, d.String())
+		}
+	}
+	want := []string{
+		fmt.Sprintf(`package_test.go:%d: unknown context key "unknownKey" in when clause "unknownKey"`, line+8),
+		fmt.Sprintf(`package_test.go:%d: bindings for ctrl+a (test.other when "editorFocus" and test.enterA when "unknownKey") can both match, but have the same priority`, line+8),
+		fmt.Sprintf(`package_test.go:%d: when clause "editorFocus && !editorFocus" can never be true (bound to ctrl+b)`, line+11),
+		fmt.Sprintf(`package_test.go:%d: command "test.enterA" declares unknown groog mode "z"`, line+4),
+		fmt.Sprintf(`package_test.go:%d: groog mode "a" can never be exited`, line+18),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("buildPackage() recorded incorrect diagnostics (-want, +got):\n%s", diff)
+	}
+}
+
+func TestPackageInvariants(t *testing.T) {
+	p := groogPackage("")
+
+	t.Run("unique key and when pairs", func(t *testing.T) {
+		type keyWhen struct {
+			key, when string
+		}
+		seen := map[keyWhen]bool{}
+		for _, kb := range p.Contributes.Keybindings {
+			// Removals can share a key and when with a new binding
+			if kb.Command[0] == '-' {
+				continue
+			}
+			kw := keyWhen{kb.Key, kb.When}
+			if seen[kw] {
+				t.Errorf("multiple keybindings for key %q and when %q", kb.Key, kb.When)
+			}
+			seen[kw] = true
+		}
+	})
+
+	t.Run("commands are sorted", func(t *testing.T) {
+		if !slices.IsSortedFunc(p.Contributes.Commands, func(a, b *Command) int {
+			if a.Command < b.Command {
+				return -1
+			}
+			if a.Command > b.Command {
+				return 1
+			}
+			return 0
+		}) {
+			t.Errorf("package commands are not sorted")
+		}
+	})
+
+	t.Run("unique commands", func(t *testing.T) {
+		seen := map[string]bool{}
+		for _, c := range p.Contributes.Commands {
+			if seen[c.Command] {
+				t.Errorf("command %q is defined multiple times", c.Command)
+			}
+			seen[c.Command] = true
+		}
+	})
+
+	t.Run("keybindings have commands", func(t *testing.T) {
+		for _, kb := range p.Contributes.Keybindings {
+			if kb.Key == "" || kb.Command == "" {
+				t.Errorf("keybinding has empty key or command: %+v", kb)
+			}
+		}
+	})
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+)
+
+// See https://semver.org for the version format. Versions may have pre-release
+// identifiers and build metadata (e.g. `2.8.0-beta.1+abc`), but the VS Code
+// marketplace doesn't use them to pick a channel, so marketplace pre-release
+// builds instead use odd minor versions (and regular releases use even minor
+// versions):
+// https://code.visualstudio.com/api/working-with-extensions/publishing-extension#prerelease-extensions
+
+var (
+	semverRegex = regexp.MustCompile(`^(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)(?:-([0-9A-Za-z\-]+(?:\.[0-9A-Za-z\-]+)*))?(?:\+([0-9A-Za-z\-]+(?:\.[0-9A-Za-z\-]+)*))?$`)
+
+	// Regexes for the extension's version in package-lock.json
+	lockVersionRegex        = regexp.MustCompile(`(?m)^(  "version": ")([^"]*)(",?)$`)
+	lockPackageVersionRegex = regexp.MustCompile(`(?m)^(      "version": ")([^"]*)(",?)$`)
+)
+
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+	// PreRelease is the list of dot-separated pre-release identifiers.
+	PreRelease []string
+	// Build is the build metadata (which is ignored when comparing versions).
+	Build string
+}
+
+func parseVersion(s string) (*Version, error) {
+	m := semverRegex.FindStringSubmatch(s)
+	if len(m) == 0 {
+		return nil, fmt.Errorf("invalid semantic version %q", s)
+	}
+
+	v := &Version{Build: m[5]}
+	for i, p := range []*int{&v.Major, &v.Minor, &v.Patch} {
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid semantic version %q: %v", s, err)
+		}
+		*p = n
+	}
+
+	if m[4] != "" {
+		v.PreRelease = strings.Split(m[4], ".")
+		for _, id := range v.PreRelease {
+			if len(id) > 1 && id[0] == '0' && isNumeric(id) {
+				return nil, fmt.Errorf("invalid semantic version %q: numeric pre-release identifiers must not have leading zeros", s)
+			}
+		}
+	}
+	return v, nil
+}
+
+func (v *Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.PreRelease) > 0 {
+		s += "-" + strings.Join(v.PreRelease, ".")
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// isPreReleaseChannel returns whether the version is published to the
+// marketplace's pre-release channel (i.e. has an odd minor version).
+func (v *Version) isPreReleaseChannel() bool {
+	return v.Minor%2 == 1
+}
+
+// Compare returns -1, 0, or 1 if v has lower, equal, or higher precedence
+// than that, respectively.
+func (v *Version) Compare(that *Version) int {
+	for _, p := range [][2]int{
+		{v.Major, that.Major},
+		{v.Minor, that.Minor},
+		{v.Patch, that.Patch},
+	} {
+		if c := compareInts(p[0], p[1]); c != 0 {
+			return c
+		}
+	}
+
+	// A version without pre-release identifiers has higher precedence.
+	if len(v.PreRelease) == 0 || len(that.PreRelease) == 0 {
+		return -compareInts(len(v.PreRelease), len(that.PreRelease))
+	}
+
+	for i := 0; i < len(v.PreRelease) && i < len(that.PreRelease); i++ {
+		if c := comparePreReleaseIdentifiers(v.PreRelease[i], that.PreRelease[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(v.PreRelease), len(that.PreRelease))
+}
+
+func comparePreReleaseIdentifiers(a, b string) int {
+	aNum, bNum := isNumeric(a), isNumeric(b)
+	switch {
+	case aNum && bNum:
+		an, _ := strconv.Atoi(a)
+		bn, _ := strconv.Atoi(b)
+		return compareInts(an, bn)
+	// Numeric identifiers have lower precedence than alphanumeric ones.
+	case aNum:
+		return -1
+	case bNum:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func isNumeric(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func compareInts(a, b int) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+type VersionPart int
+
+const (
+	patchPart VersionPart = iota
+	minorPart
+	majorPart
+)
+
+func (vp VersionPart) String() string {
+	switch vp {
+	case patchPart:
+		return "patch"
+	case minorPart:
+		return "minor"
+	case majorPart:
+		return "major"
+	}
+	return fmt.Sprintf("VersionPart(%d)", int(vp))
+}
+
+// releasedPart returns the most significant part that changed from cur to
+// next.
+func releasedPart(cur, next *Version) VersionPart {
+	switch {
+	case next.Major != cur.Major:
+		return majorPart
+	case next.Minor != cur.Minor:
+		return minorPart
+	}
+	return patchPart
+}
+
+// requiredBump returns the smallest version part that should be incremented
+// for the provided changes, along with the reasons for it. Removing things
+// users rely on (commands, settings, and keys) or changing what a key does is
+// a breaking change, adding new things is a feature, and everything else
+// (e.g. when clause or title tweaks) is a patch.
+func requiredBump(md *ManifestDiff) (VersionPart, []string) {
+	part := patchPart
+	var reasons []string
+	check := func(vp VersionPart, n int, what string) {
+		if n == 0 {
+			return
+		}
+		reasons = append(reasons, fmt.Sprintf("%s: %d %s", vp, n, what))
+		if vp > part {
+			part = vp
+		}
+	}
+
+	check(majorPart, len(md.RemovedCommands), "removed command(s)")
+	check(majorPart, len(md.RemovedProperties), "removed configuration property(ies)")
+	check(majorPart, len(md.RemovedBindings), "removed keybinding(s)")
+	check(majorPart, len(md.ReboundBindings), "rebound key(s)")
+	check(minorPart, len(md.AddedCommands), "new command(s)")
+	check(minorPart, len(md.AddedProperties), "new configuration property(ies)")
+	check(minorPart, len(md.AddedBindings), "new keybinding(s)")
+	return part, reasons
+}
+
+// nextVersion returns the version after cur when incrementing the provided
+// part. The minor version is chosen so that the version's parity matches the
+// release channel (odd for pre-release and even otherwise).
+func nextVersion(cur *Version, part VersionPart, preRelease bool) (*Version, error) {
+	parity := 0
+	if preRelease {
+		parity = 1
+	}
+
+	switch part {
+	case majorPart:
+		return &Version{Major: cur.Major + 1, Minor: parity}, nil
+	case minorPart:
+		minor := cur.Minor + 1
+		if minor%2 != parity {
+			minor++
+		}
+		return &Version{Major: cur.Major, Minor: minor}, nil
+	case patchPart:
+		if cur.isPreReleaseChannel() != preRelease {
+			return nil, fmt.Errorf("can't bump the patch version of %s for the %s channel (bump the minor or major version instead)", cur, channelName(preRelease))
+		}
+		// Patching a pre-release version just drops the pre-release identifiers
+		if len(cur.PreRelease) > 0 {
+			return &Version{Major: cur.Major, Minor: cur.Minor, Patch: cur.Patch}, nil
+		}
+		return &Version{Major: cur.Major, Minor: cur.Minor, Patch: cur.Patch + 1}, nil
+	}
+	return nil, fmt.Errorf("unknown version part %d", part)
+}
+
+func channelName(preRelease bool) string {
+	if preRelease {
+		return "pre-release"
+	}
+	return "release"
+}
+
+// validateRelease checks that moving from cur to next is a valid release.
+func validateRelease(cur, next *Version, preRelease bool) error {
+	if next.Compare(cur) <= 0 {
+		return fmt.Errorf("new version %s must be greater than the current version %s", next, cur)
+	}
+	if next.isPreReleaseChannel() != preRelease {
+		parity := "even"
+		if preRelease {
+			parity = "odd"
+		}
+		return fmt.Errorf("%s versions must have an %s minor version (got %s)", channelName(preRelease), parity, next)
+	}
+	return nil
+}
+
+// currentVersion returns the version set in the provided package.go contents.
+func currentVersion(packageGo string) (*Version, error) {
+	for _, line := range strings.Split(packageGo, "\n") {
+		if m := versionRegex.FindStringSubmatch(line); len(m) > 0 {
+			return parseVersion(m[2])
+		}
+	}
+	return nil, fmt.Errorf("no version found in package.go")
+}
+
+// setPackageGoVersion replaces the version in the package.go contents.
+func setPackageGoVersion(packageGo string, v *Version) (string, error) {
+	var replaced int
+	lines := strings.Split(packageGo, "\n")
+	for i, line := range lines {
+		if m := versionRegex.FindStringSubmatch(line); len(m) > 0 {
+			replaced++
+			lines[i] = fmt.Sprintf("%s%s%s", m[1], v, m[3])
+		}
+	}
+	if replaced == 0 {
+		return "", fmt.Errorf("made no replacements")
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// setLockVersion replaces the extension's version in the package-lock.json
+// contents (both the top-level version and the root package's version).
+func setLockVersion(lock string, v *Version) (string, error) {
+	loc := lockVersionRegex.FindStringSubmatchIndex(lock)
+	if loc == nil {
+		return "", fmt.Errorf("no top-level version found in package-lock.json")
+	}
+	lock = lock[:loc[4]] + v.String() + lock[loc[5]:]
+
+	rootPackage := strings.Index(lock, "\n    \"\": {\n")
+	if rootPackage < 0 {
+		// Lock files before version 2 don't have a packages section.
+		return lock, nil
+	}
+	loc = lockPackageVersionRegex.FindStringSubmatchIndex(lock[rootPackage:])
+	if loc == nil {
+		return "", fmt.Errorf("no root package version found in package-lock.json")
+	}
+	return lock[:rootPackage+loc[4]] + v.String() + lock[rootPackage+loc[5]:], nil
+}
+
+type releaseOptions struct {
+	set        string
+	part       VersionPart
+	preRelease bool
+	dryRun     bool
+	// allowSmallerBump allows releasing with a smaller version bump than the
+	// one recommended by requiredBump.
+	allowSmallerBump bool
+}
+
+// release updates the version in package.go, package.json, and
+// package-lock.json and adds the new version's section to CHANGELOG.md.
+func (c *cli) release(o command.Output, d *command.Data, opts *releaseOptions) error {
+	gocmdDir := filepath.Dir(runtimeNode.Get(d))
+	packageGoFile := filepath.Join(gocmdDir, "package.go")
+	lockFile := filepath.Join(filepath.Dir(gocmdDir), "package-lock.json")
+
+	packageGo, err := os.ReadFile(packageGoFile)
+	if err != nil {
+		return o.Annotatef(err, "failed to read package.go")
+	}
+	lock, err := os.ReadFile(lockFile)
+	if err != nil {
+		return o.Annotatef(err, "failed to read package-lock.json")
+	}
+
+	cur, err := currentVersion(string(packageGo))
+	if err != nil {
+		return o.Err(err)
+	}
+
+	var next *Version
+	if opts.set != "" {
+		if next, err = parseVersion(opts.set); err != nil {
+			return o.Err(err)
+		}
+	} else if next, err = nextVersion(cur, opts.part, opts.preRelease); err != nil {
+		return o.Err(err)
+	}
+
+	if err := validateRelease(cur, next, opts.preRelease); err != nil {
+		return o.Err(err)
+	}
+
+	if err := c.checkBump(o, d, cur, next, opts); err != nil {
+		return err
+	}
+
+	if _, _, err := untaggedVersion(localGit(filepath.Dir(gocmdDir)), next.String()); err != nil {
+		return o.Err(err)
+	}
+
+	if opts.dryRun {
+		o.Stdoutf("Would release %s version: %s -> %s\n", channelName(opts.preRelease), cur, next)
+		return c.updateChangelog(o, d, next.String(), true)
+	}
+
+	newPackageGo, err := setPackageGoVersion(string(packageGo), next)
+	if err != nil {
+		return o.Err(err)
+	}
+	newLock, err := setLockVersion(string(lock), next)
+	if err != nil {
+		return o.Err(err)
+	}
+
+	// package.go is the source of truth (package.json is generated from it),
+	// so it's written first. If a later step fails, rerunning `vs-package`
+	// brings package.json back in sync.
+	if err := os.WriteFile(packageGoFile, []byte(newPackageGo), 0644); err != nil {
+		return o.Annotatef(err, "failed to write new contents to package.go")
+	}
+	if err := os.WriteFile(lockFile, []byte(newLock), 0644); err != nil {
+		return o.Annotatef(err, "failed to write new contents to package-lock.json")
+	}
+	if err := c.regeneratePackageJson(o, d, next.String()); err != nil {
+		return err
+	}
+
+	o.Stdoutf("Successfully released %s version: %s -> %s\n", channelName(opts.preRelease), cur, next)
+	return c.updateChangelog(o, d, next.String(), false)
+}
+
+// checkBump verifies that the release's version bump is at least as large as
+// the one required by the manifest changes since the last version tag.
+func (c *cli) checkBump(o command.Output, d *command.Data, cur, next *Version, opts *releaseOptions) error {
+	git := localGit(filepath.Dir(filepath.Dir(runtimeNode.Get(d))))
+	tag := lastVersionTag(git)
+	if tag == "" {
+		o.Stderrln("No version tag found, so skipping the version bump check")
+		return nil
+	}
+
+	a, err := manifestAtRevision(o, git, tag)
+	if err != nil {
+		return o.Annotatef(err, "failed to build package at %s", tag)
+	}
+	b, err := manifestAtRevision(o, git, workingTreeRevision)
+	if err != nil {
+		return o.Annotatef(err, "failed to build package for the working tree")
+	}
+
+	recommended, reasons := requiredBump(diffManifests(a, b))
+	o.Stdoutf("Recommended version bump since %s: %s\n", tag, recommended)
+	for _, r := range reasons {
+		o.Stdoutf("  %s\n", r)
+	}
+
+	if released := releasedPart(cur, next); released < recommended {
+		if !opts.allowSmallerBump {
+			return o.Stderrf("release %s -> %s is a %s bump, but the changes since %s require a %s bump (run `vs-package diff %s` for details, or provide --allow-smaller-bump to release anyway)\n", cur, next, released, tag, recommended, tag)
+		}
+		o.Stderrf("Releasing a %s bump even though a %s bump is recommended\n", released, recommended)
+	}
+	return nil
+}
@@ -0,0 +1,504 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseVersion(t *testing.T) {
+	for _, test := range []struct {
+		s       string
+		want    *Version
+		wantErr string
+	}{
+		{
+			s:    "2.6.3",
+			want: &Version{Major: 2, Minor: 6, Patch: 3},
+		},
+		{
+			s:    "0.0.0",
+			want: &Version{},
+		},
+		{
+			s:    "1.3.0-beta.1",
+			want: &Version{Major: 1, Minor: 3, PreRelease: []string{"beta", "1"}},
+		},
+		{
+			s:    "1.3.0+build.5",
+			want: &Version{Major: 1, Minor: 3, Build: "build.5"},
+		},
+		{
+			s:    "1.3.0-rc.1+abc-def",
+			want: &Version{Major: 1, Minor: 3, PreRelease: []string{"rc", "1"}, Build: "abc-def"},
+		},
+		{
+			s:       "1.3",
+			wantErr: `invalid semantic version "1.3"`,
+		},
+		{
+			s:       "v1.3.0",
+			wantErr: `invalid semantic version "v1.3.0"`,
+		},
+		{
+			s:       "01.3.0",
+			wantErr: `invalid semantic version "01.3.0"`,
+		},
+		{
+			s:       "1.3.0-beta..1",
+			wantErr: `invalid semantic version "1.3.0-beta..1"`,
+		},
+		{
+			s:       "1.3.0-01",
+			wantErr: `invalid semantic version "1.3.0-01": numeric pre-release identifiers must not have leading zeros`,
+		},
+	} {
+		t.Run(test.s, func(t *testing.T) {
+			got, err := parseVersion(test.s)
+			var gotErr string
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr); diff != "" {
+				t.Errorf("parseVersion(%q) returned incorrect error (-want, +got):\n%s", test.s, diff)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("parseVersion(%q) returned incorrect value (-want, +got):\n%s", test.s, diff)
+			}
+			if got != nil && got.String() != test.s {
+				t.Errorf("parseVersion(%q).String() returned %q", test.s, got.String())
+			}
+		})
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	// Ordered by precedence (from https://semver.org/#spec-item-11)
+	ordered := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1",
+		"1.2.0",
+		"1.10.0",
+		"2.0.0",
+	}
+	for i, a := range ordered {
+		for j, b := range ordered {
+			want := compareInts(i, j)
+			av, err := parseVersion(a)
+			if err != nil {
+				t.Fatalf("parseVersion(%q) returned error: %v", a, err)
+			}
+			bv, err := parseVersion(b)
+			if err != nil {
+				t.Fatalf("parseVersion(%q) returned error: %v", b, err)
+			}
+			if got := av.Compare(bv); got != want {
+				t.Errorf("%s.Compare(%s) returned %d; want %d", a, b, got, want)
+			}
+		}
+	}
+
+	// Build metadata is ignored
+	a, b := &Version{Major: 1, Build: "a"}, &Version{Major: 1, Build: "b"}
+	if got := a.Compare(b); got != 0 {
+		t.Errorf("%s.Compare(%s) returned %d; want 0", a, b, got)
+	}
+}
+
+func TestNextVersion(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		cur        string
+		part       VersionPart
+		preRelease bool
+		want       string
+		wantErr    string
+	}{
+		{
+			name: "patch release",
+			cur:  "2.6.3",
+			part: patchPart,
+			want: "2.6.4",
+		},
+		{
+			name: "minor release",
+			cur:  "2.6.3",
+			part: minorPart,
+			want: "2.8.0",
+		},
+		{
+			name: "major release",
+			cur:  "2.6.3",
+			part: majorPart,
+			want: "3.0.0",
+		},
+		{
+			name:       "minor pre-release",
+			cur:        "2.6.3",
+			part:       minorPart,
+			preRelease: true,
+			want:       "2.7.0",
+		},
+		{
+			name:       "major pre-release",
+			cur:        "2.6.3",
+			part:       majorPart,
+			preRelease: true,
+			want:       "3.1.0",
+		},
+		{
+			name:       "patch pre-release",
+			cur:        "2.7.0",
+			part:       patchPart,
+			preRelease: true,
+			want:       "2.7.1",
+		},
+		{
+			name: "minor release from pre-release",
+			cur:  "2.7.4",
+			part: minorPart,
+			want: "2.8.0",
+		},
+		{
+			name: "patch drops pre-release identifiers",
+			cur:  "2.8.0-beta.1",
+			part: patchPart,
+			want: "2.8.0",
+		},
+		{
+			name:       "patch pre-release of release",
+			cur:        "2.6.3",
+			part:       patchPart,
+			preRelease: true,
+			wantErr:    "can't bump the patch version of 2.6.3 for the pre-release channel (bump the minor or major version instead)",
+		},
+		{
+			name:    "patch release of pre-release",
+			cur:     "2.7.3",
+			part:    patchPart,
+			wantErr: "can't bump the patch version of 2.7.3 for the release channel (bump the minor or major version instead)",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cur, err := parseVersion(test.cur)
+			if err != nil {
+				t.Fatalf("parseVersion(%q) returned error: %v", test.cur, err)
+			}
+			got, err := nextVersion(cur, test.part, test.preRelease)
+			var gotErr string
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr); diff != "" {
+				t.Errorf("nextVersion() returned incorrect error (-want, +got):\n%s", diff)
+			}
+			var gotS string
+			if got != nil {
+				gotS = got.String()
+			}
+			if diff := cmp.Diff(test.want, gotS); diff != "" {
+				t.Errorf("nextVersion() returned incorrect value (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestValidateRelease(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		cur        string
+		next       string
+		preRelease bool
+		wantErr    string
+	}{
+		{
+			name: "valid release",
+			cur:  "2.6.3",
+			next: "2.6.4",
+		},
+		{
+			name:       "valid pre-release",
+			cur:        "2.6.3",
+			next:       "2.7.0",
+			preRelease: true,
+		},
+		{
+			name: "release with metadata",
+			cur:  "2.6.3",
+			next: "2.8.0-beta.1+abc",
+		},
+		{
+			name:       "pre-release with identifiers",
+			cur:        "2.6.3",
+			next:       "2.7.0-rc",
+			preRelease: true,
+		},
+		{
+			name:    "same version",
+			cur:     "2.6.3",
+			next:    "2.6.3",
+			wantErr: "new version 2.6.3 must be greater than the current version 2.6.3",
+		},
+		{
+			name:    "backwards",
+			cur:     "2.6.3",
+			next:    "2.6.2",
+			wantErr: "new version 2.6.2 must be greater than the current version 2.6.3",
+		},
+		{
+			name:    "backwards with pre-release",
+			cur:     "2.6.3",
+			next:    "2.6.3-beta",
+			wantErr: "new version 2.6.3-beta must be greater than the current version 2.6.3",
+		},
+		{
+			name:    "release with odd minor",
+			cur:     "2.6.3",
+			next:    "2.7.0",
+			wantErr: "release versions must have an even minor version (got 2.7.0)",
+		},
+		{
+			name:       "pre-release with even minor",
+			cur:        "2.6.3",
+			next:       "2.8.0",
+			preRelease: true,
+			wantErr:    "pre-release versions must have an odd minor version (got 2.8.0)",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cur, err := parseVersion(test.cur)
+			if err != nil {
+				t.Fatalf("parseVersion(%q) returned error: %v", test.cur, err)
+			}
+			next, err := parseVersion(test.next)
+			if err != nil {
+				t.Fatalf("parseVersion(%q) returned error: %v", test.next, err)
+			}
+			var gotErr string
+			if err := validateRelease(cur, next, test.preRelease); err != nil {
+				gotErr = err.Error()
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr); diff != "" {
+				t.Errorf("validateRelease() returned incorrect error (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPackageGoVersion(t *testing.T) {
+	contents := "func p() *Package {\n\treturn &Package{\n\t\tVersion:     \"2.6.3\",\n\t}\n}\n"
+
+	cur, err := currentVersion(contents)
+	if err != nil {
+		t.Fatalf("currentVersion() returned error: %v", err)
+	}
+	if diff := cmp.Diff(&Version{Major: 2, Minor: 6, Patch: 3}, cur); diff != "" {
+		t.Errorf("currentVersion() returned incorrect value (-want, +got):\n%s", diff)
+	}
+
+	got, err := setPackageGoVersion(contents, &Version{Major: 2, Minor: 7, PreRelease: []string{"beta"}})
+	if err != nil {
+		t.Fatalf("setPackageGoVersion() returned error: %v", err)
+	}
+	want := "func p() *Package {\n\treturn &Package{\n\t\tVersion:     \"2.7.0-beta\",\n\t}\n}\n"
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("setPackageGoVersion() returned incorrect value (-want, +got):\n%s", diff)
+	}
+
+	// The new version should be parseable again
+	if v, err := currentVersion(got); err != nil || v.String() != "2.7.0-beta" {
+		t.Errorf("currentVersion(setPackageGoVersion()) returned (%v, %v); want 2.7.0-beta", v, err)
+	}
+
+	if _, err := currentVersion("func p() {}"); err == nil {
+		t.Errorf("currentVersion() with no version returned nil error")
+	}
+	if _, err := setPackageGoVersion("func p() {}", cur); err == nil {
+		t.Errorf("setPackageGoVersion() with no version returned nil error")
+	}
+}
+
+func TestSetLockVersion(t *testing.T) {
+	lock := `{
+  "name": "groog",
+  "version": "2.6.1",
+  "lockfileVersion": 2,
+  "requires": true,
+  "packages": {
+    "": {
+      "name": "groog",
+      "version": "2.6.1",
+      "dependencies": {
+        "await-lock": "^2.2.2"
+      }
+    },
+    "node_modules/await-lock": {
+      "version": "2.2.2"
+    }
+  },
+  "dependencies": {
+    "await-lock": {
+      "version": "2.2.2"
+    }
+  }
+}
+`
+	want := `{
+  "name": "groog",
+  "version": "2.6.4",
+  "lockfileVersion": 2,
+  "requires": true,
+  "packages": {
+    "": {
+      "name": "groog",
+      "version": "2.6.4",
+      "dependencies": {
+        "await-lock": "^2.2.2"
+      }
+    },
+    "node_modules/await-lock": {
+      "version": "2.2.2"
+    }
+  },
+  "dependencies": {
+    "await-lock": {
+      "version": "2.2.2"
+    }
+  }
+}
+`
+	got, err := setLockVersion(lock, &Version{Major: 2, Minor: 6, Patch: 4})
+	if err != nil {
+		t.Fatalf("setLockVersion() returned error: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("setLockVersion() returned incorrect value (-want, +got):\n%s", diff)
+	}
+
+	if _, err := setLockVersion("{}", &Version{}); err == nil {
+		t.Errorf("setLockVersion() with no version returned nil error")
+	}
+}
+
+func TestReleasedPart(t *testing.T) {
+	for _, test := range []struct {
+		cur  string
+		next string
+		want VersionPart
+	}{
+		{cur: "2.6.3", next: "2.6.4", want: patchPart},
+		{cur: "2.6.3-beta", next: "2.6.3", want: patchPart},
+		{cur: "2.6.3", next: "2.7.0", want: minorPart},
+		{cur: "2.6.3", next: "2.8.0", want: minorPart},
+		{cur: "2.6.3", next: "3.0.0", want: majorPart},
+	} {
+		t.Run(fmt.Sprintf("%s -> %s", test.cur, test.next), func(t *testing.T) {
+			cur, err := parseVersion(test.cur)
+			if err != nil {
+				t.Fatalf("parseVersion(%q) returned error: %v", test.cur, err)
+			}
+			next, err := parseVersion(test.next)
+			if err != nil {
+				t.Fatalf("parseVersion(%q) returned error: %v", test.next, err)
+			}
+			if diff := cmp.Diff(test.want, releasedPart(cur, next)); diff != "" {
+				t.Errorf("releasedPart() returned incorrect value (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRequiredBump(t *testing.T) {
+	kb := &Keybinding{Key: "ctrl+a", Command: "groog.a"}
+	for _, test := range []struct {
+		name        string
+		md          *ManifestDiff
+		want        VersionPart
+		wantReasons []string
+	}{
+		{
+			name: "no changes",
+			md:   &ManifestDiff{},
+			want: patchPart,
+		},
+		{
+			name: "patch changes",
+			md: &ManifestDiff{
+				RenamedCommands:     []*CommandRename{{"groog.a", "A", "B"}},
+				ChangedProperties:   []string{"groog.p"},
+				WhenChangedBindings: []*BindingChange{{kb, kb}},
+			},
+			want: patchPart,
+		},
+		{
+			name: "new command",
+			md: &ManifestDiff{
+				AddedCommands: []*Command{{Command: "groog.a", Title: "A"}},
+			},
+			want:        minorPart,
+			wantReasons: []string{"minor: 1 new command(s)"},
+		},
+		{
+			name: "new bindings and properties",
+			md: &ManifestDiff{
+				AddedProperties: []string{"groog.p"},
+				AddedBindings:   []*Keybinding{kb, kb},
+			},
+			want: minorPart,
+			wantReasons: []string{
+				"minor: 1 new configuration property(ies)",
+				"minor: 2 new keybinding(s)",
+			},
+		},
+		{
+			name: "removed command",
+			md: &ManifestDiff{
+				RemovedCommands: []*Command{{Command: "groog.a", Title: "A"}},
+				AddedCommands:   []*Command{{Command: "groog.b", Title: "B"}},
+			},
+			want: majorPart,
+			wantReasons: []string{
+				"major: 1 removed command(s)",
+				"minor: 1 new command(s)",
+			},
+		},
+		{
+			name: "removed property",
+			md: &ManifestDiff{
+				RemovedProperties: []string{"groog.p"},
+			},
+			want:        majorPart,
+			wantReasons: []string{"major: 1 removed configuration property(ies)"},
+		},
+		{
+			name: "rebound and removed keys",
+			md: &ManifestDiff{
+				RemovedBindings: []*Keybinding{kb},
+				ReboundBindings: []*BindingChange{{kb, kb}},
+			},
+			want: majorPart,
+			wantReasons: []string{
+				"major: 1 removed keybinding(s)",
+				"major: 1 rebound key(s)",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, gotReasons := requiredBump(test.md)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("requiredBump() returned incorrect part (-want, +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(test.wantReasons, gotReasons); diff != "" {
+				t.Errorf("requiredBump() returned incorrect reasons (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// npm scripts are defined as typed values (rather than shell strings) so the
+// build outputs are known without parsing the commands. Each script is
+// rendered into its command when generating package.json.
+
+const (
+	prepublishScriptName = "vscode:prepublish"
+)
+
+// Script is an npm script.
+type Script interface {
+	// Command returns the shell command that is run for the script.
+	Command() string
+	// Outputs returns the files (and directories, which end in a slash) that
+	// the script writes.
+	Outputs() []*scriptOutput
+}
+
+// scriptOutput is a file (or directory) written by a script.
+type scriptOutput struct {
+	Tool   string
+	Output string
+}
+
+// writes returns whether the output includes the provided file.
+func (so *scriptOutput) writes(file string) bool {
+	if strings.HasSuffix(so.Output, "/") {
+		return strings.HasPrefix(file, so.Output)
+	}
+	return so.Output == file
+}
+
+// Esbuild is an esbuild invocation (https://esbuild.github.io/api/).
+type Esbuild struct {
+	Entry     string
+	Outfile   string
+	Externals []string
+	// Format is the output format (iife, cjs, or esm).
+	Format string
+	// Platform is the target platform (browser, node, or neutral).
+	Platform  string
+	Bundle    bool
+	Minify    bool
+	Sourcemap bool
+	Watch     bool
+}
+
+func (e Esbuild) Command() string {
+	r := []string{"esbuild", e.Entry}
+	if e.Bundle {
+		r = append(r, "--bundle")
+	}
+	r = append(r, fmt.Sprintf("--outfile=%s", e.Outfile))
+	for _, ext := range e.Externals {
+		r = append(r, fmt.Sprintf("--external:%s", ext))
+	}
+	if e.Format != "" {
+		r = append(r, fmt.Sprintf("--format=%s", e.Format))
+	}
+	if e.Platform != "" {
+		r = append(r, fmt.Sprintf("--platform=%s", e.Platform))
+	}
+	if e.Minify {
+		r = append(r, "--minify")
+	}
+	if e.Sourcemap {
+		r = append(r, "--sourcemap")
+	}
+	if e.Watch {
+		r = append(r, "--watch")
+	}
+	return strings.Join(r, " ")
+}
+
+func (e Esbuild) Outputs() []*scriptOutput {
+	r := []*scriptOutput{{"esbuild", cleanPath(e.Outfile)}}
+	if e.Sourcemap {
+		r = append(r, &scriptOutput{"esbuild", cleanPath(e.Outfile) + ".map"})
+	}
+	return r
+}
+
+// Tsc is a TypeScript compiler invocation.
+type Tsc struct {
+	// Project is the directory containing tsconfig.json (or the path to it).
+	Project string
+	// OutDir is the outDir set in the project's tsconfig.json (the doctor
+	// verifies that they match).
+	OutDir string
+	Watch  bool
+}
+
+func (t Tsc) Command() string {
+	r := []string{"tsc"}
+	if t.Watch {
+		r = append(r, "-watch")
+	}
+	if t.Project != "" {
+		r = append(r, "-p", t.Project)
+	}
+	return strings.Join(r, " ")
+}
+
+func (t Tsc) Outputs() []*scriptOutput {
+	if t.OutDir == "" {
+		return nil
+	}
+	return []*scriptOutput{{"tsc", cleanPath(t.OutDir) + "/"}}
+}
+
+// tsconfigPath returns the path of the tsconfig.json used by the invocation.
+func (t Tsc) tsconfigPath() string {
+	if strings.HasSuffix(t.Project, ".json") {
+		return cleanPath(t.Project)
+	}
+	return path.Join(cleanPath(t.Project), "tsconfig.json")
+}
+
+// Eslint is an eslint invocation.
+type Eslint struct {
+	Dirs       []string
+	Fix        bool
+	Extensions []string
+}
+
+func (e Eslint) Command() string {
+	r := append([]string{"eslint"}, e.Dirs...)
+	if e.Fix {
+		r = append(r, "--fix")
+	}
+	if len(e.Extensions) > 0 {
+		r = append(r, "--ext", strings.Join(e.Extensions, ","))
+	}
+	return strings.Join(r, " ")
+}
+
+func (e Eslint) Outputs() []*scriptOutput { return nil }
+
+// VSCodeTest is a @vscode/test-cli invocation.
+type VSCodeTest struct {
+	Coverage          bool
+	CoverageReporters []string
+}
+
+func (v VSCodeTest) Command() string {
+	r := []string{"vscode-test"}
+	if v.Coverage {
+		r = append(r, "--coverage")
+	}
+	for _, cr := range v.CoverageReporters {
+		r = append(r, "--coverageReporter", cr)
+	}
+	return strings.Join(r, " ")
+}
+
+func (v VSCodeTest) Outputs() []*scriptOutput { return nil }
+
+// C8 runs a script with c8 code coverage.
+type C8 struct {
+	Reporters     []string
+	CheckCoverage bool
+	Script        Script
+}
+
+func (c C8) Command() string {
+	r := []string{"c8"}
+	for _, rep := range c.Reporters {
+		r = append(r, "--reporter", rep)
+	}
+	if c.CheckCoverage {
+		r = append(r, "--check-coverage")
+	}
+	return strings.Join(append(r, c.Script.Command()), " ")
+}
+
+func (c C8) Outputs() []*scriptOutput { return c.Script.Outputs() }
+
+// NpmRun runs another npm script.
+type NpmRun struct {
+	Script string
+}
+
+func (n NpmRun) Command() string { return fmt.Sprintf("npm run %s", n.Script) }
+
+// Outputs returns nil since the outputs are those of the other script (see
+// scriptOutputs).
+func (n NpmRun) Outputs() []*scriptOutput { return nil }
+
+// ShellScript is a plain shell command.
+type ShellScript string
+
+func (s ShellScript) Command() string          { return string(s) }
+func (s ShellScript) Outputs() []*scriptOutput { return nil }
+
+// renderScripts returns the commands for the scripts.
+func renderScripts(scripts map[string]Script) map[string]string {
+	if scripts == nil {
+		return nil
+	}
+	r := map[string]string{}
+	for name, s := range scripts {
+		r[name] = s.Command()
+	}
+	return r
+}
+
+// scriptOutputs returns the outputs of the named script, including the outputs
+// of any scripts that it runs.
+func scriptOutputs(scripts map[string]Script, name string) []*scriptOutput {
+	var outputs []*scriptOutput
+	seen := map[string]bool{}
+	var add func(name string)
+	add = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		s, ok := scripts[name]
+		if !ok {
+			return
+		}
+		if n, ok := s.(NpmRun); ok {
+			add(n.Script)
+			return
+		}
+		outputs = append(outputs, s.Outputs()...)
+	}
+	add(name)
+	return outputs
+}
+
+func groogScripts() map[string]Script {
+	esbuild := Esbuild{
+		Entry:     "./src/extension.ts",
+		Outfile:   "dist/extension.js",
+		Externals: []string{"vscode"},
+		Format:    "cjs",
+		Platform:  "node",
+		Bundle:    true,
+	}
+	prepublish, dev, watch := esbuild, esbuild, esbuild
+	prepublish.Minify = true
+	dev.Sourcemap = true
+	watch.Sourcemap = true
+	watch.Watch = true
+
+	tsc := Tsc{Project: "./", OutDir: "out"}
+	tscWatch := tsc
+	tscWatch.Watch = true
+
+	return map[string]Script{
+		prepublishScriptName: prepublish,
+		"esbuild-base":       esbuild,
+		"esbuild":            dev,
+		"esbuild-watch":      watch,
+		"test-compile":       tsc,
+
+		"compile":  tsc,
+		"watch":    tscWatch,
+		"pretest":  NpmRun{"compile"},
+		"lint":     Eslint{Dirs: []string{"src"}, Fix: true, Extensions: []string{"ts"}},
+		"test":     VSCodeTest{Coverage: true, CoverageReporters: []string{"lcov", "html"}},
+		"posttest": ShellScript("echo 'Open the following file for html coverage report:\nfile:///C:/Users/gleep/Desktop/Coding/vs-code/groog/coverage/Desktop/Coding/vs-code/groog/src/index.html'"),
+		"coverage": C8{Reporters: []string{"lcov"}, CheckCoverage: true, Script: NpmRun{"test"}},
+	}
+}
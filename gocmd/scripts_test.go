@@ -0,0 +1,114 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestScriptCommand(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		script Script
+		want   string
+	}{
+		{
+			name: "esbuild",
+			script: Esbuild{
+				Entry:     "./src/extension.ts",
+				Outfile:   "dist/extension.js",
+				Externals: []string{"vscode", "fs"},
+				Format:    "cjs",
+				Platform:  "node",
+				Bundle:    true,
+				Minify:    true,
+				Sourcemap: true,
+				Watch:     true,
+			},
+			want: "esbuild ./src/extension.ts --bundle --outfile=dist/extension.js --external:vscode --external:fs --format=cjs --platform=node --minify --sourcemap --watch",
+		},
+		{
+			name:   "tsc",
+			script: Tsc{Project: "./", OutDir: "out", Watch: true},
+			want:   "tsc -watch -p ./",
+		},
+		{
+			name:   "eslint",
+			script: Eslint{Dirs: []string{"src", "test"}, Fix: true, Extensions: []string{"ts", "tsx"}},
+			want:   "eslint src test --fix --ext ts,tsx",
+		},
+		{
+			name:   "vscode-test",
+			script: VSCodeTest{Coverage: true, CoverageReporters: []string{"lcov"}},
+			want:   "vscode-test --coverage --coverageReporter lcov",
+		},
+		{
+			name:   "c8",
+			script: C8{Reporters: []string{"lcov", "text"}, CheckCoverage: true, Script: NpmRun{"test"}},
+			want:   "c8 --reporter lcov --reporter text --check-coverage npm run test",
+		},
+		{
+			name:   "shell",
+			script: ShellScript("echo hello"),
+			want:   "echo hello",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := cmp.Diff(test.want, test.script.Command()); diff != "" {
+				t.Errorf("Command() returned incorrect value (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestScriptOutputs(t *testing.T) {
+	scripts := map[string]Script{
+		"vscode:prepublish": NpmRun{"build"},
+		"build":             Esbuild{Entry: "./src/extension.ts", Outfile: "./dist/extension.js", Sourcemap: true},
+		"compile":           Tsc{Project: "./", OutDir: "./out"},
+		"coverage":          C8{Script: NpmRun{"compile"}},
+		"loop":              NpmRun{"loop"},
+		"missing":           NpmRun{"nope"},
+	}
+	for _, test := range []struct {
+		name string
+		want []*scriptOutput
+	}{
+		{
+			name: "vscode:prepublish",
+			want: []*scriptOutput{
+				{"esbuild", "dist/extension.js"},
+				{"esbuild", "dist/extension.js.map"},
+			},
+		},
+		{
+			name: "compile",
+			want: []*scriptOutput{{"tsc", "out/"}},
+		},
+		{
+			// c8 only instruments the script, so the nested npm run isn't followed.
+			name: "coverage",
+		},
+		{name: "loop"},
+		{name: "missing"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := cmp.Diff(test.want, scriptOutputs(scripts, test.name)); diff != "" {
+				t.Errorf("scriptOutputs(%q) returned incorrect value (-want, +got):\n%s", test.name, diff)
+			}
+		})
+	}
+}
+
+func TestGroogScriptsWriteMain(t *testing.T) {
+	p := groogPackage("")
+	scripts := groogScripts()
+	for name := range scripts {
+		for _, so := range scriptOutputs(scripts, name) {
+			if so.writes(cleanPath(p.Main)) {
+				return
+			}
+		}
+	}
+	t.Errorf("no groog script writes Main (%s)", p.Main)
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// Some terminal bindings send sequences that the shell doesn't handle by
+// default (e.g. `ctrl+backspace` sends `C-x C-h`). Those bindings declare the
+// shell function to run for the sequence and the `shell-profile` command
+// generates the profile snippet that configures each shell accordingly.
+
+type Shell string
+
+const (
+	bash Shell = "bash"
+	zsh  Shell = "zsh"
+	pwsh Shell = "pwsh"
+	fish Shell = "fish"
+)
+
+var (
+	shells = []Shell{bash, zsh, pwsh, fish}
+
+	// Shell functions used by terminal bindings
+	backwardKillWord = map[Shell]string{
+		bash: "backward-kill-word",
+		zsh:  "backward-kill-word",
+		pwsh: "BackwardDeleteWord",
+		fish: "backward-kill-word",
+	}
+)
+
+// ShellSetup is the shell configuration required for a terminal sequence to
+// have the intended effect.
+type ShellSetup struct {
+	// Keys are the keys (in emacs notation; see terminal.go) that the sequence
+	// is composed of.
+	Keys []string
+	// Functions is a map from shell to the function (or widget) that the
+	// shell should run when it receives the sequence.
+	Functions map[Shell]string
+}
+
+// shellTermKeys sends the sequence for the provided keys to the terminal and
+// records that the shell needs to bind that sequence to the provided functions.
+func shellTermKeys(functions map[Shell]string, keys ...string) *KB {
+	k := termKeys(keys...)
+	k.ShellSetup = &ShellSetup{
+		Keys:      keys,
+		Functions: functions,
+	}
+	return k
+}
+
+func parseShell(s string) (Shell, error) {
+	for _, sh := range shells {
+		if string(sh) == s {
+			return sh, nil
+		}
+	}
+	return "", fmt.Errorf("unknown shell %q (must be one of %v)", s, shells)
+}
+
+// shellProfile returns the snippet that configures the shell for every
+// sequence that is sent by a keybinding in kbDefs.
+func shellProfile(shell Shell, kbDefs map[Key]map[string]*KB) (string, error) {
+	// Map from rendered binding line to the vscode keys that require it
+	lines := map[string][]string{}
+	for key, m := range kbDefs {
+		for _, k := range m {
+			for _, setup := range shellSetups(k) {
+				fn, ok := setup.Functions[shell]
+				if !ok {
+					continue
+				}
+				line, err := shellBindLine(shell, setup.Keys, fn)
+				if err != nil {
+					return "", fmt.Errorf("failed to create %s binding for %s: %v", shell, key, err)
+				}
+				if !slices.Contains(lines[line], key.ToString()) {
+					lines[line] = append(lines[line], key.ToString())
+				}
+			}
+		}
+	}
+
+	r := []string{
+		fmt.Sprintf("# Generated by `vs-package shell-profile --shell %s`.", shell),
+		"# Source this file from your shell profile so groog's terminal keybindings work.",
+	}
+	sortedLines := maps.Keys(lines)
+	slices.Sort(sortedLines)
+	for _, line := range sortedLines {
+		vsKeys := lines[line]
+		slices.Sort(vsKeys)
+		r = append(r, "", fmt.Sprintf("# %s", strings.Join(vsKeys, ", ")), line)
+	}
+	return strings.Join(r, "\n") + "\n", nil
+}
+
+// shellSetups returns the setups of kb and of all commands in its
+// multi-command sequence.
+func shellSetups(k *KB) []*ShellSetup {
+	if k == nil {
+		return nil
+	}
+	var r []*ShellSetup
+	if k.ShellSetup != nil {
+		r = append(r, k.ShellSetup)
+	}
+	if seq, ok := k.Args["sequence"].([]*KB); ok {
+		for _, sk := range seq {
+			r = append(r, shellSetups(sk)...)
+		}
+	}
+	return r
+}
+
+func shellBindLine(shell Shell, keys []string, fn string) (string, error) {
+	if shell == pwsh {
+		chord, err := pwshChord(keys)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Set-PSReadLineKeyHandler -Chord '%s' -Function %s", chord, fn), nil
+	}
+
+	var seq string
+	for _, k := range keys {
+		s, err := encodeTermKey(k)
+		if err != nil {
+			return "", err
+		}
+		seq += s
+	}
+
+	switch shell {
+	case bash:
+		return fmt.Sprintf(`bind '"%s":%s'`, escapeSequence(seq, readlineChar), fn), nil
+	case zsh:
+		return fmt.Sprintf(`bindkey '%s' %s`, escapeSequence(seq, zshChar), fn), nil
+	case fish:
+		return fmt.Sprintf(`bind %s %s`, escapeSequence(seq, fishChar), fn), nil
+	}
+	return "", fmt.Errorf("unsupported shell %q", shell)
+}
+
+func escapeSequence(seq string, f func(c byte) string) string {
+	var r []string
+	for i := 0; i < len(seq); i++ {
+		r = append(r, f(seq[i]))
+	}
+	return strings.Join(r, "")
+}
+
+// readlineChar formats a character in readline's key sequence notation.
+func readlineChar(c byte) string {
+	switch {
+	case c == 0x1b:
+		return `\e`
+	case c == 0x7f:
+		return `\C-?`
+	case c < ' ':
+		return fmt.Sprintf(`\C-%s`, strings.ToLower(string(rune(c+'@'))))
+	case c == '"' || c == '\\':
+		return `\` + string(c)
+	case c == '\'':
+		return `'\''`
+	}
+	return string(c)
+}
+
+// zshChar formats a character in bindkey's caret notation.
+func zshChar(c byte) string {
+	switch {
+	case c == 0x1b:
+		return `\e`
+	case c == 0x7f:
+		return `^?`
+	case c < ' ':
+		return fmt.Sprintf("^%c", c+'@')
+	case c == '^' || c == '\\':
+		return `\` + string(c)
+	case c == '\'':
+		return `'\''`
+	}
+	return string(c)
+}
+
+// fishChar formats a character for an unquoted fish bind sequence.
+func fishChar(c byte) string {
+	switch {
+	case c == 0x1b:
+		return `\e`
+	case c == 0x7f:
+		return `\x7f`
+	case c < ' ':
+		return fmt.Sprintf(`\c%s`, strings.ToLower(string(rune(c+'@'))))
+	case strings.ContainsRune(`[]~;'"(){}$*?#&|<>\ `, rune(c)):
+		return `\` + string(c)
+	}
+	return string(c)
+}
+
+var (
+	pwshKeyNames = map[string]string{
+		"up":        "UpArrow",
+		"down":      "DownArrow",
+		"left":      "LeftArrow",
+		"right":     "RightArrow",
+		"pageup":    "PageUp",
+		"pagedown":  "PageDown",
+		"home":      "Home",
+		"end":       "End",
+		"insert":    "Insert",
+		"delete":    "Delete",
+		"enter":     "Enter",
+		"tab":       "Tab",
+		"esc":       "Escape",
+		"space":     "Spacebar",
+		"backspace": "Backspace",
+	}
+)
+
+// pwshChord converts emacs notation keys into a PSReadLine chord.
+func pwshChord(keys []string) (string, error) {
+	var chord []string
+	for _, k := range keys {
+		if _, err := encodeTermKey(k); err != nil {
+			return "", err
+		}
+
+		ctrl, meta, shift, base := termModifiers(k)
+		var parts []string
+		if ctrl {
+			parts = append(parts, "Ctrl")
+		}
+		if meta {
+			parts = append(parts, "Alt")
+		}
+		if shift {
+			parts = append(parts, "Shift")
+		}
+		if name, ok := pwshKeyNames[base]; ok {
+			parts = append(parts, name)
+		} else if _, ok := termNamedKeys[base]; ok {
+			// Function keys
+			parts = append(parts, strings.ToUpper(base))
+		} else {
+			parts = append(parts, base)
+		}
+		chord = append(chord, strings.Join(parts, "+"))
+	}
+	return strings.Join(chord, ","), nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestShellBindLine(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		shell   Shell
+		keys    []string
+		fn      string
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "bash",
+			shell: bash,
+			keys:  []string{"C-x", "C-h"},
+			fn:    "backward-kill-word",
+			want:  `bind '"\C-x\C-h":backward-kill-word'`,
+		},
+		{
+			name:  "bash escape sequence",
+			shell: bash,
+			keys:  []string{"M-b", "pageup"},
+			fn:    "backward-word",
+			want:  `bind '"\eb\e[5~":backward-word'`,
+		},
+		{
+			name:  "zsh",
+			shell: zsh,
+			keys:  []string{"C-x", "C-h"},
+			fn:    "backward-kill-word",
+			want:  `bindkey '^X^H' backward-kill-word`,
+		},
+		{
+			name:  "zsh escape sequence",
+			shell: zsh,
+			keys:  []string{"C-up"},
+			fn:    "up-history",
+			want:  `bindkey '\e[1;5A' up-history`,
+		},
+		{
+			name:  "pwsh",
+			shell: pwsh,
+			keys:  []string{"C-x", "C-h"},
+			fn:    "BackwardDeleteWord",
+			want:  `Set-PSReadLineKeyHandler -Chord 'Ctrl+x,Ctrl+h' -Function BackwardDeleteWord`,
+		},
+		{
+			name:  "pwsh named keys",
+			shell: pwsh,
+			keys:  []string{"C-S-pageup", "M-up", "f5"},
+			fn:    "Abc",
+			want:  `Set-PSReadLineKeyHandler -Chord 'Ctrl+Shift+PageUp,Alt+UpArrow,F5' -Function Abc`,
+		},
+		{
+			name:    "pwsh invalid key",
+			shell:   pwsh,
+			keys:    []string{"nope"},
+			fn:      "Abc",
+			wantErr: `unknown terminal key "nope"`,
+		},
+		{
+			name:  "fish",
+			shell: fish,
+			keys:  []string{"C-x", "C-h"},
+			fn:    "backward-kill-word",
+			want:  `bind \cx\ch backward-kill-word`,
+		},
+		{
+			name:  "fish escape sequence",
+			shell: fish,
+			keys:  []string{"pageup", "M-b"},
+			fn:    "backward-word",
+			want:  `bind \e\[5\~\eb backward-word`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := shellBindLine(test.shell, test.keys, test.fn)
+			var gotErr string
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr); diff != "" {
+				t.Errorf("shellBindLine() returned incorrect error (-want, +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("shellBindLine() returned incorrect value (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestShellProfile(t *testing.T) {
+	kbDefs := map[Key]map[string]*KB{
+		ctrl(backspace): {
+			panelFocus.value: shellTermKeys(backwardKillWord, "C-x", "C-h"),
+		},
+		alt(backspace): {
+			panelFocus.value: mcWithArgs(
+				kb("groog.ctrlG"),
+				shellTermKeys(backwardKillWord, "C-x", "C-h"),
+			),
+		},
+		ctrl("z"): {
+			panelFocus.value: termKeys("C-/"),
+		},
+		ctrl("b"): {
+			panelFocus.value: shellTermKeys(map[Shell]string{zsh: "backward-word"}, "M-b"),
+		},
+	}
+
+	for _, test := range []struct {
+		shell Shell
+		want  string
+	}{
+		{
+			shell: bash,
+			want: `# Generated by ` + "`vs-package shell-profile --shell bash`" + `.
+# Source this file from your shell profile so groog's terminal keybindings work.
+
+# alt+backspace, ctrl+backspace
+bind '"\C-x\C-h":backward-kill-word'
+`,
+		},
+		{
+			shell: zsh,
+			want: `# Generated by ` + "`vs-package shell-profile --shell zsh`" + `.
+# Source this file from your shell profile so groog's terminal keybindings work.
+
+# ctrl+b
+bindkey '\eb' backward-word
+
+# alt+backspace, ctrl+backspace
+bindkey '^X^H' backward-kill-word
+`,
+		},
+	} {
+		t.Run(string(test.shell), func(t *testing.T) {
+			got, err := shellProfile(test.shell, kbDefs)
+			if err != nil {
+				t.Fatalf("shellProfile(%s) returned error: %v", test.shell, err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("shellProfile(%s) returned incorrect value (-want, +got):\n%s", test.shell, diff)
+			}
+		})
+	}
+}
+
+func TestParseShell(t *testing.T) {
+	if got, err := parseShell("fish"); err != nil || got != fish {
+		t.Errorf("parseShell(fish) returned (%q, %v); want (%q, nil)", got, err, fish)
+	}
+
+	wantErr := `unknown shell "cmd" (must be one of [bash zsh pwsh fish])`
+	if _, err := parseShell("cmd"); err == nil || err.Error() != wantErr {
+		t.Errorf("parseShell(cmd) returned error %v; want %q", err, wantErr)
+	}
+}
@@ -5,8 +5,8 @@ type Snippet struct {
 	Language string `json:"language"`
 }
 
-var (
-	Snippets = []*Snippet{
+func groogSnippets() []*Snippet {
+	return []*Snippet{
 		{
 			"snippets/go-test.json",
 			"go",
@@ -16,4 +16,4 @@ var (
 			"java",
 		},
 	}
-)
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// This file encodes key presses into the xterm control sequences that
+// `workbench.action.terminal.sendSequence` sends to the shell.
+// See the following link for the full list of sequences:
+// https://invisible-island.net/xterm/ctlseqs/ctlseqs.html
+//
+// Keys are written in emacs notation. A key is either a single character or
+// one of the names in `termNamedKeys`, optionally prefixed by any of the
+// modifiers `C-` (ctrl), `M-` (meta/alt) and `S-` (shift). For example:
+//   - "C-x" => "\u0018"
+//   - "M-b" => "\u001bb"
+//   - "pageup" => "\u001b[5~"
+//   - "C-S-up" => "\u001b[1;6A"
+
+const (
+	esc = "\u001b"
+	csi = esc + "["
+	ss3 = esc + "O"
+
+	bracketedPasteStart = csi + "200~"
+	bracketedPasteEnd   = csi + "201~"
+)
+
+// termNamedKey is a non-character key. Keys with a final character are sent as
+// `CSI final` (`SS3 final` for the function keys that xterm sends that way)
+// and keys with a code are sent as `CSI code ~`. When modifiers are set, the
+// sequence becomes `CSI 1;mod final` or `CSI code;mod ~` respectively.
+type termNamedKey struct {
+	code  int
+	final string
+	ss3   bool
+}
+
+var (
+	termNamedKeys = map[string]*termNamedKey{
+		"up":       {final: "A"},
+		"down":     {final: "B"},
+		"right":    {final: "C"},
+		"left":     {final: "D"},
+		"home":     {final: "H"},
+		"end":      {final: "F"},
+		"insert":   {code: 2},
+		"delete":   {code: 3},
+		"pageup":   {code: 5},
+		"pagedown": {code: 6},
+		"f1":       {final: "P", ss3: true},
+		"f2":       {final: "Q", ss3: true},
+		"f3":       {final: "R", ss3: true},
+		"f4":       {final: "S", ss3: true},
+		"f5":       {code: 15},
+		"f6":       {code: 17},
+		"f7":       {code: 18},
+		"f8":       {code: 19},
+		"f9":       {code: 20},
+		"f10":      {code: 21},
+		"f11":      {code: 23},
+		"f12":      {code: 24},
+	}
+
+	// Named keys that are sent as a single character.
+	termCharKeys = map[string]string{
+		"enter":     "\r",
+		"tab":       "\t",
+		"esc":       esc,
+		"space":     " ",
+		"backspace": "\u007f",
+	}
+)
+
+func (nk *termNamedKey) encode(mod int) string {
+	if mod == 1 {
+		if nk.final == "" {
+			return fmt.Sprintf("%s%d~", csi, nk.code)
+		}
+		if nk.ss3 {
+			return ss3 + nk.final
+		}
+		return csi + nk.final
+	}
+
+	if nk.final == "" {
+		return fmt.Sprintf("%s%d;%d~", csi, nk.code, mod)
+	}
+	return fmt.Sprintf("%s1;%d%s", csi, mod, nk.final)
+}
+
+// termModifiers splits the modifier prefixes from a key.
+func termModifiers(key string) (ctrl, meta, shift bool, base string) {
+	base = key
+	for len(base) > 2 && base[1] == '-' {
+		switch base[0] {
+		case 'C':
+			ctrl = true
+		case 'M':
+			meta = true
+		case 'S':
+			shift = true
+		default:
+			return
+		}
+		base = base[2:]
+	}
+	return
+}
+
+// controlCharacter returns the character sent when c is pressed with ctrl.
+func controlCharacter(c byte) (string, bool) {
+	switch {
+	case c >= 'a' && c <= 'z':
+		return string(rune(c - 'a' + 1)), true
+	case c >= '@' && c <= '_':
+		return string(rune(c - '@')), true
+	case c == ' ':
+		return "\u0000", true
+	// Terminals send the same character for ctrl+/ and ctrl+_
+	case c == '/':
+		return "\u001f", true
+	case c == '?':
+		return "\u007f", true
+	}
+	return "", false
+}
+
+// encodeTermKey returns the control sequence sent to the terminal when the
+// provided key (in emacs notation) is pressed.
+func encodeTermKey(key string) (string, error) {
+	ctrl, meta, shift, base := termModifiers(key)
+
+	if nk, ok := termNamedKeys[base]; ok {
+		mod := 1
+		if shift {
+			mod++
+		}
+		if meta {
+			mod += 2
+		}
+		if ctrl {
+			mod += 4
+		}
+		return nk.encode(mod), nil
+	}
+
+	if shift {
+		return "", fmt.Errorf("shift modifier is only supported for named keys (%q)", key)
+	}
+
+	var s string
+	if c, ok := termCharKeys[base]; ok {
+		if ctrl {
+			return "", fmt.Errorf("ctrl modifier is not supported for %q", key)
+		}
+		s = c
+	} else if len(base) != 1 {
+		return "", fmt.Errorf("unknown terminal key %q", key)
+	} else if ctrl {
+		c, ok := controlCharacter(base[0])
+		if !ok {
+			return "", fmt.Errorf("no control character for %q", key)
+		}
+		s = c
+	} else {
+		s = base
+	}
+
+	// Meta is sent as an escape prefix
+	if meta {
+		s = esc + s
+	}
+	return s, nil
+}
+
+// encodeTermKeys returns the concatenated control sequences for keys. Use this
+// instead of hand-written escape codes so the sequence is readable. Keys that
+// can't be encoded are skipped (and the first such error is returned).
+func encodeTermKeys(keys ...string) (string, error) {
+	var r []string
+	var firstErr error
+	for _, k := range keys {
+		s, err := encodeTermKey(k)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to encode terminal keys %v: %v", keys, err)
+			}
+			continue
+		}
+		r = append(r, s)
+	}
+	return strings.Join(r, ""), firstErr
+}
+
+// bracketedPaste wraps text in the bracketed paste markers so the shell
+// inserts it literally (rather than interpreting newlines, for example).
+func bracketedPaste(text string) string {
+	return bracketedPasteStart + text + bracketedPasteEnd
+}
+
+// termKeys sends the sequence for the provided keys to the terminal.
+func termKeys(keys ...string) *KB {
+	s, err := encodeTermKeys(keys...)
+	k := sendSequence(s)
+	if err != nil {
+		k.Errors = append(k.Errors, err.Error())
+	}
+	return k
+}
+
+// termSequenceNames is the reverse lookup for all named key sequences.
+func termSequenceNames() map[string]string {
+	m := map[string]string{}
+	for name := range termNamedKeys {
+		for _, ctrl := range []bool{false, true} {
+			for _, meta := range []bool{false, true} {
+				for _, shift := range []bool{false, true} {
+					key := name
+					if shift {
+						key = "S-" + key
+					}
+					if meta {
+						key = "M-" + key
+					}
+					if ctrl {
+						key = "C-" + key
+					}
+					s, err := encodeTermKey(key)
+					if err != nil {
+						panic(fmt.Sprintf("failed to encode named key %q: %v", key, err))
+					}
+					m[s] = key
+				}
+			}
+		}
+	}
+	return m
+}
+
+// describeTermSequence converts a control sequence into a readable,
+// space-separated list of keys (the inverse of encodeTermKeys). It's used to
+// show sendSequence bindings in reports (see describeCommand).
+func describeTermSequence(s string) string {
+	names := termSequenceNames()
+	seqs := []string{}
+	for seq := range names {
+		seqs = append(seqs, seq)
+	}
+	// Longest first so the most specific sequence is matched.
+	sort.Slice(seqs, func(i, j int) bool {
+		if len(seqs[i]) != len(seqs[j]) {
+			return len(seqs[i]) > len(seqs[j])
+		}
+		return seqs[i] < seqs[j]
+	})
+
+	var keys []string
+	for len(s) > 0 {
+		if strings.HasPrefix(s, bracketedPasteStart) {
+			if end := strings.Index(s, bracketedPasteEnd); end >= 0 {
+				keys = append(keys, fmt.Sprintf("paste(%q)", s[len(bracketedPasteStart):end]))
+				s = s[end+len(bracketedPasteEnd):]
+				continue
+			}
+		}
+
+		matched := false
+		for _, seq := range seqs {
+			if strings.HasPrefix(s, seq) {
+				keys = append(keys, names[seq])
+				s = s[len(seq):]
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+
+		prefix := ""
+		if len(s) > 1 && strings.HasPrefix(s, esc) {
+			prefix = "M-"
+			s = s[len(esc):]
+		}
+		keys = append(keys, prefix+describeTermChar(s[0]))
+		s = s[1:]
+	}
+	return strings.Join(keys, " ")
+}
+
+func describeTermChar(c byte) string {
+	for name, s := range termCharKeys {
+		if s == string(c) {
+			return name
+		}
+	}
+	// ctrl+/ is more recognizable than ctrl+_
+	if c == 0x1f {
+		return "C-/"
+	}
+	if c < ' ' {
+		return fmt.Sprintf("C-%c", strings.ToLower(string(rune(c + '@')))[0])
+	}
+	return string(c)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEncodeTermKey(t *testing.T) {
+	for _, test := range []struct {
+		key     string
+		want    string
+		wantErr string
+	}{
+		// Characters
+		{key: "a", want: "a"},
+		{key: "-", want: "-"},
+		{key: "enter", want: "\r"},
+		{key: "tab", want: "\t"},
+		{key: "esc", want: "\u001b"},
+		{key: "space", want: " "},
+		{key: "backspace", want: "\u007f"},
+		// Control characters
+		{key: "C-a", want: "\u0001"},
+		{key: "C-h", want: "\u0008"},
+		{key: "C-x", want: "\u0018"},
+		{key: "C-z", want: "\u001a"},
+		{key: "C-@", want: "\u0000"},
+		{key: "C-space", wantErr: `ctrl modifier is not supported for "C-space"`},
+		{key: "C-[", want: "\u001b"},
+		{key: "C-_", want: "\u001f"},
+		{key: "C-/", want: "\u001f"},
+		{key: "C-?", want: "\u007f"},
+		// Meta prefix
+		{key: "M-b", want: "\u001bb"},
+		{key: "M-C-x", want: "\u001b\u0018"},
+		{key: "M-enter", want: "\u001b\r"},
+		// Named keys
+		{key: "up", want: "\u001b[A"},
+		{key: "down", want: "\u001b[B"},
+		{key: "right", want: "\u001b[C"},
+		{key: "left", want: "\u001b[D"},
+		{key: "home", want: "\u001b[H"},
+		{key: "end", want: "\u001b[F"},
+		{key: "insert", want: "\u001b[2~"},
+		{key: "delete", want: "\u001b[3~"},
+		{key: "pageup", want: "\u001b[5~"},
+		{key: "pagedown", want: "\u001b[6~"},
+		{key: "f1", want: "\u001bOP"},
+		{key: "f4", want: "\u001bOS"},
+		{key: "f5", want: "\u001b[15~"},
+		{key: "f12", want: "\u001b[24~"},
+		// Named keys with modifiers
+		{key: "S-up", want: "\u001b[1;2A"},
+		{key: "M-up", want: "\u001b[1;3A"},
+		{key: "C-up", want: "\u001b[1;5A"},
+		{key: "C-S-up", want: "\u001b[1;6A"},
+		{key: "C-M-S-up", want: "\u001b[1;8A"},
+		{key: "C-pageup", want: "\u001b[5;5~"},
+		{key: "S-f1", want: "\u001b[1;2P"},
+		{key: "C-f5", want: "\u001b[15;5~"},
+		// Errors
+		{key: "S-a", wantErr: `shift modifier is only supported for named keys ("S-a")`},
+		{key: "pgup", wantErr: `unknown terminal key "pgup"`},
+		{key: "C-1", wantErr: `no control character for "C-1"`},
+	} {
+		t.Run(test.key, func(t *testing.T) {
+			got, err := encodeTermKey(test.key)
+			var gotErr string
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr); diff != "" {
+				t.Errorf("encodeTermKey(%q) returned incorrect error (-want, +got):\n%s", test.key, diff)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("encodeTermKey(%q) returned incorrect value (-want, +got):\n%s", test.key, diff)
+			}
+		})
+	}
+}
+
+func TestEncodeTermKeys(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		keys []string
+		want string
+	}{
+		{
+			name: "backward kill word",
+			keys: []string{"C-x", "C-h"},
+			want: "\u0018\u0008",
+		},
+		{
+			name: "run previous command",
+			keys: []string{"up", "enter"},
+			want: "\u001b[A\u000d",
+		},
+		{
+			name: "no keys",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := encodeTermKeys(test.keys...)
+			if err != nil {
+				t.Fatalf("encodeTermKeys(%v) returned error: %v", test.keys, err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("encodeTermKeys(%v) returned incorrect value (-want, +got):\n%s", test.keys, diff)
+			}
+		})
+	}
+}
+
+func TestEncodeTermKeysError(t *testing.T) {
+	got, err := encodeTermKeys("C-x", "nope")
+	wantErr := `failed to encode terminal keys [C-x nope]: unknown terminal key "nope"`
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("encodeTermKeys() returned error %v; want %q", err, wantErr)
+	}
+	if diff := cmp.Diff("\u0018", got); diff != "" {
+		t.Errorf("encodeTermKeys() returned incorrect value (-want, +got):\n%s", diff)
+	}
+
+	// The error is reported when the binding is generated.
+	ds := &Diagnostics{}
+	kbDefsToBindings(ds, map[Key]map[string]*KB{
+		ctrl("x"): {always.value: termKeys("C-x", "nope")},
+	}, nil)
+	if diff := cmp.Diff(wantErr, diagnosticMessages(ds)); diff != "" {
+		t.Errorf("kbDefsToBindings() recorded incorrect diagnostics (-want, +got):\n%s", diff)
+	}
+}
+
+// mustEncodeTermKeys returns the sequence for keys, panicking if any of them
+// can't be encoded.
+func mustEncodeTermKeys(keys ...string) string {
+	s, err := encodeTermKeys(keys...)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func TestBracketedPaste(t *testing.T) {
+	want := "\u001b[200~echo hello\nworld\u001b[201~"
+	if diff := cmp.Diff(want, bracketedPaste("echo hello\nworld")); diff != "" {
+		t.Errorf("bracketedPaste() returned incorrect value (-want, +got):\n%s", diff)
+	}
+}
+
+func TestDescribeTermSequence(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		seq  string
+		want string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "control characters",
+			seq:  mustEncodeTermKeys("C-x", "C-h"),
+			want: "C-x C-h",
+		},
+		{
+			name: "ctrl slash",
+			seq:  mustEncodeTermKeys("C-/"),
+			want: "C-/",
+		},
+		{
+			name: "named keys",
+			seq:  mustEncodeTermKeys("pageup", "up", "enter", "f1", "f12"),
+			want: "pageup up enter f1 f12",
+		},
+		{
+			name: "modifiers",
+			seq:  mustEncodeTermKeys("C-S-up", "M-b", "M-C-x", "S-f1", "C-pagedown"),
+			want: "C-S-up M-b M-C-x S-f1 C-pagedown",
+		},
+		{
+			name: "characters",
+			seq:  "ls",
+			want: "l s",
+		},
+		{
+			name: "bracketed paste",
+			seq:  bracketedPaste("ls -l") + mustEncodeTermKeys("enter"),
+			want: `paste("ls -l") enter`,
+		},
+		{
+			name: "escape",
+			seq:  mustEncodeTermKeys("esc"),
+			want: "esc",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := cmp.Diff(test.want, describeTermSequence(test.seq)); diff != "" {
+				t.Errorf("describeTermSequence(%q) returned incorrect value (-want, +got):\n%s", test.seq, diff)
+			}
+		})
+	}
+}
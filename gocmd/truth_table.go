@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+)
+
+// The bindings for a key can depend on many context keys, which makes it hard
+// to tell which command runs in a given context. The `table` command prints
+// a truth table with the command that wins for each combination of the
+// context keys (and comparisons) used by the key's when clauses. Rows with
+// the same command are merged (with don't-care values) to keep it compact.
+
+type TableFormat string
+
+const (
+	markdownFormat TableFormat = "markdown"
+	csvFormat      TableFormat = "csv"
+
+	// dontCare is the value of a variable that doesn't affect the row.
+	dontCare = "-"
+	// noCommand is the command for rows in which none of the bindings match.
+	noCommand = "(none)"
+)
+
+var (
+	tableFormats = []TableFormat{markdownFormat, csvFormat}
+)
+
+func parseTableFormat(s string) (TableFormat, error) {
+	for _, f := range tableFormats {
+		if string(f) == s {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unknown format %q (must be one of %v)", s, tableFormats)
+}
+
+// truthTable is the command that runs for each combination of variables.
+type truthTable struct {
+	Variables []string
+	Rows      []*truthTableRow
+}
+
+type truthTableRow struct {
+	// Values are the values of the variables ("true", "false", or dontCare).
+	Values  []string
+	Command string
+}
+
+// keybindingLabel returns the command run by the keybinding (along with its
+// multi-command sequence, if any).
+func keybindingLabel(kb *Keybinding) string {
+	var sequence []string
+	for _, c := range sequenceCommands(kb.Args) {
+		sequence = append(sequence, c.Command)
+	}
+	if len(sequence) == 0 {
+		return kb.Command
+	}
+	return fmt.Sprintf("%s [%s]", kb.Command, strings.Join(sequence, ", "))
+}
+
+// keyTruthTable returns the truth table for the keybindings (in package.json
+// order) of the key.
+func keyTruthTable(excludes map[[2]string]bool, kbs []*Keybinding, key string) (*truthTable, error) {
+	var keyKBs []*Keybinding
+	for _, kb := range kbs {
+		if kb.Key == key {
+			keyKBs = append(keyKBs, kb)
+		}
+	}
+	if len(keyKBs) == 0 {
+		return nil, fmt.Errorf("no bindings for %s", key)
+	}
+
+	// Only bindings that run a command (and aren't removed) can win.
+	var active []*Keybinding
+	var exprs []whenExpr
+	wv := &whenVariables{ids: map[string]int{}, excludes: excludes}
+	for i, kb := range keyKBs {
+		if strings.HasPrefix(kb.Command, "-") {
+			continue
+		}
+		removed := false
+		for _, r := range keyKBs[i+1:] {
+			removed = removed || removes(r, kb)
+		}
+		if removed {
+			continue
+		}
+		e, err := parseWhen(kb.When)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse when clause %q: %v", kb.When, err)
+		}
+		wv.collect(e)
+		active = append(active, kb)
+		exprs = append(exprs, e)
+	}
+	n := len(wv.atoms)
+	if n > maxWhenVariables {
+		return nil, fmt.Errorf("bindings for %s depend on too many context keys (%d) to build a truth table", key, n)
+	}
+
+	// The winner (index into active, or -1 if nothing matches) for each row.
+	winners := map[int][]uint{}
+	var dontCares []uint
+	for row := uint(0); row < 1<<n; row++ {
+		if !wv.possible(row) {
+			dontCares = append(dontCares, row)
+			continue
+		}
+		winner := -1
+		for i, e := range exprs {
+			if wv.eval(e, row) {
+				winner = i
+			}
+		}
+		winners[winner] = append(winners[winner], row)
+	}
+
+	tt := &truthTable{}
+	for _, a := range wv.atoms {
+		tt.Variables = append(tt.Variables, a.pos)
+	}
+	for i := -1; i < len(active); i++ {
+		minterms, ok := winners[i]
+		if !ok {
+			continue
+		}
+		command := noCommand
+		if i >= 0 {
+			command = keybindingLabel(active[i])
+		}
+		cover := minimalCover(primeImplicants(minterms, dontCares), minterms, n)
+		sortFunc(cover, func(a, b implicant) bool {
+			if a.value&^a.mask != b.value&^b.mask {
+				return a.value&^a.mask < b.value&^b.mask
+			}
+			return a.mask < b.mask
+		})
+		for _, im := range cover {
+			r := &truthTableRow{Command: command}
+			for j := 0; j < n; j++ {
+				switch {
+				case im.mask>>j&1 == 1:
+					r.Values = append(r.Values, dontCare)
+				case im.value>>j&1 == 1:
+					r.Values = append(r.Values, "true")
+				default:
+					r.Values = append(r.Values, "false")
+				}
+			}
+			tt.Rows = append(tt.Rows, r)
+		}
+	}
+	return tt, nil
+}
+
+func (tt *truthTable) records() [][]string {
+	records := [][]string{append(append([]string{}, tt.Variables...), "command")}
+	for _, r := range tt.Rows {
+		records = append(records, append(append([]string{}, r.Values...), r.Command))
+	}
+	return records
+}
+
+// markdown returns the table as a Markdown table.
+func (tt *truthTable) markdown() string {
+	var lines []string
+	for i, record := range tt.records() {
+		var cells []string
+		for _, c := range record {
+			cells = append(cells, strings.ReplaceAll(c, "|", `\|`))
+		}
+		lines = append(lines, fmt.Sprintf("| %s |", strings.Join(cells, " | ")))
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", len(record)))
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// csv returns the table as CSV.
+func (tt *truthTable) csv() (string, error) {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	if err := w.WriteAll(tt.records()); err != nil {
+		return "", fmt.Errorf("failed to write csv: %v", err)
+	}
+	return b.String(), nil
+}
+
+func (c *cli) truthTable(o command.Output, d *command.Data, key string, format TableFormat) error {
+	p, ds := generateGroogPackage("")
+	if err := printDiagnostics(o, ds); err != nil {
+		return err
+	}
+
+	tt, err := keyTruthTable(contextExclusions(groogDefinitions().Contexts), p.Contributes.Keybindings, key)
+	if err != nil {
+		return o.Err(err)
+	}
+	switch format {
+	case csvFormat:
+		s, err := tt.csv()
+		if err != nil {
+			return o.Err(err)
+		}
+		o.Stdout(s)
+	default:
+		o.Stdout(tt.markdown())
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestKeyTruthTable(t *testing.T) {
+	excludes := contextExclusions([]*ContextKey{
+		{Key: "editorTextFocus", Type: contextBool, Excludes: []string{"terminalFocus"}},
+		{Key: "terminalFocus", Type: contextBool},
+	})
+	for _, test := range []struct {
+		name    string
+		kbs     []*Keybinding
+		key     string
+		want    *truthTable
+		wantErr string
+	}{
+		{
+			name:    "no bindings",
+			kbs:     []*Keybinding{{Key: "ctrl+b", Command: "groog.b"}},
+			key:     "ctrl+a",
+			wantErr: "no bindings for ctrl+a",
+		},
+		{
+			name: "always",
+			kbs:  []*Keybinding{{Key: "ctrl+a", Command: "groog.a"}},
+			key:  "ctrl+a",
+			want: &truthTable{
+				Rows: []*truthTableRow{
+					{Command: "groog.a"},
+				},
+			},
+		},
+		{
+			name: "merges rows",
+			kbs: []*Keybinding{
+				{Key: "ctrl+a", Command: "groog.a", When: "a && b || a && c"},
+				{Key: "ctrl+a", Command: "groog.b", When: "!a"},
+				{Key: "ctrl+b", Command: "groog.c", When: "d"},
+			},
+			key: "ctrl+a",
+			want: &truthTable{
+				Variables: []string{"a", "b", "c"},
+				Rows: []*truthTableRow{
+					{[]string{"true", "false", "false"}, noCommand},
+					{[]string{"true", "true", dontCare}, "groog.a"},
+					{[]string{"true", dontCare, "true"}, "groog.a"},
+					{[]string{"false", dontCare, dontCare}, "groog.b"},
+				},
+			},
+		},
+		{
+			name: "later bindings win",
+			kbs: []*Keybinding{
+				{Key: "ctrl+a", Command: "groog.a"},
+				{Key: "ctrl+a", Command: "groog.b", When: "b"},
+			},
+			key: "ctrl+a",
+			want: &truthTable{
+				Variables: []string{"b"},
+				Rows: []*truthTableRow{
+					{[]string{"false"}, "groog.a"},
+					{[]string{"true"}, "groog.b"},
+				},
+			},
+		},
+		{
+			name: "impossible rows are don't-cares",
+			kbs: []*Keybinding{
+				{Key: "ctrl+a", Command: "groog.a", When: "editorTextFocus && !terminalFocus"},
+				{Key: "ctrl+a", Command: "groog.b", When: "resourceLangId == 'go' && resourceLangId != java"},
+			},
+			key: "ctrl+a",
+			want: &truthTable{
+				Variables: []string{"editorTextFocus", "terminalFocus", "resourceLangId == 'go'", "resourceLangId == java"},
+				Rows: []*truthTableRow{
+					{[]string{"false", dontCare, "false", dontCare}, noCommand},
+					{[]string{"true", dontCare, "false", dontCare}, "groog.a"},
+					{[]string{dontCare, dontCare, "true", dontCare}, "groog.b"},
+				},
+			},
+		},
+		{
+			name: "removed bindings",
+			kbs: []*Keybinding{
+				{Key: "ctrl+a", Command: "groog.a", When: "a"},
+				{Key: "ctrl+a", Command: "groog.b", When: "b"},
+				{Key: "ctrl+a", Command: "-groog.a"},
+			},
+			key: "ctrl+a",
+			want: &truthTable{
+				Variables: []string{"b"},
+				Rows: []*truthTableRow{
+					{[]string{"false"}, noCommand},
+					{[]string{"true"}, "groog.b"},
+				},
+			},
+		},
+		{
+			name: "multi-command",
+			kbs: []*Keybinding{
+				{Key: "ctrl+a", Command: "groog.multiCommand.execute", Args: argsMap(MultiCommandArgs{Sequence: []*KB{kb("groog.a"), kb("groog.b")}})},
+			},
+			key: "ctrl+a",
+			want: &truthTable{
+				Rows: []*truthTableRow{
+					{Command: "groog.multiCommand.execute [groog.a, groog.b]"},
+				},
+			},
+		},
+		{
+			name: "invalid when clause",
+			kbs: []*Keybinding{
+				{Key: "ctrl+a", Command: "groog.a", When: "a &&"},
+			},
+			key:     "ctrl+a",
+			wantErr: `failed to parse when clause "a &&": column 5: unexpected end of when clause`,
+		},
+		{
+			name: "too many context keys",
+			kbs: []*Keybinding{
+				{Key: "ctrl+a", Command: "groog.a", When: "a && b && c && d && e && f && g"},
+				{Key: "ctrl+a", Command: "groog.b", When: "h && i && j && k && l && m"},
+			},
+			key:     "ctrl+a",
+			wantErr: "bindings for ctrl+a depend on too many context keys (13) to build a truth table",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := keyTruthTable(excludes, test.kbs, test.key)
+			var gotErr string
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr); diff != "" {
+				t.Errorf("keyTruthTable() returned incorrect error (-want, +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("keyTruthTable() returned incorrect value (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTruthTableFormats(t *testing.T) {
+	tt := &truthTable{
+		Variables: []string{"a", "resourceFilename =~ /a|b/"},
+		Rows: []*truthTableRow{
+			{[]string{"true", dontCare}, "groog.a"},
+			{[]string{"false", "true"}, "groog.multiCommand.execute [groog.a, groog.b]"},
+		},
+	}
+
+	wantMarkdown := strings.Join([]string{
+		`| a | resourceFilename =~ /a\|b/ | command |`,
+		`| --- | --- | --- |`,
+		`| true | - | groog.a |`,
+		`| false | true | groog.multiCommand.execute [groog.a, groog.b] |`,
+		``,
+	}, "\n")
+	if diff := cmp.Diff(wantMarkdown, tt.markdown()); diff != "" {
+		t.Errorf("truthTable.markdown() returned incorrect value (-want, +got):\n%s", diff)
+	}
+
+	wantCSV := strings.Join([]string{
+		`a,resourceFilename =~ /a|b/,command`,
+		`true,-,groog.a`,
+		`false,true,"groog.multiCommand.execute [groog.a, groog.b]"`,
+		``,
+	}, "\n")
+	got, err := tt.csv()
+	if err != nil {
+		t.Fatalf("truthTable.csv() returned error: %v", err)
+	}
+	if diff := cmp.Diff(wantCSV, got); diff != "" {
+		t.Errorf("truthTable.csv() returned incorrect value (-want, +got):\n%s", diff)
+	}
+}
+
+func TestGroogTruthTables(t *testing.T) {
+	// Every key must have a truth table.
+	defs := groogDefinitions()
+	p := buildPackage(&Diagnostics{}, defs, "")
+	excludes := contextExclusions(defs.Contexts)
+	checked := map[string]bool{}
+	for _, kb := range p.Contributes.Keybindings {
+		if checked[kb.Key] {
+			continue
+		}
+		checked[kb.Key] = true
+		if _, err := keyTruthTable(excludes, p.Contributes.Keybindings, kb.Key); err != nil {
+			t.Errorf("keyTruthTable(%s) returned error: %v", kb.Key, err)
+		}
+	}
+}
+
+func TestParseTableFormat(t *testing.T) {
+	if got, err := parseTableFormat("csv"); err != nil || got != csvFormat {
+		t.Errorf("parseTableFormat(csv) returned (%q, %v); want (%q, nil)", got, err, csvFormat)
+	}
+
+	wantErr := `unknown format "html" (must be one of [markdown csv])`
+	if _, err := parseTableFormat("html"); err == nil || err.Error() != wantErr {
+		t.Errorf("parseTableFormat(html) returned error %v; want %q", err, wantErr)
+	}
+}
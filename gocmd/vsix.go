@@ -0,0 +1,557 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/leep-frog/command/command"
+	"golang.org/x/exp/slices"
+)
+
+// A VSIX is a zip file that follows the Open Packaging Conventions (OPC). The
+// layout here matches the one produced by vsce
+// (https://github.com/microsoft/vscode-vsce/blob/main/src/package.ts):
+//
+//	[Content_Types].xml
+//	extension.vsixmanifest
+//	extension/package.json
+//	extension/...
+//
+// Files are selected from the repo root the same way vsce does it: everything
+// is included unless it matches a pattern in .vscodeignore (or one of the
+// default ignore patterns).
+
+const (
+	vsixExtensionDir    = "extension"
+	vsixIgnoreFile      = ".vscodeignore"
+	vsixManifestFile    = "extension.vsixmanifest"
+	vsixContentTypeFile = "[Content_Types].xml"
+)
+
+var (
+	// vsixDefaultIgnore are the ignore patterns that are applied before the
+	// ones in .vscodeignore.
+	vsixDefaultIgnore = []string{
+		".git/**",
+		".vscode-test/**",
+		"**/.DS_Store",
+		"**/*.vsix",
+		"**/*.vsixmanifest",
+		"**/.vscodeignore",
+		"**/.gitattributes",
+		// The generator isn't part of the extension (and package.json is always
+		// added from the generated package rather than copied).
+		"gocmd/**",
+		"package.json",
+		// Only production dependencies are included (see lockDependencyPatterns).
+		"node_modules/**",
+	}
+
+	vsixContentTypes = map[string]string{
+		".css":          "text/css",
+		".html":         "text/html",
+		".jpeg":         "image/jpeg",
+		".jpg":          "image/jpeg",
+		".js":           "application/javascript",
+		".json":         "application/json",
+		".md":           "text/markdown",
+		".png":          "image/png",
+		".svg":          "image/svg+xml",
+		".txt":          "text/plain",
+		".vsixmanifest": "text/xml",
+		".xml":          "text/xml",
+	}
+	defaultContentType = "application/octet-stream"
+
+	globTokenRegex = regexp.MustCompile(`\*\*/|\*\*|\*|\?|[^*?]+`)
+)
+
+type ignorePattern struct {
+	pattern string
+	regex   *regexp.Regexp
+	negate  bool
+	// prefix is the literal part of the pattern before the first wildcard.
+	prefix string
+}
+
+// ignoreList is an ordered list of .vscodeignore style patterns. Later
+// patterns take precedence, and patterns prefixed with `!` re-include files.
+type ignoreList []*ignorePattern
+
+// parseIgnoreFile returns the patterns in an ignore file's contents.
+func parseIgnoreFile(contents string) []string {
+	var patterns []string
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns
+}
+
+func newIgnoreList(patterns ...string) (ignoreList, error) {
+	var il ignoreList
+	for _, p := range patterns {
+		ip := &ignorePattern{pattern: p}
+		glob := p
+		if strings.HasPrefix(glob, "!") {
+			ip.negate = true
+			glob = glob[1:]
+		}
+		glob = strings.TrimPrefix(glob, "/")
+		if strings.HasSuffix(glob, "/") {
+			glob += "**"
+		}
+		if glob == "" {
+			return nil, fmt.Errorf("invalid ignore pattern %q", p)
+		}
+
+		var suffix string
+		if strings.HasSuffix(glob, "/**") {
+			// "dir/**" also matches the directory itself
+			glob = strings.TrimSuffix(glob, "/**")
+			suffix = "(?:/.*)?"
+		}
+
+		var sb strings.Builder
+		sb.WriteString("^")
+		for _, token := range globTokenRegex.FindAllString(glob, -1) {
+			switch token {
+			case "**/":
+				sb.WriteString("(?:.*/)?")
+			case "**":
+				sb.WriteString(".*")
+			case "*":
+				sb.WriteString("[^/]*")
+			case "?":
+				sb.WriteString("[^/]")
+			default:
+				sb.WriteString(regexp.QuoteMeta(token))
+			}
+		}
+		sb.WriteString(suffix + "$")
+
+		r, err := regexp.Compile(sb.String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid ignore pattern %q: %v", p, err)
+		}
+		ip.regex = r
+		ip.prefix = glob
+		if i := strings.IndexAny(glob, "*?"); i >= 0 {
+			ip.prefix = glob[:i]
+		}
+		il = append(il, ip)
+	}
+	return il, nil
+}
+
+// matches returns whether the pattern matches the path or one of its parent
+// directories.
+func (ip *ignorePattern) matches(p string) bool {
+	for ; p != "." && p != "/" && p != ""; p = path.Dir(p) {
+		if ip.regex.MatchString(p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (il ignoreList) ignored(p string) bool {
+	var ignored bool
+	for _, ip := range il {
+		if ip.matches(p) {
+			ignored = !ip.negate
+		}
+	}
+	return ignored
+}
+
+// skipDir returns whether nothing in the directory can be included.
+func (il ignoreList) skipDir(dir string) bool {
+	if !il.ignored(dir) {
+		return false
+	}
+	for _, ip := range il {
+		if ip.negate && (strings.HasPrefix(ip.prefix, dir+"/") || strings.HasPrefix(dir+"/", ip.prefix)) {
+			return false
+		}
+	}
+	return true
+}
+
+// lockDependencyPatterns returns the patterns that re-include the production
+// dependencies listed in the package-lock.json contents.
+func lockDependencyPatterns(lock []byte) ([]string, error) {
+	var l struct {
+		Packages map[string]struct {
+			Dev bool `json:"dev"`
+		} `json:"packages"`
+	}
+	if err := json.Unmarshal(lock, &l); err != nil {
+		return nil, fmt.Errorf("failed to parse package-lock.json: %v", err)
+	}
+
+	var patterns []string
+	for _, p := range sortedKeys(l.Packages) {
+		if p != "" && !l.Packages[p].Dev {
+			patterns = append(patterns, fmt.Sprintf("!%s/**", p))
+		}
+	}
+	return patterns, nil
+}
+
+// vsixFiles returns the sorted list of files (relative to the root of fsys)
+// that aren't ignored.
+func vsixFiles(fsys fs.FS, il ignoreList) ([]string, error) {
+	var files []string
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == "." {
+			return nil
+		}
+		if d.IsDir() {
+			if il.skipDir(p) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !il.ignored(p) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(files)
+	return files, nil
+}
+
+// validateVSIXFiles checks that every file referenced by the package (and
+// every media file and prepublish output) is included in the VSIX.
+func validateVSIXFiles(fsys fs.FS, files []string, p *Package, media []string, outputs []*scriptOutput) error {
+	included := map[string]bool{}
+	for _, f := range files {
+		included[f] = true
+	}
+
+	type required struct {
+		kind, path, hint string
+	}
+	reqs := []*required{{"main", p.Main, ""}}
+	for _, s := range p.contributions().Snipppets {
+		reqs = append(reqs, &required{"snippet", s.Path, ""})
+	}
+	for _, m := range media {
+		reqs = append(reqs, &required{"media", m, ""})
+	}
+	for _, so := range outputs {
+		// Directories (e.g. tsc's outDir) can't be checked without knowing
+		// which files are compiled into them.
+		if !strings.HasSuffix(so.Output, "/") {
+			reqs = append(reqs, &required{"build output", so.Output, fmt.Sprintf(" (run `npm run %s`)", prepublishScriptName)})
+		}
+	}
+
+	var errs []string
+	for _, r := range reqs {
+		p := path.Clean(strings.TrimPrefix(r.path, "./"))
+		if included[p] {
+			continue
+		}
+		if _, err := fs.Stat(fsys, p); err != nil {
+			errs = append(errs, fmt.Sprintf("%s file %q does not exist%s", r.kind, r.path, r.hint))
+		} else {
+			errs = append(errs, fmt.Sprintf("%s file %q is excluded by the ignore list", r.kind, r.path))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid VSIX contents:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+type vsixPackageManifest struct {
+	XMLName      xml.Name          `xml:"PackageManifest"`
+	Version      string            `xml:"Version,attr"`
+	Xmlns        string            `xml:"xmlns,attr"`
+	XmlnsD       string            `xml:"xmlns:d,attr"`
+	Metadata     *vsixMetadata     `xml:"Metadata"`
+	Installation *vsixInstallation `xml:"Installation"`
+	Dependencies struct{}          `xml:"Dependencies"`
+	Assets       []*vsixAsset      `xml:"Assets>Asset"`
+}
+
+type vsixMetadata struct {
+	Identity    *vsixIdentity    `xml:"Identity"`
+	DisplayName string           `xml:"DisplayName"`
+	Description *vsixDescription `xml:"Description"`
+	Categories  string           `xml:"Categories"`
+	GalleryFlag string           `xml:"GalleryFlags"`
+	Properties  []*vsixProperty  `xml:"Properties>Property"`
+}
+
+type vsixIdentity struct {
+	Language  string `xml:"Language,attr"`
+	ID        string `xml:"Id,attr"`
+	Version   string `xml:"Version,attr"`
+	Publisher string `xml:"Publisher,attr"`
+}
+
+type vsixDescription struct {
+	Space string `xml:"xml:space,attr"`
+	Text  string `xml:",chardata"`
+}
+
+type vsixInstallation struct {
+	Target struct {
+		ID string `xml:"Id,attr"`
+	} `xml:"InstallationTarget"`
+}
+
+// vsixProperty always has a value (empty for e.g. an extension without
+// dependencies), just like the manifests created by vsce.
+type vsixProperty struct {
+	ID    string `xml:"Id,attr"`
+	Value string `xml:"Value,attr"`
+}
+
+type vsixAsset struct {
+	Type        string `xml:"Type,attr"`
+	Path        string `xml:"Path,attr"`
+	Addressable string `xml:"Addressable,attr"`
+}
+
+// vsixManifest returns the extension.vsixmanifest contents for the package.
+func vsixManifest(p *Package, files []string) ([]byte, error) {
+	m := &vsixPackageManifest{
+		Version: "2.0.0",
+		Xmlns:   "http://schemas.microsoft.com/developer/vsx-schema/2011",
+		XmlnsD:  "http://schemas.microsoft.com/developer/vsx-schema-design/2011",
+		Metadata: &vsixMetadata{
+			Identity: &vsixIdentity{
+				Language:  "en-US",
+				ID:        p.Name,
+				Version:   p.Version,
+				Publisher: p.Publisher,
+			},
+			DisplayName: p.DisplayName,
+			Description: &vsixDescription{"preserve", p.Description},
+			Categories:  strings.Join(p.Categories, ","),
+			GalleryFlag: "Public",
+			Properties: []*vsixProperty{
+				{ID: "Microsoft.VisualStudio.Code.Engine", Value: p.Engines["vscode"]},
+				{ID: "Microsoft.VisualStudio.Code.ExtensionDependencies", Value: strings.Join(p.ExtensionDependencies, ",")},
+				{ID: "Microsoft.VisualStudio.Code.ExtensionPack", Value: strings.Join(p.ExtensionPack, ",")},
+				{ID: "Microsoft.VisualStudio.Code.ExtensionKind", Value: "workspace"},
+			},
+		},
+		Installation: &vsixInstallation{},
+		Assets: []*vsixAsset{
+			{Type: "Microsoft.VisualStudio.Code.Manifest", Path: "extension/package.json", Addressable: "true"},
+		},
+	}
+	m.Installation.Target.ID = "Microsoft.VisualStudio.Code"
+
+	if p.Repository != nil && p.Repository.URL != "" {
+		m.Metadata.Properties = append(m.Metadata.Properties,
+			&vsixProperty{ID: "Microsoft.VisualStudio.Services.Links.Source", Value: p.Repository.URL},
+		)
+	}
+	if v, err := parseVersion(p.Version); err == nil && v.isPreReleaseChannel() {
+		m.Metadata.Properties = append(m.Metadata.Properties,
+			&vsixProperty{ID: "Microsoft.VisualStudio.Code.PreRelease", Value: "true"},
+		)
+	}
+
+	// Add the well-known documents as assets (if they're included).
+	for _, f := range files {
+		var assetType string
+		switch strings.ToLower(f) {
+		case "readme.md":
+			assetType = "Microsoft.VisualStudio.Services.Content.Details"
+		case "changelog.md":
+			assetType = "Microsoft.VisualStudio.Services.Content.Changelog"
+		case "license.md", "license.txt", "license":
+			assetType = "Microsoft.VisualStudio.Services.Content.License"
+		default:
+			continue
+		}
+		m.Assets = append(m.Assets, &vsixAsset{Type: assetType, Path: path.Join(vsixExtensionDir, f), Addressable: "true"})
+	}
+
+	b, err := xml.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s: %v", vsixManifestFile, err)
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+type vsixTypes struct {
+	XMLName  xml.Name              `xml:"Types"`
+	Xmlns    string                `xml:"xmlns,attr"`
+	Defaults []*vsixContentDefault `xml:"Default"`
+}
+
+type vsixContentDefault struct {
+	Extension   string `xml:"Extension,attr"`
+	ContentType string `xml:"ContentType,attr"`
+}
+
+// vsixContentTypesXML returns the [Content_Types].xml contents for the
+// provided archive paths.
+func vsixContentTypesXML(paths []string) ([]byte, error) {
+	exts := map[string]string{}
+	for _, p := range paths {
+		ext := strings.ToLower(path.Ext(p))
+		if ext == "" {
+			continue
+		}
+		ct, ok := vsixContentTypes[ext]
+		if !ok {
+			ct = defaultContentType
+		}
+		exts[ext] = ct
+	}
+
+	ct := &vsixTypes{Xmlns: "http://schemas.openxmlformats.org/package/2006/content-types"}
+	for _, ext := range sortedKeys(exts) {
+		ct.Defaults = append(ct.Defaults, &vsixContentDefault{ext, exts[ext]})
+	}
+	b, err := xml.MarshalIndent(ct, "", "\t")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s: %v", vsixContentTypeFile, err)
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+// writeVSIX writes the VSIX for the package to w. The files are read from
+// fsys and placed under the extension/ directory.
+func writeVSIX(w io.Writer, fsys fs.FS, p *Package, files []string) error {
+	packageJSON, err := marshalJson(p)
+	if err != nil {
+		return err
+	}
+	manifest, err := vsixManifest(p, files)
+	if err != nil {
+		return err
+	}
+
+	entries := map[string][]byte{
+		vsixManifestFile: manifest,
+		path.Join(vsixExtensionDir, "package.json"): packageJSON,
+	}
+	for _, f := range files {
+		b, err := fs.ReadFile(fsys, f)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", f, err)
+		}
+		entries[path.Join(vsixExtensionDir, f)] = b
+	}
+
+	contentTypes, err := vsixContentTypesXML(sortedKeys(entries))
+	if err != nil {
+		return err
+	}
+	entries[vsixContentTypeFile] = contentTypes
+
+	zw := zip.NewWriter(w)
+	// [Content_Types].xml must be the first entry.
+	names := []string{vsixContentTypeFile}
+	for _, name := range sortedKeys(entries) {
+		if name != vsixContentTypeFile {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		if err != nil {
+			return fmt.Errorf("failed to add %s to the VSIX: %v", name, err)
+		}
+		if _, err := fw.Write(entries[name]); err != nil {
+			return fmt.Errorf("failed to add %s to the VSIX: %v", name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write the VSIX: %v", err)
+	}
+	return nil
+}
+
+// vsixIgnoreList returns the ignore list for the repo root.
+func vsixIgnoreList(fsys fs.FS) (ignoreList, error) {
+	patterns := slices.Clone(vsixDefaultIgnore)
+
+	if lock, err := fs.ReadFile(fsys, "package-lock.json"); err == nil {
+		deps, err := lockDependencyPatterns(lock)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, deps...)
+	}
+
+	b, err := fs.ReadFile(fsys, vsixIgnoreFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %v", vsixIgnoreFile, err)
+	}
+	return newIgnoreList(append(patterns, parseIgnoreFile(string(b))...)...)
+}
+
+// buildVSIX generates the groog package and returns it along with the
+// contents of its VSIX.
+func (c *cli) buildVSIX(o command.Output, d *command.Data) (*Package, []byte, error) {
+	fsys := os.DirFS(filepath.Dir(filepath.Dir(runtimeNode.Get(d))))
+
+	p, ds := generateGroogPackage("")
+	defs := groogDefinitions()
+	if err := printDiagnostics(o, ds); err != nil {
+		return nil, nil, err
+	}
+
+	il, err := vsixIgnoreList(fsys)
+	if err != nil {
+		return nil, nil, o.Err(err)
+	}
+	files, err := vsixFiles(fsys, il)
+	if err != nil {
+		return nil, nil, o.Annotatef(err, "failed to list extension files")
+	}
+	if err := validateVSIXFiles(fsys, files, p, defs.Media, scriptOutputs(defs.Scripts, prepublishScriptName)); err != nil {
+		return nil, nil, o.Err(err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeVSIX(&buf, fsys, p, files); err != nil {
+		return nil, nil, o.Err(err)
+	}
+	return p, buf.Bytes(), nil
+}
+
+// vsix packages the extension into groog-<version>.vsix in the repo root.
+func (c *cli) vsix(o command.Output, d *command.Data) error {
+	p, b, err := c.buildVSIX(o, d)
+	if err != nil {
+		return err
+	}
+
+	filename := filepath.Join(filepath.Dir(filepath.Dir(runtimeNode.Get(d))), fmt.Sprintf("%s-%s.vsix", p.Name, p.Version))
+	if err := os.WriteFile(filename, b, 0644); err != nil {
+		return o.Annotatef(err, "failed to write %s", filename)
+	}
+	o.Stdoutf("Successfully packaged %s\n", filename)
+	return nil
+}
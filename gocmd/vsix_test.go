@@ -0,0 +1,465 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestIgnoreList(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		patterns []string
+		path     string
+		want     bool
+	}{
+		{
+			name: "no patterns",
+			path: "src/extension.ts",
+		},
+		{
+			name:     "exact file",
+			patterns: []string{".gitignore"},
+			path:     ".gitignore",
+			want:     true,
+		},
+		{
+			name:     "exact file only matches from the root",
+			patterns: []string{".gitignore"},
+			path:     "src/.gitignore",
+		},
+		{
+			name:     "leading slash",
+			patterns: []string{"/.gitignore"},
+			path:     ".gitignore",
+			want:     true,
+		},
+		{
+			name:     "directory contents",
+			patterns: []string{"src/**"},
+			path:     "src/a/b.ts",
+			want:     true,
+		},
+		{
+			name:     "directory contents matches the directory",
+			patterns: []string{"src/**"},
+			path:     "src",
+			want:     true,
+		},
+		{
+			name:     "directory contents doesn't match prefixed directories",
+			patterns: []string{"src/**"},
+			path:     "srcs/a.ts",
+		},
+		{
+			name:     "trailing slash",
+			patterns: []string{"src/"},
+			path:     "src/a.ts",
+			want:     true,
+		},
+		{
+			name:     "directory name matches its contents",
+			patterns: []string{"src"},
+			path:     "src/a.ts",
+			want:     true,
+		},
+		{
+			name:     "any directory",
+			patterns: []string{"**/tsconfig.json"},
+			path:     "a/b/tsconfig.json",
+			want:     true,
+		},
+		{
+			name:     "any directory matches the root",
+			patterns: []string{"**/tsconfig.json"},
+			path:     "tsconfig.json",
+			want:     true,
+		},
+		{
+			name:     "star",
+			patterns: []string{"**/*.map"},
+			path:     "out/extension.js.map",
+			want:     true,
+		},
+		{
+			name:     "star doesn't match other extensions",
+			patterns: []string{"**/*.map"},
+			path:     "out/extension.js",
+		},
+		{
+			name:     "star doesn't cross directories",
+			patterns: []string{"out/*.js"},
+			path:     "out/a/b.js",
+		},
+		{
+			name:     "question mark",
+			patterns: []string{"out/?.js"},
+			path:     "out/a.js",
+			want:     true,
+		},
+		{
+			name:     "regexp characters are literal",
+			patterns: []string{"a+b.js"},
+			path:     "aab.js",
+		},
+		{
+			name:     "negation",
+			patterns: []string{"node_modules/**", "!node_modules/await-lock/**"},
+			path:     "node_modules/await-lock/index.js",
+		},
+		{
+			name:     "negation only applies to matches",
+			patterns: []string{"node_modules/**", "!node_modules/await-lock/**"},
+			path:     "node_modules/mocha/index.js",
+			want:     true,
+		},
+		{
+			name:     "later patterns take precedence",
+			patterns: []string{"!node_modules/await-lock/**", "node_modules/**"},
+			path:     "node_modules/await-lock/index.js",
+			want:     true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			il, err := newIgnoreList(test.patterns...)
+			if err != nil {
+				t.Fatalf("newIgnoreList(%v) returned error: %v", test.patterns, err)
+			}
+			if got := il.ignored(test.path); got != test.want {
+				t.Errorf("ignoreList(%v).ignored(%q) returned %v; want %v", test.patterns, test.path, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseIgnoreFile(t *testing.T) {
+	want := []string{".vscode/**", "src/**", "**/*.ts"}
+	got := parseIgnoreFile("# comment\n.vscode/**\n\nsrc/**\r\n  **/*.ts  \n")
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("parseIgnoreFile() returned incorrect patterns (-want, +got):\n%s", diff)
+	}
+}
+
+func TestLockDependencyPatterns(t *testing.T) {
+	lock := `{
+  "name": "groog",
+  "packages": {
+    "": {"name": "groog"},
+    "node_modules/await-lock": {"version": "2.2.2"},
+    "node_modules/mocha": {"version": "10.2.0", "dev": true},
+    "node_modules/@scope/pkg": {"version": "1.0.0"}
+  }
+}`
+	want := []string{"!node_modules/@scope/pkg/**", "!node_modules/await-lock/**"}
+	got, err := lockDependencyPatterns([]byte(lock))
+	if err != nil {
+		t.Fatalf("lockDependencyPatterns() returned error: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("lockDependencyPatterns() returned incorrect patterns (-want, +got):\n%s", diff)
+	}
+}
+
+func testExtensionFS() fstest.MapFS {
+	return fstest.MapFS{
+		".vscodeignore":                {Data: []byte("src/**\n**/*.map\n")},
+		".git/HEAD":                    {Data: []byte("ref: refs/heads/main")},
+		"CHANGELOG.md":                 {Data: []byte("# Changelog")},
+		"LICENSE.md":                   {Data: []byte("license")},
+		"gocmd/main.go":                {Data: []byte("package main")},
+		"media/find-gutter-icon.jpg":   {Data: []byte("jpg")},
+		"node_modules/await-lock/a.js": {Data: []byte("lock")},
+		"node_modules/mocha/mocha.js":  {Data: []byte("mocha")},
+		"out/extension.js":             {Data: []byte("js")},
+		"out/extension.js.map":         {Data: []byte("map")},
+		"package-lock.json": {Data: []byte(`{"packages": {
+			"": {},
+			"node_modules/await-lock": {},
+			"node_modules/mocha": {"dev": true}
+		}}`)},
+		"package.json":     {Data: []byte("{}")},
+		"snippets/go.json": {Data: []byte("{}")},
+		"src/extension.ts": {Data: []byte("ts")},
+		"groog-1.0.0.vsix": {Data: []byte("zip")},
+	}
+}
+
+func testExtensionPackage() *Package {
+	return &Package{
+		Name:        "groog",
+		DisplayName: "groog",
+		Description: "Keys & more",
+		Version:     "2.6.3",
+		Publisher:   "groogle",
+		Main:        "./out/extension.js",
+		Engines:     map[string]string{"vscode": "^1.81.0"},
+		Repository:  &Repository{"git", "https://github.com/leep-frog/vs-extension"},
+		Categories:  []string{"Other"},
+		Contributes: &Contribution{
+			Snipppets: []*Snippet{{"snippets/go.json", "go"}},
+		},
+	}
+}
+
+func TestVSIXFiles(t *testing.T) {
+	fsys := testExtensionFS()
+	il, err := vsixIgnoreList(fsys)
+	if err != nil {
+		t.Fatalf("vsixIgnoreList() returned error: %v", err)
+	}
+	got, err := vsixFiles(fsys, il)
+	if err != nil {
+		t.Fatalf("vsixFiles() returned error: %v", err)
+	}
+	want := []string{
+		"CHANGELOG.md",
+		"LICENSE.md",
+		"media/find-gutter-icon.jpg",
+		"node_modules/await-lock/a.js",
+		"out/extension.js",
+		"package-lock.json",
+		"snippets/go.json",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("vsixFiles() returned incorrect files (-want, +got):\n%s", diff)
+	}
+}
+
+func TestValidateVSIXFiles(t *testing.T) {
+	fsys := testExtensionFS()
+	files := []string{"media/find-gutter-icon.jpg", "out/extension.js", "snippets/go.json"}
+	for _, test := range []struct {
+		name    string
+		files   []string
+		p       *Package
+		media   []string
+		outputs []*scriptOutput
+		wantErr string
+	}{
+		{
+			name:  "valid",
+			files: files,
+			p:     testExtensionPackage(),
+			media: []string{"media/find-gutter-icon.jpg"},
+		},
+		{
+			name:  "missing files",
+			files: files,
+			p: func() *Package {
+				p := testExtensionPackage()
+				p.Main = "./dist/extension.js"
+				p.Contributes.Snipppets = append(p.Contributes.Snipppets, &Snippet{"snippets/java.json", "java"})
+				return p
+			}(),
+			media: []string{"media/mark-gutter-icon.jpg"},
+			wantErr: `invalid VSIX contents:
+main file "./dist/extension.js" does not exist
+snippet file "snippets/java.json" does not exist
+media file "media/mark-gutter-icon.jpg" does not exist`,
+		},
+		{
+			name:  "prepublish outputs",
+			files: files,
+			p:     testExtensionPackage(),
+			outputs: []*scriptOutput{
+				{"tsc", "out/"},
+				{"esbuild", "out/extension.js"},
+				{"esbuild", "dist/extension.js"},
+			},
+			wantErr: `invalid VSIX contents:
+build output file "dist/extension.js" does not exist (run ` + "`npm run vscode:prepublish`" + `)`,
+		},
+		{
+			name:  "ignored files",
+			files: []string{"media/find-gutter-icon.jpg"},
+			p:     testExtensionPackage(),
+			wantErr: `invalid VSIX contents:
+main file "./out/extension.js" is excluded by the ignore list
+snippet file "snippets/go.json" is excluded by the ignore list`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var gotErr string
+			if err := validateVSIXFiles(fsys, test.files, test.p, test.media, test.outputs); err != nil {
+				gotErr = err.Error()
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr); diff != "" {
+				t.Errorf("validateVSIXFiles() returned incorrect error (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestVSIXManifest(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		p     *Package
+		files []string
+		want  string
+	}{
+		{
+			name: "release",
+			p: func() *Package {
+				p := testExtensionPackage()
+				p.ExtensionDependencies = []string{"golang.go", "groogle.faves"}
+				return p
+			}(),
+			files: []string{"CHANGELOG.md", "LICENSE.md", "out/extension.js"},
+			want: `<?xml version="1.0" encoding="UTF-8"?>
+<PackageManifest Version="2.0.0" xmlns="http://schemas.microsoft.com/developer/vsx-schema/2011" xmlns:d="http://schemas.microsoft.com/developer/vsx-schema-design/2011">
+	<Metadata>
+		<Identity Language="en-US" Id="groog" Version="2.6.3" Publisher="groogle"></Identity>
+		<DisplayName>groog</DisplayName>
+		<Description xml:space="preserve">Keys &amp; more</Description>
+		<Categories>Other</Categories>
+		<GalleryFlags>Public</GalleryFlags>
+		<Properties>
+			<Property Id="Microsoft.VisualStudio.Code.Engine" Value="^1.81.0"></Property>
+			<Property Id="Microsoft.VisualStudio.Code.ExtensionDependencies" Value="golang.go,groogle.faves"></Property>
+			<Property Id="Microsoft.VisualStudio.Code.ExtensionPack" Value=""></Property>
+			<Property Id="Microsoft.VisualStudio.Code.ExtensionKind" Value="workspace"></Property>
+			<Property Id="Microsoft.VisualStudio.Services.Links.Source" Value="https://github.com/leep-frog/vs-extension"></Property>
+		</Properties>
+	</Metadata>
+	<Installation>
+		<InstallationTarget Id="Microsoft.VisualStudio.Code"></InstallationTarget>
+	</Installation>
+	<Dependencies></Dependencies>
+	<Assets>
+		<Asset Type="Microsoft.VisualStudio.Code.Manifest" Path="extension/package.json" Addressable="true"></Asset>
+		<Asset Type="Microsoft.VisualStudio.Services.Content.Changelog" Path="extension/CHANGELOG.md" Addressable="true"></Asset>
+		<Asset Type="Microsoft.VisualStudio.Services.Content.License" Path="extension/LICENSE.md" Addressable="true"></Asset>
+	</Assets>
+</PackageManifest>`,
+		},
+		{
+			name: "pre-release",
+			p: func() *Package {
+				p := testExtensionPackage()
+				p.Version = "2.7.0"
+				p.Repository = nil
+				return p
+			}(),
+			want: `<?xml version="1.0" encoding="UTF-8"?>
+<PackageManifest Version="2.0.0" xmlns="http://schemas.microsoft.com/developer/vsx-schema/2011" xmlns:d="http://schemas.microsoft.com/developer/vsx-schema-design/2011">
+	<Metadata>
+		<Identity Language="en-US" Id="groog" Version="2.7.0" Publisher="groogle"></Identity>
+		<DisplayName>groog</DisplayName>
+		<Description xml:space="preserve">Keys &amp; more</Description>
+		<Categories>Other</Categories>
+		<GalleryFlags>Public</GalleryFlags>
+		<Properties>
+			<Property Id="Microsoft.VisualStudio.Code.Engine" Value="^1.81.0"></Property>
+			<Property Id="Microsoft.VisualStudio.Code.ExtensionDependencies" Value=""></Property>
+			<Property Id="Microsoft.VisualStudio.Code.ExtensionPack" Value=""></Property>
+			<Property Id="Microsoft.VisualStudio.Code.ExtensionKind" Value="workspace"></Property>
+			<Property Id="Microsoft.VisualStudio.Code.PreRelease" Value="true"></Property>
+		</Properties>
+	</Metadata>
+	<Installation>
+		<InstallationTarget Id="Microsoft.VisualStudio.Code"></InstallationTarget>
+	</Installation>
+	<Dependencies></Dependencies>
+	<Assets>
+		<Asset Type="Microsoft.VisualStudio.Code.Manifest" Path="extension/package.json" Addressable="true"></Asset>
+	</Assets>
+</PackageManifest>`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := vsixManifest(test.p, test.files)
+			if err != nil {
+				t.Fatalf("vsixManifest() returned error: %v", err)
+			}
+			if diff := cmp.Diff(test.want, string(got)); diff != "" {
+				t.Errorf("vsixManifest() returned incorrect value (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteVSIX(t *testing.T) {
+	fsys := testExtensionFS()
+	p := testExtensionPackage()
+	files := []string{"media/find-gutter-icon.jpg", "out/extension.js", "snippets/go.json"}
+
+	var buf bytes.Buffer
+	if err := writeVSIX(&buf, fsys, p, files); err != nil {
+		t.Fatalf("writeVSIX() returned error: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("failed to read VSIX: %v", err)
+	}
+	got := map[string]string{}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", f.Name, err)
+		}
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", f.Name, err)
+		}
+		got[f.Name] = string(b)
+	}
+
+	wantNames := []string{
+		"[Content_Types].xml",
+		"extension.vsixmanifest",
+		"extension/media/find-gutter-icon.jpg",
+		"extension/out/extension.js",
+		"extension/package.json",
+		"extension/snippets/go.json",
+	}
+	if diff := cmp.Diff(wantNames, names); diff != "" {
+		t.Errorf("writeVSIX() wrote incorrect files (-want, +got):\n%s", diff)
+	}
+
+	wantContentTypes := `<?xml version="1.0" encoding="UTF-8"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+	<Default Extension=".jpg" ContentType="image/jpeg"></Default>
+	<Default Extension=".js" ContentType="application/javascript"></Default>
+	<Default Extension=".json" ContentType="application/json"></Default>
+	<Default Extension=".vsixmanifest" ContentType="text/xml"></Default>
+</Types>`
+	if diff := cmp.Diff(wantContentTypes, got["[Content_Types].xml"]); diff != "" {
+		t.Errorf("writeVSIX() wrote incorrect [Content_Types].xml (-want, +got):\n%s", diff)
+	}
+
+	wantPackage, err := marshalJson(p)
+	if err != nil {
+		t.Fatalf("marshalJson() returned error: %v", err)
+	}
+	if diff := cmp.Diff(string(wantPackage), got["extension/package.json"]); diff != "" {
+		t.Errorf("writeVSIX() wrote incorrect package.json (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("js", got["extension/out/extension.js"]); diff != "" {
+		t.Errorf("writeVSIX() wrote incorrect extension.js (-want, +got):\n%s", diff)
+	}
+}
+
+func TestGroogFilesExist(t *testing.T) {
+	// The built JS isn't checked in, so only check the media and snippets.
+	fsys := os.DirFS("..")
+	var paths []string
+	paths = append(paths, groogMedia()...)
+	for _, s := range groogSnippets() {
+		paths = append(paths, s.Path)
+	}
+	for _, p := range paths {
+		if _, err := fs.Stat(fsys, p); err != nil {
+			t.Errorf("groog file %q does not exist: %v", p, err)
+		}
+	}
+}
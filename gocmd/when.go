@@ -0,0 +1,548 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/exp/slices"
+)
+
+// When clauses are built with the WhenContext DSL (and sometimes written by
+// hand), so every emitted clause is parsed and its context keys are checked
+// against a registry of the keys that VS Code (and groog) actually set.
+
+// ContextType is the type of a context key's value.
+type ContextType string
+
+const (
+	contextBool   ContextType = "bool"
+	contextString ContextType = "string"
+	contextNumber ContextType = "number"
+)
+
+// ContextKey is a context key that can be used in when clauses.
+type ContextKey struct {
+	Key  string
+	Type ContextType
+	// Since is the first VS Code version that sets the key (empty if it's
+	// been around longer than any supported engine).
+	Since string
+	// Excludes are the (bool) keys that are never true at the same time as
+	// this one.
+	Excludes []string
+}
+
+// whenExpr is a parsed when clause.
+type whenExpr interface {
+	// String returns the when clause for the expression.
+	String() string
+}
+
+// whenLiteral is the true or false constant.
+type whenLiteral bool
+
+// whenKey is true when the context key's value is truthy.
+type whenKey string
+
+// whenNot negates an expression.
+type whenNot struct {
+	X whenExpr
+}
+
+// whenAnd is true when all of its expressions are.
+type whenAnd []whenExpr
+
+// whenOr is true when any of its expressions are.
+type whenOr []whenExpr
+
+// whenCmp compares a context key to a value.
+type whenCmp struct {
+	Key   string
+	Op    string
+	Value *whenValue
+}
+
+// whenValue is the right side of a comparison.
+type whenValue struct {
+	// Raw is the value as written in the when clause.
+	Raw  string
+	Type ContextType
+	// Key is set if the value is a context key (only for the in operators).
+	Key bool
+}
+
+func (wl whenLiteral) String() string { return strconv.FormatBool(bool(wl)) }
+
+func (wk whenKey) String() string { return string(wk) }
+
+func (wn *whenNot) String() string {
+	switch wn.X.(type) {
+	case whenAnd, whenOr:
+		return fmt.Sprintf("!(%s)", wn.X)
+	}
+	return fmt.Sprintf("!%s", wn.X)
+}
+
+func (wa whenAnd) String() string {
+	var r []string
+	for _, x := range wa {
+		if _, ok := x.(whenOr); ok {
+			r = append(r, fmt.Sprintf("(%s)", x))
+		} else {
+			r = append(r, x.String())
+		}
+	}
+	return strings.Join(r, " && ")
+}
+
+func (wo whenOr) String() string {
+	var r []string
+	for _, x := range wo {
+		r = append(r, x.String())
+	}
+	return strings.Join(r, " || ")
+}
+
+func (wc *whenCmp) String() string {
+	return fmt.Sprintf("%s %s %s", wc.Key, wc.Op, wc.Value.Raw)
+}
+
+var (
+	whenComparisonOps = []string{"==", "!=", "=~", "<=", ">=", "<", ">"}
+	whenNumberRegex   = regexp.MustCompile(`^-?[0-9]+(?:\.[0-9]+)?$`)
+	// VS Code allows most characters in unquoted values (e.g. file paths).
+	whenIdentifierRegex = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$.:\-/]*`)
+)
+
+// whenParser is a recursive descent parser for when clauses (see
+// https://code.visualstudio.com/api/references/when-clause-contexts).
+type whenParser struct {
+	s   string
+	pos int
+}
+
+// parseWhen parses the when clause. An empty clause is always true.
+func parseWhen(s string) (whenExpr, error) {
+	wp := &whenParser{s: s}
+	if wp.skipSpace(); wp.done() {
+		return whenLiteral(true), nil
+	}
+	e, err := wp.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if wp.skipSpace(); !wp.done() {
+		return nil, wp.errorf("unexpected %q", wp.s[wp.pos:])
+	}
+	return e, nil
+}
+
+func (wp *whenParser) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("column %d: %s", wp.pos+1, fmt.Sprintf(format, a...))
+}
+
+func (wp *whenParser) done() bool {
+	return wp.pos >= len(wp.s)
+}
+
+func (wp *whenParser) skipSpace() {
+	for !wp.done() && unicode.IsSpace(rune(wp.s[wp.pos])) {
+		wp.pos++
+	}
+}
+
+// consume skips the token if it's next.
+func (wp *whenParser) consume(token string) bool {
+	wp.skipSpace()
+	if strings.HasPrefix(wp.s[wp.pos:], token) {
+		wp.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (wp *whenParser) parseOr() (whenExpr, error) {
+	var or whenOr
+	for {
+		e, err := wp.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		or = append(or, e)
+		if !wp.consume("||") {
+			break
+		}
+	}
+	if len(or) == 1 {
+		return or[0], nil
+	}
+	return or, nil
+}
+
+func (wp *whenParser) parseAnd() (whenExpr, error) {
+	var and whenAnd
+	for {
+		e, err := wp.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		and = append(and, e)
+		if !wp.consume("&&") {
+			break
+		}
+	}
+	if len(and) == 1 {
+		return and[0], nil
+	}
+	return and, nil
+}
+
+func (wp *whenParser) parseUnary() (whenExpr, error) {
+	// Don't mistake != for a negation
+	if wp.skipSpace(); strings.HasPrefix(wp.s[wp.pos:], "!") && !strings.HasPrefix(wp.s[wp.pos:], "!=") {
+		wp.pos++
+		e, err := wp.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &whenNot{e}, nil
+	}
+	return wp.parsePrimary()
+}
+
+func (wp *whenParser) parsePrimary() (whenExpr, error) {
+	if wp.consume("(") {
+		e, err := wp.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !wp.consume(")") {
+			return nil, wp.errorf("missing closing parenthesis")
+		}
+		return e, nil
+	}
+
+	key := wp.identifier()
+	switch key {
+	case "":
+		if wp.done() {
+			return nil, wp.errorf("unexpected end of when clause")
+		}
+		return nil, wp.errorf("unexpected %q", wp.s[wp.pos:])
+	case "true", "false":
+		return whenLiteral(key == "true"), nil
+	}
+
+	for _, op := range whenComparisonOps {
+		if wp.consume(op) {
+			v, err := wp.value(op)
+			if err != nil {
+				return nil, err
+			}
+			return &whenCmp{key, op, v}, nil
+		}
+	}
+	for _, op := range []string{"not in", "in"} {
+		start := wp.pos
+		if wp.consume(op) && (wp.done() || unicode.IsSpace(rune(wp.s[wp.pos]))) {
+			wp.skipSpace()
+			k := wp.identifier()
+			if k == "" {
+				return nil, wp.errorf("expected a context key after %q", op)
+			}
+			return &whenCmp{key, op, &whenValue{Raw: k, Key: true}}, nil
+		}
+		wp.pos = start
+	}
+	return whenKey(key), nil
+}
+
+func (wp *whenParser) identifier() string {
+	wp.skipSpace()
+	id := whenIdentifierRegex.FindString(wp.s[wp.pos:])
+	wp.pos += len(id)
+	return id
+}
+
+// value parses the right side of the comparison operator.
+func (wp *whenParser) value(op string) (*whenValue, error) {
+	wp.skipSpace()
+	rest := wp.s[wp.pos:]
+	if rest == "" {
+		return nil, wp.errorf("expected a value after %q", op)
+	}
+
+	switch {
+	case op == "=~":
+		// Regular expression literal (/.../flags)
+		if rest[0] != '/' {
+			return nil, wp.errorf("expected a regular expression after %q", op)
+		}
+		for i := 1; i < len(rest); i++ {
+			if rest[i] == '\\' {
+				i++
+				continue
+			}
+			if rest[i] == '/' {
+				end := i + 1
+				for end < len(rest) && unicode.IsLetter(rune(rest[end])) {
+					end++
+				}
+				wp.pos += end
+				return &whenValue{Raw: rest[:end], Type: contextString}, nil
+			}
+		}
+		return nil, wp.errorf("unterminated regular expression")
+	case rest[0] == '\'' || rest[0] == '"':
+		for i := 1; i < len(rest); i++ {
+			if rest[i] == '\\' {
+				i++
+				continue
+			}
+			if rest[i] == rest[0] {
+				wp.pos += i + 1
+				return &whenValue{Raw: rest[:i+1], Type: contextString}, nil
+			}
+		}
+		return nil, wp.errorf("unterminated string")
+	}
+
+	// Unquoted values run until the next space, parenthesis, or operator.
+	end := strings.IndexFunc(rest, func(r rune) bool {
+		return unicode.IsSpace(r) || r == ')' || r == '&' || r == '|'
+	})
+	if end < 0 {
+		end = len(rest)
+	}
+	raw := rest[:end]
+	if raw == "" {
+		return nil, wp.errorf("expected a value after %q", op)
+	}
+	wp.pos += end
+
+	t := contextString
+	if raw == "true" || raw == "false" {
+		t = contextBool
+	} else if whenNumberRegex.MatchString(raw) {
+		t = contextNumber
+	}
+	return &whenValue{Raw: raw, Type: t}, nil
+}
+
+// whenKeys calls f for every context key used in the expression.
+func whenKeys(e whenExpr, f func(key string)) {
+	switch e := e.(type) {
+	case whenKey:
+		f(string(e))
+	case *whenNot:
+		whenKeys(e.X, f)
+	case whenAnd:
+		for _, x := range e {
+			whenKeys(x, f)
+		}
+	case whenOr:
+		for _, x := range e {
+			whenKeys(x, f)
+		}
+	case *whenCmp:
+		f(e.Key)
+		if e.Value.Key {
+			f(e.Value.Raw)
+		}
+	}
+}
+
+// whenNegations calls f for the expression of every negation in the
+// expression.
+func whenNegations(e whenExpr, f func(x whenExpr)) {
+	switch e := e.(type) {
+	case *whenNot:
+		f(e.X)
+		whenNegations(e.X, f)
+	case whenAnd:
+		for _, x := range e {
+			whenNegations(x, f)
+		}
+	case whenOr:
+		for _, x := range e {
+			whenNegations(x, f)
+		}
+	}
+}
+
+// whenComparisons calls f for every comparison in the expression.
+func whenComparisons(e whenExpr, f func(c *whenCmp)) {
+	switch e := e.(type) {
+	case *whenNot:
+		whenComparisons(e.X, f)
+	case whenAnd:
+		for _, x := range e {
+			whenComparisons(x, f)
+		}
+	case whenOr:
+		for _, x := range e {
+			whenComparisons(x, f)
+		}
+	case *whenCmp:
+		f(e)
+	}
+}
+
+// checkWhen verifies that the when clause only uses known context keys (that
+// exist in the engine's version) and compares them to values of the right type.
+// Problems are reported at loc.
+func checkWhen(ds *Diagnostics, loc Location, keys map[string]*ContextKey, engine *Version, when string) {
+	e, err := parseWhen(when)
+	if err != nil {
+		ds.ErrorAt(loc, "failed to parse when clause %q: %v", when, err)
+		return
+	}
+
+	whenNegations(e, func(x whenExpr) {
+		switch x.(type) {
+		case whenKey, *whenCmp, whenLiteral:
+		default:
+			ds.ErrorAt(loc, "Can only negate a single when context (%q) in when clause %q", x, when)
+		}
+	})
+
+	whenKeys(e, func(key string) {
+		ck, ok := keys[key]
+		if !ok {
+			ds.ErrorAt(loc, "unknown context key %q in when clause %q", key, when)
+			return
+		}
+		if ck.Since == "" || engine == nil {
+			return
+		}
+		if since, err := parseVersion(ck.Since); err != nil {
+			ds.ErrorAt(loc, "context key %q has an invalid version (%q): %v", key, ck.Since, err)
+		} else if since.Compare(engine) > 0 {
+			ds.WarnAt(loc, "context key %q in when clause %q requires VS Code %s", key, when, ck.Since)
+		}
+	})
+
+	whenComparisons(e, func(c *whenCmp) {
+		ck, ok := keys[c.Key]
+		if !ok {
+			// Already reported above
+			return
+		}
+		var want ContextType
+		switch c.Op {
+		case "in", "not in":
+			return
+		case "=~":
+			want = contextString
+		case "<", "<=", ">", ">=":
+			want = contextNumber
+			if c.Value.Type != contextNumber {
+				ds.ErrorAt(loc, "%s requires a number in when clause %q (%s)", c.Op, when, c)
+				return
+			}
+		default:
+			want = c.Value.Type
+			// Unquoted values are strings unless compared to another type.
+			if ck.Type == contextString {
+				want = contextString
+			}
+		}
+		if ck.Type != want {
+			ds.ErrorAt(loc, "context key %q is a %s, but is compared to a %s in when clause %q (%s)", c.Key, ck.Type, want, when, c)
+		}
+	})
+}
+
+// checkWhenClauses checks every when clause in the keybindings. Problems are
+// reported at the binding's definition.
+func checkWhenClauses(ds *Diagnostics, contexts []*ContextKey, p *Package, kbs []*Keybinding) {
+	keys := map[string]*ContextKey{}
+	for _, ck := range contexts {
+		keys[ck.Key] = ck
+	}
+	engine, err := minVersion(p.Engines["vscode"])
+	if err != nil {
+		engine = nil
+	}
+
+	// Each definition is only checked once (rather than once per key alias).
+	type whenLocation struct {
+		when string
+		loc  Location
+	}
+	checked := map[whenLocation]bool{}
+	for _, kb := range kbs {
+		if wl := (whenLocation{kb.When, kb.Location}); !checked[wl] {
+			checked[wl] = true
+			checkWhen(ds, kb.Location, keys, engine, kb.When)
+		}
+	}
+}
+
+func groogContextKeys() []*ContextKey {
+	var keys []*ContextKey
+	add := func(t ContextType, since string, names ...string) {
+		for _, name := range names {
+			keys = append(keys, &ContextKey{Key: name, Type: t, Since: since})
+		}
+	}
+	// exclusive marks the keys as never being true at the same time.
+	exclusive := func(names ...string) {
+		for _, ck := range keys {
+			if slices.Contains(names, ck.Key) {
+				for _, name := range names {
+					if name != ck.Key && !slices.Contains(ck.Excludes, name) {
+						ck.Excludes = append(ck.Excludes, name)
+					}
+				}
+			}
+		}
+	}
+
+	add(contextBool, "",
+		"editorFocus",
+		"editorTextFocus",
+		"filesExplorerFocus",
+		"findInputFocussed",
+		"findWidgetVisible",
+		"inputFocus",
+		"inQuickOpen",
+		"inSnippetMode",
+		"listFocus",
+		"panelFocus",
+		"searchInputBoxFocus",
+		"searchViewletFocus",
+		"sideBarFocus",
+		"suggestWidgetVisible",
+		"terminalFocus",
+		"textInputFocus",
+	)
+	add(contextBool, "1.22.0", "listSupportsMultiselect")
+	add(contextBool, "1.43.0", "inSearchEditor")
+	// The terminal became a view (and so got a visibility key) when views
+	// could be moved between containers.
+	add(contextBool, "1.46.0", "view.terminal.visible")
+	add(contextString, "",
+		"activePanel",
+		"editorLangId",
+		"resourceExtname",
+		"resourceLangId",
+	)
+
+	for _, mode := range groogModes() {
+		add(contextBool, "", groogContext(mode.Name))
+	}
+
+	// Focus can only be in one place (but the editor and panel keys are also
+	// set when focus is in one of their widgets, so they're in separate
+	// groups).
+	exclusive("editorTextFocus", "findInputFocussed", "inQuickOpen", "searchViewletFocus", "terminalFocus")
+	exclusive("editorTextFocus", "findInputFocussed", "inQuickOpen", "searchInputBoxFocus", "terminalFocus")
+	exclusive("editorFocus", "inQuickOpen", "searchViewletFocus", "terminalFocus")
+	exclusive("inSearchEditor", "inQuickOpen", "searchViewletFocus", "terminalFocus")
+	exclusive("editorTextFocus", "panelFocus", "sideBarFocus")
+	return keys
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// When clauses built by chaining WhenContexts often contain redundant (or
+// contradictory) terms, so each clause is minimized (with the Quine-McCluskey
+// algorithm) before it's emitted. Every key and comparison in a clause is a
+// variable, so clauses with many of them are left as is.
+
+const (
+	// maxWhenVariables is the number of variables above which clauses aren't
+	// simplified (the truth table has 2^n rows).
+	maxWhenVariables = 12
+)
+
+// whenAtom is a variable in a when clause.
+type whenAtom struct {
+	// id identifies equivalent atoms (e.g. `a == 'b'` and `a == b`).
+	id string
+	// pos and neg are the when clauses for the atom and its negation.
+	pos, neg string
+	// eqKey and eqValue are set for equality comparisons (a key can only
+	// equal one value at a time).
+	eqKey, eqValue string
+}
+
+// unquote returns the value without its quotes.
+func (wv *whenValue) unquote() string {
+	if len(wv.Raw) >= 2 && (wv.Raw[0] == '\'' || wv.Raw[0] == '"') && wv.Raw[len(wv.Raw)-1] == wv.Raw[0] {
+		return wv.Raw[1 : len(wv.Raw)-1]
+	}
+	return wv.Raw
+}
+
+// whenVariables collects the atoms in a when clause.
+type whenVariables struct {
+	atoms []*whenAtom
+	ids   map[string]int
+	// excludes are the pairs of keys that are never true at the same time.
+	excludes map[[2]string]bool
+}
+
+// atom returns the index of the atom for the expression (which must be a
+// whenKey or *whenCmp) and whether the expression is the atom's negation.
+func (wv *whenVariables) atom(e whenExpr) (int, bool) {
+	var a *whenAtom
+	negated := false
+	switch e := e.(type) {
+	case whenKey:
+		a = &whenAtom{id: string(e), pos: string(e), neg: "!" + string(e)}
+	case *whenCmp:
+		op, v := e.Op, e.Value.unquote()
+		switch op {
+		case "!=":
+			op, negated = "==", true
+		case "not in":
+			op, negated = "in", true
+		}
+		pos := fmt.Sprintf("%s %s %s", e.Key, op, e.Value.Raw)
+		a = &whenAtom{id: fmt.Sprintf("%s %s %s", e.Key, op, v), pos: pos, neg: fmt.Sprintf("!(%s)", pos)}
+		switch op {
+		case "==":
+			a.neg = fmt.Sprintf("%s != %s", e.Key, e.Value.Raw)
+			if e.Value.Type != contextBool {
+				a.eqKey, a.eqValue = e.Key, v
+			}
+		case "in":
+			a.neg = fmt.Sprintf("%s not in %s", e.Key, e.Value.Raw)
+		}
+	}
+
+	if i, ok := wv.ids[a.id]; ok {
+		return i, negated
+	}
+	wv.ids[a.id] = len(wv.atoms)
+	wv.atoms = append(wv.atoms, a)
+	return len(wv.atoms) - 1, negated
+}
+
+// collect adds every atom in the expression.
+func (wv *whenVariables) collect(e whenExpr) {
+	switch e := e.(type) {
+	case whenKey, *whenCmp:
+		wv.atom(e)
+	case *whenNot:
+		wv.collect(e.X)
+	case whenAnd:
+		for _, x := range e {
+			wv.collect(x)
+		}
+	case whenOr:
+		for _, x := range e {
+			wv.collect(x)
+		}
+	}
+}
+
+// eval returns the value of the expression when the atoms are set to the
+// bits in row.
+func (wv *whenVariables) eval(e whenExpr, row uint) bool {
+	switch e := e.(type) {
+	case whenLiteral:
+		return bool(e)
+	case whenKey, *whenCmp:
+		i, negated := wv.atom(e)
+		return (row>>i&1 == 1) != negated
+	case *whenNot:
+		return !wv.eval(e.X, row)
+	case whenAnd:
+		for _, x := range e {
+			if !wv.eval(x, row) {
+				return false
+			}
+		}
+		return true
+	case whenOr:
+		for _, x := range e {
+			if wv.eval(x, row) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// possible returns whether the row is a possible assignment (a key can't
+// equal two different values, and excluded keys can't both be true).
+func (wv *whenVariables) possible(row uint) bool {
+	for i, a := range wv.atoms {
+		if row>>i&1 == 0 {
+			continue
+		}
+		for j := i + 1; j < len(wv.atoms); j++ {
+			b := wv.atoms[j]
+			if row>>j&1 == 0 {
+				continue
+			}
+			if a.eqKey != "" && b.eqKey == a.eqKey && b.eqValue != a.eqValue {
+				return false
+			}
+			if wv.excludes[[2]string{a.id, b.id}] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// implicant is a product term. Bits set in mask are variables that aren't
+// part of the term; the rest must equal the bits in value.
+type implicant struct {
+	value, mask uint
+}
+
+func (im implicant) covers(row uint) bool {
+	return row&^im.mask == im.value&^im.mask
+}
+
+// literals returns the number of variables in the term.
+func (im implicant) literals(n int) int {
+	return n - bits.OnesCount(im.mask&(1<<n-1))
+}
+
+// primeImplicants returns the prime implicants of the function that's true
+// for the minterms (and may be anything for the don't-cares).
+func primeImplicants(minterms, dontCares []uint) []implicant {
+	current := map[implicant]bool{}
+	for _, m := range append(append([]uint{}, minterms...), dontCares...) {
+		current[implicant{m, 0}] = true
+	}
+
+	var primes []implicant
+	for len(current) > 0 {
+		next := map[implicant]bool{}
+		combined := map[implicant]bool{}
+		var ims []implicant
+		for im := range current {
+			ims = append(ims, im)
+		}
+		for i, a := range ims {
+			for _, b := range ims[i+1:] {
+				diff := a.value ^ b.value
+				if a.mask != b.mask || bits.OnesCount(diff&^a.mask) != 1 {
+					continue
+				}
+				next[implicant{a.value &^ diff, a.mask | diff}] = true
+				combined[a], combined[b] = true, true
+			}
+		}
+		for _, im := range ims {
+			if !combined[im] {
+				primes = append(primes, implicant{im.value &^ im.mask, im.mask})
+			}
+		}
+		current = next
+	}
+
+	// Only keep primes that are needed for a minterm.
+	primes = slices.DeleteFunc(primes, func(im implicant) bool {
+		return !slices.ContainsFunc(minterms, im.covers)
+	})
+	sortFunc(primes, func(a, b implicant) bool {
+		if a.mask != b.mask {
+			return a.mask > b.mask
+		}
+		return a.value < b.value
+	})
+	return slices.Compact(primes)
+}
+
+// minimalCover returns the smallest set of primes (fewest terms, then fewest
+// literals) that covers the minterms.
+func minimalCover(primes []implicant, minterms []uint, n int) []implicant {
+	// Essential primes are the only ones covering some minterm.
+	var cover []implicant
+	for _, m := range minterms {
+		var only []implicant
+		for _, p := range primes {
+			if p.covers(m) {
+				only = append(only, p)
+			}
+		}
+		if len(only) == 1 && !slices.Contains(cover, only[0]) {
+			cover = append(cover, only[0])
+		}
+	}
+
+	var remaining []uint
+	for _, m := range minterms {
+		if !slices.ContainsFunc(cover, func(p implicant) bool { return p.covers(m) }) {
+			remaining = append(remaining, m)
+		}
+	}
+	if len(remaining) == 0 {
+		return cover
+	}
+
+	var candidates []implicant
+	for _, p := range primes {
+		if !slices.Contains(cover, p) && slices.ContainsFunc(remaining, p.covers) {
+			candidates = append(candidates, p)
+		}
+	}
+
+	coversAll := func(ps []implicant) bool {
+		for _, m := range remaining {
+			if !slices.ContainsFunc(ps, func(p implicant) bool { return p.covers(m) }) {
+				return false
+			}
+		}
+		return true
+	}
+	cost := func(ps []implicant) (int, int) {
+		lits := 0
+		for _, p := range ps {
+			lits += p.literals(n)
+		}
+		return len(ps), lits
+	}
+
+	if len(candidates) > 16 {
+		// Too many to search exhaustively, so pick greedily.
+		for len(remaining) > 0 {
+			best, bestCount := implicant{}, 0
+			for _, p := range candidates {
+				if c := len(slices.DeleteFunc(slices.Clone(remaining), func(m uint) bool { return !p.covers(m) })); c > bestCount {
+					best, bestCount = p, c
+				}
+			}
+			cover = append(cover, best)
+			remaining = slices.DeleteFunc(remaining, best.covers)
+		}
+		return cover
+	}
+
+	var best []implicant
+	for subset := uint(1); subset < 1<<len(candidates); subset++ {
+		var ps []implicant
+		for i, p := range candidates {
+			if subset>>i&1 == 1 {
+				ps = append(ps, p)
+			}
+		}
+		if !coversAll(ps) {
+			continue
+		}
+		if best == nil {
+			best = ps
+			continue
+		}
+		terms, lits := cost(ps)
+		bestTerms, bestLits := cost(best)
+		if terms < bestTerms || terms == bestTerms && lits < bestLits {
+			best = ps
+		}
+	}
+	return append(cover, best...)
+}
+
+// sopString returns the when clause for the sum of products.
+func (wv *whenVariables) sopString(terms []implicant) string {
+	n := len(wv.atoms)
+	var r []string
+	for _, im := range terms {
+		var lits []string
+		for i := 0; i < n; i++ {
+			if im.mask>>i&1 == 1 {
+				continue
+			}
+			if im.value>>i&1 == 1 {
+				lits = append(lits, wv.atoms[i].pos)
+			} else {
+				lits = append(lits, wv.atoms[i].neg)
+			}
+		}
+		r = append(r, strings.Join(lits, " && "))
+	}
+	return strings.Join(r, " || ")
+}
+
+// simplifyWhen returns the shortest when clause equivalent to the provided
+// one, and an error if the clause can never be true.
+func simplifyWhen(when string) (string, error) {
+	e, err := parseWhen(when)
+	if err != nil {
+		// Reported by checkWhen
+		return when, nil
+	}
+
+	wv := &whenVariables{ids: map[string]int{}}
+	wv.collect(e)
+	n := len(wv.atoms)
+	if n > maxWhenVariables {
+		return when, nil
+	}
+
+	var minterms, dontCares []uint
+	possible := 0
+	for row := uint(0); row < 1<<n; row++ {
+		if !wv.possible(row) {
+			dontCares = append(dontCares, row)
+			continue
+		}
+		possible++
+		if wv.eval(e, row) {
+			minterms = append(minterms, row)
+		}
+	}
+
+	if len(minterms) == 0 {
+		return when, fmt.Errorf("when clause %q can never be true", when)
+	}
+	if len(minterms) == possible {
+		return "", nil
+	}
+
+	simplified := wv.sopString(minimalCover(primeImplicants(minterms, dontCares), minterms, n))
+	if original := e.String(); len(original) <= len(simplified) {
+		// The factored form can be shorter than the sum of products
+		// (e.g. `a && (b || c)`).
+		simplified = original
+	}
+	if len(when) <= len(simplified) {
+		return when, nil
+	}
+	return simplified, nil
+}
+
+// simplifyWhenClauses simplifies the when clause of every keybinding (except
+// for removals, whose when clause must match the binding being removed).
+// Clauses are only simplified once, but errors are reported for every binding
+// that uses the clause.
+func simplifyWhenClauses(ds *Diagnostics, kbs []*Keybinding) {
+	type result struct {
+		when string
+		err  error
+	}
+	simplified := map[string]*result{}
+	for _, kb := range kbs {
+		if strings.HasPrefix(kb.Command, "-") {
+			continue
+		}
+		r, ok := simplified[kb.When]
+		if !ok {
+			s, err := simplifyWhen(kb.When)
+			r = &result{s, err}
+			simplified[kb.When] = r
+		}
+		if r.err != nil {
+			ds.ErrorAt(kb.Location, "%v (bound to %s)", r.err, kb.Key)
+		}
+		kb.When = r.when
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestSimplifyWhen(t *testing.T) {
+	var many []string
+	for i := 0; i <= maxWhenVariables; i++ {
+		many = append(many, fmt.Sprintf("k%d && k%d", i, i))
+	}
+
+	for _, test := range []struct {
+		when    string
+		want    string
+		wantErr string
+	}{
+		{
+			when: "",
+			want: "",
+		},
+		{
+			when: "editorFocus",
+			want: "editorFocus",
+		},
+		{
+			when: "a && a",
+			want: "a",
+		},
+		{
+			when: "a && b || a && !b",
+			want: "a",
+		},
+		{
+			when: "a || !a && b",
+			want: "a || b",
+		},
+		{
+			when: "groog.context.qmkMode && !view.terminal.visible && inQuickOpen && groog.context.qmkMode && !view.terminal.visible",
+			want: "groog.context.qmkMode && !view.terminal.visible && inQuickOpen",
+		},
+		{
+			// The factored form is shorter than the sum of products.
+			when: "a && (b || c)",
+			want: "a && (b || c)",
+		},
+		{
+			when: "!(!a)",
+			want: "a",
+		},
+		{
+			when: "!(a || b)",
+			want: "!a && !b",
+		},
+		{
+			when: "a || !a",
+			want: "",
+		},
+		{
+			when: "resourceLangId == 'go' && resourceLangId != java",
+			want: "resourceLangId == 'go'",
+		},
+		{
+			when: "resourceLangId == go || resourceLangId != 'go' && a",
+			want: "resourceLangId == go || a",
+		},
+		{
+			when: "resourceFilename in files && !(resourceFilename not in files)",
+			want: "resourceFilename in files",
+		},
+		{
+			when: "count < 3 && b || count < 3 && !b",
+			want: "count < 3",
+		},
+		{
+			when: "(a && b) || (a && c) || (b && c) || (a && b && c)",
+			want: "a && b || a && c || b && c",
+		},
+		{
+			when:    "a && !a",
+			want:    "a && !a",
+			wantErr: `when clause "a && !a" can never be true`,
+		},
+		{
+			when:    "resourceLangId == go && resourceLangId == 'java'",
+			want:    "resourceLangId == go && resourceLangId == 'java'",
+			wantErr: `when clause "resourceLangId == go && resourceLangId == 'java'" can never be true`,
+		},
+		{
+			when:    "false || a && false",
+			want:    "false || a && false",
+			wantErr: `when clause "false || a && false" can never be true`,
+		},
+		{
+			// Too many variables to simplify.
+			when: strings.Join(many, " && "),
+			want: strings.Join(many, " && "),
+		},
+		{
+			// Invalid clauses are reported elsewhere.
+			when: "a &&",
+			want: "a &&",
+		},
+	} {
+		t.Run(test.when, func(t *testing.T) {
+			got, err := simplifyWhen(test.when)
+			var gotErr string
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr); diff != "" {
+				t.Errorf("simplifyWhen(%q) returned incorrect error (-want, +got):\n%s", test.when, diff)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("simplifyWhen(%q) returned incorrect value (-want, +got):\n%s", test.when, diff)
+			}
+		})
+	}
+}
+
+func TestSimplifyWhenClauses(t *testing.T) {
+	kbs := []*Keybinding{
+		{Key: "ctrl+a", Command: "groog.a", When: "a && a"},
+		{Key: "ctrl+b", Command: "-groog.b", When: "b && b"},
+		{Key: "ctrl+c", Command: "groog.c", When: "c && !c"},
+		{Key: "ctrl+d", Command: "groog.d", When: "a && a"},
+		{Key: "ctrl+e", Command: "groog.e", When: "c && !c", Location: Location{"keybindings.go", 5}},
+	}
+	kbs[2].Location = Location{"keybindings.go", 3}
+	ds := &Diagnostics{}
+	simplifyWhenClauses(ds, kbs)
+	want := []*Keybinding{
+		{Key: "ctrl+a", Command: "groog.a", When: "a"},
+		{Key: "ctrl+b", Command: "-groog.b", When: "b && b"},
+		{Key: "ctrl+c", Command: "groog.c", When: "c && !c"},
+		{Key: "ctrl+d", Command: "groog.d", When: "a"},
+		{Key: "ctrl+e", Command: "groog.e", When: "c && !c"},
+	}
+	if diff := cmp.Diff(want, kbs, cmpopts.IgnoreFields(Keybinding{}, "Location")); diff != "" {
+		t.Errorf("simplifyWhenClauses() produced incorrect keybindings (-want, +got):\n%s", diff)
+	}
+	// The clause is only simplified once, but it's reported at every binding.
+	wantDiagnostics := strings.Join([]string{
+		`keybindings.go:3: when clause "c && !c" can never be true (bound to ctrl+c)`,
+		`keybindings.go:5: when clause "c && !c" can never be true (bound to ctrl+e)`,
+	}, "\n")
+	if diff := cmp.Diff(wantDiagnostics, ds.String()); diff != "" {
+		t.Errorf("simplifyWhenClauses() recorded incorrect diagnostics (-want, +got):\n%s", diff)
+	}
+}
+
+func TestPrimeImplicants(t *testing.T) {
+	// f(a, b, c) = sum(0, 1, 2, 5, 6, 7) (the classic cyclic example, which
+	// has no essential primes)
+	minterms := []uint{0, 1, 2, 5, 6, 7}
+	primes := primeImplicants(minterms, nil)
+	if len(primes) != 6 {
+		t.Errorf("primeImplicants() returned %d primes; want 6: %v", len(primes), primes)
+	}
+	cover := minimalCover(primes, minterms, 3)
+	if len(cover) != 3 {
+		t.Errorf("minimalCover() returned %d terms; want 3: %v", len(cover), cover)
+	}
+	for _, m := range minterms {
+		covered := false
+		for _, p := range cover {
+			covered = covered || p.covers(m)
+		}
+		if !covered {
+			t.Errorf("minimalCover() doesn't cover minterm %d", m)
+		}
+	}
+}
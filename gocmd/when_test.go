@@ -0,0 +1,284 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestParseWhen(t *testing.T) {
+	for _, test := range []struct {
+		when string
+		want whenExpr
+		// wantString is the printed expression (if different from when).
+		wantString string
+		wantErr    string
+	}{
+		{
+			when: "",
+			want: whenLiteral(true),
+			// The printed expression is always valid (empty when clauses
+			// aren't emitted).
+			wantString: "true",
+		},
+		{
+			when: "editorFocus",
+			want: whenKey("editorFocus"),
+		},
+		{
+			when: "groog.context.terminal.findMode && !view.terminal.visible",
+			want: whenAnd{whenKey("groog.context.terminal.findMode"), &whenNot{whenKey("view.terminal.visible")}},
+		},
+		{
+			when: "a || b && !c",
+			want: whenOr{whenKey("a"), whenAnd{whenKey("b"), &whenNot{whenKey("c")}}},
+		},
+		{
+			when: "(a || b) && !(c && d)",
+			want: whenAnd{whenOr{whenKey("a"), whenKey("b")}, &whenNot{whenAnd{whenKey("c"), whenKey("d")}}},
+		},
+		{
+			when:       "((a))&&b",
+			want:       whenAnd{whenKey("a"), whenKey("b")},
+			wantString: "a && b",
+		},
+		{
+			when: "resourceLangId == go && editorLangId != 'markdown'",
+			want: whenAnd{
+				&whenCmp{"resourceLangId", "==", &whenValue{Raw: "go", Type: contextString}},
+				&whenCmp{"editorLangId", "!=", &whenValue{Raw: "'markdown'", Type: contextString}},
+			},
+		},
+		{
+			when: "listFocus == true && count >= 2",
+			want: whenAnd{
+				&whenCmp{"listFocus", "==", &whenValue{Raw: "true", Type: contextBool}},
+				&whenCmp{"count", ">=", &whenValue{Raw: "2", Type: contextNumber}},
+			},
+		},
+		{
+			when: `resourceFilename =~ /^.*\/docs?\//i`,
+			want: &whenCmp{"resourceFilename", "=~", &whenValue{Raw: `/^.*\/docs?\//i`, Type: contextString}},
+		},
+		{
+			when: "resourceFilename in supportedFolders || resourceFilename not in other",
+			want: whenOr{
+				&whenCmp{"resourceFilename", "in", &whenValue{Raw: "supportedFolders", Key: true}},
+				&whenCmp{"resourceFilename", "not in", &whenValue{Raw: "other", Key: true}},
+			},
+		},
+		{
+			when: "inputFocus && !false",
+			want: whenAnd{whenKey("inputFocus"), &whenNot{whenLiteral(false)}},
+		},
+		{
+			when:    "a &&",
+			wantErr: "column 5: unexpected end of when clause",
+		},
+		{
+			when:    "(a || b",
+			wantErr: "column 8: missing closing parenthesis",
+		},
+		{
+			when:    "a b",
+			wantErr: `column 3: unexpected "b"`,
+		},
+		{
+			when:    "a == 'b",
+			wantErr: "column 6: unterminated string",
+		},
+		{
+			when:    "a =~ b",
+			wantErr: `column 6: expected a regular expression after "=~"`,
+		},
+		{
+			when:    "a ==",
+			wantErr: `column 5: expected a value after "=="`,
+		},
+	} {
+		t.Run(test.when, func(t *testing.T) {
+			got, err := parseWhen(test.when)
+			var gotErr string
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if diff := cmp.Diff(test.wantErr, gotErr); diff != "" {
+				t.Errorf("parseWhen(%q) returned incorrect error (-want, +got):\n%s", test.when, diff)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("parseWhen(%q) returned incorrect value (-want, +got):\n%s", test.when, diff)
+			}
+			if got == nil {
+				return
+			}
+			wantString := test.wantString
+			if wantString == "" {
+				wantString = test.when
+			}
+			if diff := cmp.Diff(wantString, got.String()); diff != "" {
+				t.Errorf("parseWhen(%q).String() returned incorrect value (-want, +got):\n%s", test.when, diff)
+			}
+		})
+	}
+}
+
+func TestCheckWhen(t *testing.T) {
+	keys := map[string]*ContextKey{}
+	for _, ck := range []*ContextKey{
+		{Key: "editorFocus", Type: contextBool},
+		{Key: "resourceLangId", Type: contextString},
+		{Key: "count", Type: contextNumber},
+		{Key: "inSearchEditor", Type: contextBool, Since: "1.43.0"},
+		{Key: "groog.context.findMode", Type: contextBool},
+	} {
+		keys[ck.Key] = ck
+	}
+	for _, test := range []struct {
+		name string
+		when string
+		want []string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "known keys",
+			when: "editorFocus && !groog.context.findMode || resourceLangId == go && count > 1",
+		},
+		{
+			name: "unknown keys",
+			when: "editorFocused || groog.context.fndMode",
+			want: []string{
+				`unknown context key "editorFocused" in when clause "editorFocused || groog.context.fndMode"`,
+				`unknown context key "groog.context.fndMode" in when clause "editorFocused || groog.context.fndMode"`,
+			},
+		},
+		{
+			name: "newer than engine",
+			when: "inSearchEditor && count == 1",
+			want: []string{
+				`warning: context key "inSearchEditor" in when clause "inSearchEditor && count == 1" requires VS Code 1.43.0`,
+			},
+		},
+		{
+			name: "mismatched types",
+			when: "editorFocus == go || count == abc || count =~ /a/ || resourceLangId < 3",
+			want: []string{
+				`context key "editorFocus" is a bool, but is compared to a string in when clause "editorFocus == go || count == abc || count =~ /a/ || resourceLangId < 3" (editorFocus == go)`,
+				`context key "count" is a number, but is compared to a string in when clause "editorFocus == go || count == abc || count =~ /a/ || resourceLangId < 3" (count == abc)`,
+				`context key "count" is a number, but is compared to a string in when clause "editorFocus == go || count == abc || count =~ /a/ || resourceLangId < 3" (count =~ /a/)`,
+				`context key "resourceLangId" is a string, but is compared to a number in when clause "editorFocus == go || count == abc || count =~ /a/ || resourceLangId < 3" (resourceLangId < 3)`,
+			},
+		},
+		{
+			name: "matching types",
+			when: "editorFocus == true && resourceLangId != 1 && count != 2",
+		},
+		{
+			name: "unknown in key",
+			when: "resourceLangId in langs",
+			want: []string{
+				`unknown context key "langs" in when clause "resourceLangId in langs"`,
+			},
+		},
+		{
+			name: "negated comparison",
+			when: "!(count > 1) && !editorFocus",
+		},
+		{
+			name: "negated compound clause",
+			when: "!(editorFocus && count > 1) || !(!editorFocus)",
+			want: []string{
+				`Can only negate a single when context ("editorFocus && count > 1") in when clause "!(editorFocus && count > 1) || !(!editorFocus)"`,
+				`Can only negate a single when context ("!editorFocus") in when clause "!(editorFocus && count > 1) || !(!editorFocus)"`,
+			},
+		},
+		{
+			name: "numeric comparison with string",
+			when: "count < abc",
+			want: []string{
+				`< requires a number in when clause "count < abc" (count < abc)`,
+			},
+		},
+		{
+			name: "invalid clause",
+			when: "editorFocus &&",
+			want: []string{
+				`failed to parse when clause "editorFocus &&": column 15: unexpected end of when clause`,
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ds := &Diagnostics{}
+			checkWhen(ds, Location{}, keys, &Version{Major: 1, Minor: 40}, test.when)
+			var got []string
+			for _, d := range ds.All() {
+				msg := d.Message
+				if d.Severity == severityWarning {
+					msg = "warning: " + msg
+				}
+				got = append(got, msg)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("checkWhen(%q) recorded incorrect diagnostics (-want, +got):\n%s", test.when, diff)
+			}
+		})
+	}
+}
+
+func TestGroogContextKeys(t *testing.T) {
+	// Every mode in the DSL must be registered.
+	keys := map[string]bool{}
+	for _, ck := range groogContextKeys() {
+		if keys[ck.Key] {
+			t.Errorf("context key %q is registered multiple times", ck.Key)
+		}
+		keys[ck.Key] = true
+	}
+	for _, wc := range []*WhenContext{groogFindMode, groogSimpleFindMode, groogQMK, groogRecording, groogTerminalFindMode} {
+		if !keys[wc.value] {
+			t.Errorf("context key %q is not registered", wc.value)
+		}
+	}
+}
+
+func TestGroogContextKeyVersions(t *testing.T) {
+	kbs := groogPackage("").Contributes.Keybindings
+	requiresRegex := regexp.MustCompile(`^context key "([^"]+)" in when clause .* requires VS Code (.+)$`)
+	for _, test := range []struct {
+		engine string
+		want   []string
+	}{
+		{
+			engine: "^1.81.0",
+		},
+		{
+			engine: "^1.45.0",
+			want:   []string{"view.terminal.visible 1.46.0"},
+		},
+		{
+			engine: "^1.40.0",
+			want:   []string{"inSearchEditor 1.43.0", "view.terminal.visible 1.46.0"},
+		},
+	} {
+		t.Run(test.engine, func(t *testing.T) {
+			ds := &Diagnostics{}
+			checkWhenClauses(ds, groogContextKeys(), &Package{Engines: map[string]string{"vscode": test.engine}}, kbs)
+
+			requires := map[string]bool{}
+			for _, d := range ds.All() {
+				m := requiresRegex.FindStringSubmatch(d.Message)
+				if d.Severity != severityWarning || m == nil {
+					t.Errorf("checkWhenClauses() recorded unexpected diagnostic: %s", d)
+					continue
+				}
+				requires[m[1]+" "+m[2]] = true
+			}
+			if diff := cmp.Diff(test.want, sortedKeys(requires), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("checkWhenClauses() reported incorrect context keys (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+// Code generated by vs-package. DO NOT EDIT.
+
+export interface MessageArgs {
+  message: string;
+  error?: boolean;
+}
+
+export interface MultiCommandArgs {
+  sequence: SingleCommand[];
+}
+
+export interface TestFileArgs {
+  part: number;
+}
+
+export interface TypeArgs {
+  text: string;
+}
+
+export interface SingleCommand {
+  command: string;
+  args?: { [key: string]: any };
+  async?: boolean;
+  delay?: number;
+}
@@ -1,6 +1,7 @@
 import * as vscode from 'vscode';
 import { handleDeleteCharacter, handleTypedCharacter } from './character-functions';
 import { ColorMode } from './color_mode';
+import { TypeArgs } from './command-args';
 import { FindHandler } from './find';
 import { Registerable, TypeHandler, getPrefixText } from './handler';
 import { CtrlGCommand, CursorMove, DeleteCommand, setGroogContext } from './interfaces';
@@ -107,7 +108,7 @@ export class Emacs {
 
     this.typoFixer.register(context);
 
-    context.subscriptions.push(vscode.commands.registerCommand('groog.type', this.recorder.lockWrap<TypeArg>('groog.type', (arg: TypeArg) => this.type(arg))));
+    context.subscriptions.push(vscode.commands.registerCommand('groog.type', this.recorder.lockWrap<TypeArgs>('groog.type', (arg: TypeArgs) => this.type(arg))));
     context.subscriptions.push(vscode.window.onDidChangeActiveTextEditor(e => {
       if (e && isFileUri(e.document.uri) && (!this.lastVisitedFile || (this.lastVisitedFile.toString() !== e.document.uri.toString()))) {
         this.lastVisitedFile = e.document.uri;
@@ -177,7 +178,7 @@ export class Emacs {
     return chain.then((apply: boolean) => apply ? applyCallback() : false).catch((reason: any) => { vscode.window.showErrorMessage(`Failed to apply callbacks: ${reason}`); });
   }
 
-  async type(arg: TypeArg): Promise<void> {
+  async type(arg: TypeArgs): Promise<void> {
     const s = arg.text;
     return this.runHandlers(
       async (th: TypeHandler): Promise<boolean> => th.textHandler(s),
@@ -342,10 +343,6 @@ export class Emacs {
   }
 }
 
-interface TypeArg {
-  text: string;
-}
-
 interface JumpDist {
   lines: number;
 }
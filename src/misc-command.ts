@@ -1,6 +1,7 @@
 import { basename } from 'path';
 import path = require('path');
 import * as vscode from 'vscode';
+import { MessageArgs, MultiCommandArgs, TestFileArgs } from './command-args';
 import { Emacs } from './emacs';
 
 interface MiscCommand {
@@ -12,12 +13,12 @@ interface MiscCommand {
 export const miscCommands: MiscCommand[] = [
   {
     name: "multiCommand.execute",
-    f: (e: Emacs, mc: MultiCommand) => multiCommand(mc),
+    f: (e: Emacs, mc: MultiCommandArgs) => multiCommand(mc),
     noLock: true,
   },
   {
     name: "message.info",
-    f: (e: Emacs, msg: Message | undefined) => infoMessage(msg),
+    f: (e: Emacs, msg: MessageArgs | undefined) => infoMessage(msg),
   },
   {
     name: "copyFilename",
@@ -29,18 +30,7 @@ export const miscCommands: MiscCommand[] = [
   },
 ];
 
-interface SingleCommand {
-  command: string;
-  args?: any;
-  async?: boolean;
-  delay?: number;
-}
-
-interface MultiCommand {
-  sequence: SingleCommand[];
-}
-
-export async function multiCommand(mc: MultiCommand) {
+export async function multiCommand(mc: MultiCommandArgs) {
   for (const sc of mc.sequence) {
     if (sc.delay) {
       setTimeout(() => vscode.commands.executeCommand(sc.command, sc.args), sc.delay);
@@ -74,10 +64,6 @@ function sendTerminalCommand(args: TestFileArgs, command: string) {
   }
 }
 
-interface TestFileArgs {
-  part: number;
-}
-
 async function testFile(args: TestFileArgs, file?: vscode.Uri) {
   if (!file) {
     vscode.window.showErrorMessage(`Previous file not set`);
@@ -102,12 +88,7 @@ async function testFile(args: TestFileArgs, file?: vscode.Uri) {
   }
 }
 
-interface Message {
-  message: string;
-  error?: boolean;
-}
-
-async function infoMessage(msg: Message | undefined) {
+async function infoMessage(msg: MessageArgs | undefined) {
   if (!msg) {
     vscode.window.showErrorMessage("No message set");
     return;